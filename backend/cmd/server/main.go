@@ -32,13 +32,24 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/xiaoliu10/remote-code/internal/agent"
 	"github.com/xiaoliu10/remote-code/internal/api"
 	"github.com/xiaoliu10/remote-code/internal/api/middleware"
 	"github.com/xiaoliu10/remote-code/internal/auth"
+	"github.com/xiaoliu10/remote-code/internal/chatbot"
 	"github.com/xiaoliu10/remote-code/internal/config"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/push"
+	"github.com/xiaoliu10/remote-code/internal/scheduler"
 	"github.com/xiaoliu10/remote-code/internal/security"
 	"github.com/xiaoliu10/remote-code/internal/setup"
+	"github.com/xiaoliu10/remote-code/internal/snippets"
+	"github.com/xiaoliu10/remote-code/internal/terminal"
 	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
+	"github.com/xiaoliu10/remote-code/internal/users"
+	"github.com/xiaoliu10/remote-code/internal/webhook"
 	"github.com/xiaoliu10/remote-code/internal/websocket"
 	"golang.org/x/time/rate"
 )
@@ -93,9 +104,137 @@ func main() {
 	}
 	dataDir := filepath.Join(homeDir, ".remote-code")
 
+	eventBus := events.NewBus()
+
 	tmuxManager := tmux.NewManager(dataDir)
+	tmuxManager.SetEventBus(eventBus)
+	tmuxManager.SetMaxSessionsPerUser(cfg.Security.MaxSessionsPerUser)
+	tmuxManager.StartSnapshotter(cfg.Tmux.SnapshotInterval, cfg.Tmux.ScrollbackLines)
+	tmuxManager.StartReconciler(cfg.Tmux.ReconcileInterval)
+	tmuxManager.StartAlertMonitor(tmux.AlertOptions{
+		Bell:     cfg.Tmux.MonitorBell,
+		Activity: cfg.Tmux.MonitorActivity,
+		Silence:  cfg.Tmux.MonitorSilence,
+	})
 	validator := security.NewSessionValidator(cfg.Security.AllowedWorkDir)
-	wsHub := websocket.NewHub()
+
+	// 用户账号，首次启动时用 ADMIN_PASSWORD 创建管理员
+	userStore, err := users.NewStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	if err := userStore.Bootstrap(cfg.Auth.AdminPassword); err != nil {
+		log.Fatalf("Failed to create administrator account: %v", err)
+	}
+
+	triggerStore, err := triggers.NewStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load trigger rules: %v", err)
+	}
+	triggerEngine := triggers.NewEngine(triggerStore, tmuxManager, eventBus, userStore)
+	triggerEngine.Start()
+
+	historyStore, err := history.NewStore(dataDir, history.Options{
+		MaxEntries: cfg.History.MaxEntries,
+		Retention:  cfg.History.Retention,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load command history: %v", err)
+	}
+	historyStore.Start()
+	tmuxManager.AddSessionHook(historyStore.SessionChanged)
+
+	scheduleStore, err := scheduler.NewStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load scheduled commands: %v", err)
+	}
+	commandScheduler := scheduler.NewScheduler(scheduleStore, tmuxManager, historyStore, userStore)
+	commandScheduler.Start()
+
+	snippetStore, err := snippets.NewStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load snippets: %v", err)
+	}
+
+	webhookStore, err := webhook.NewStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load webhooks: %v", err)
+	}
+	webhookDispatcher := webhook.NewDispatcher(webhookStore, eventBus, dataDir, webhook.Options{
+		MaxAttempts: cfg.Webhook.MaxAttempts,
+		RetryBase:   cfg.Webhook.RetryBase,
+		Timeout:     cfg.Webhook.Timeout,
+	})
+	webhookDispatcher.Start()
+
+	signaturesFile := cfg.Agent.SignaturesFile
+	if signaturesFile == "" {
+		signaturesFile = filepath.Join(dataDir, "prompt_signatures.json")
+	}
+	signatures, err := agent.LoadSignatures(signaturesFile)
+	if err != nil {
+		log.Fatalf("Failed to load prompt signatures: %v", err)
+	}
+	promptDetector, err := agent.NewDetector(tmuxManager, eventBus, signatures)
+	if err != nil {
+		log.Fatalf("Failed to create prompt detector: %v", err)
+	}
+	if cfg.Agent.PromptDetection {
+		promptDetector.Start(cfg.Agent.DetectInterval)
+	}
+
+	screenTracker := terminal.NewTracker(tmuxManager, cfg.Tmux.ScrollbackLines)
+	screenTracker.Start()
+
+	themesFile := cfg.Render.ThemesFile
+	if themesFile == "" {
+		themesFile = filepath.Join(dataDir, "render_themes.json")
+	}
+	themes, err := terminal.LoadThemes(themesFile)
+	if err != nil {
+		log.Fatalf("Failed to load render themes: %v", err)
+	}
+	renderer, err := terminal.NewRenderer(themes, terminal.RenderOptions{
+		Theme:      cfg.Render.Theme,
+		FontFamily: cfg.Render.FontFamily,
+		FontSize:   cfg.Render.FontSize,
+		CellWidth:  cfg.Render.CellWidth,
+		LineHeight: cfg.Render.LineHeight,
+		Padding:    cfg.Render.Padding,
+		Cursor:     true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create screenshot renderer: %v", err)
+	}
+
+	var pushNotifier *push.Notifier
+	if cfg.Push.Enabled {
+		vapidKeys, err := push.LoadOrGenerateVAPIDKeys(dataDir)
+		if err != nil {
+			log.Fatalf("Failed to load VAPID keys: %v", err)
+		}
+		pushStore, err := push.NewStore(dataDir)
+		if err != nil {
+			log.Fatalf("Failed to load push subscriptions: %v", err)
+		}
+		pushNotifier = push.NewNotifier(pushStore, eventBus, vapidKeys, cfg.Push.Subject, userStore)
+		pushNotifier.Start()
+	}
+
+	var bot *chatbot.Bot
+	if cfg.Chatbot.Token != "" {
+		bot = chatbot.NewBot(chatbot.Config{
+			Token:        cfg.Chatbot.Token,
+			APIURL:       cfg.Chatbot.APIURL,
+			AllowedChats: cfg.Chatbot.AllowedChats,
+			UserID:       cfg.Chatbot.UserID,
+			Notify:       cfg.Chatbot.Notify,
+			Screenshots:  cfg.Chatbot.Screenshots,
+		}, tmuxManager, validator, promptDetector, eventBus, historyStore, screenTracker, renderer, userStore)
+		bot.Start()
+	}
+
+	wsHub := websocket.NewHub(cfg.WebSocket.ResumeFrames, cfg.WebSocket.ResumeTTL)
 
 	// 启动 WebSocket Hub
 	go wsHub.Run()
@@ -114,12 +253,22 @@ func main() {
 
 	// 设置路由
 	routerConfig := &api.RouterConfig{
-		JWTManager:    jwtManager,
-		TmuxManager:   tmuxManager,
-		Validator:     validator,
-		Hub:           wsHub,
-		AdminPassword: cfg.Auth.AdminPassword,
-		Config:        cfg,
+		JWTManager:  jwtManager,
+		TmuxManager: tmuxManager,
+		Validator:   validator,
+		Hub:         wsHub,
+		EventBus:    eventBus,
+		Triggers:    triggerEngine,
+		Scheduler:   commandScheduler,
+		Snippets:    snippetStore,
+		History:     historyStore,
+		Detector:    promptDetector,
+		Terminal:    screenTracker,
+		Renderer:    renderer,
+		Webhooks:    webhookDispatcher,
+		Push:        pushNotifier,
+		Users:       userStore,
+		Config:      cfg,
 	}
 	router := api.SetupRouter(routerConfig)
 
@@ -160,9 +309,30 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// 先关闭终端连接，SSE 和长轮询请求随之结束
+	wsHub.Stop()
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	triggerEngine.Stop()
+	commandScheduler.Stop()
+	historyStore.Stop()
+	userStore.Flush()
+	promptDetector.Stop()
+	screenTracker.Stop()
+	webhookDispatcher.Stop()
+	if pushNotifier != nil {
+		pushNotifier.Stop()
+	}
+	if bot != nil {
+		bot.Stop()
+	}
+
+	// 退出前保存一次会话快照
+	log.Printf("Saved snapshots of %d session(s)", tmuxManager.SnapshotAll())
+	tmuxManager.Close()
+
 	log.Println("Server exited")
 }
@@ -0,0 +1,356 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package agent
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+const (
+	// settleDelay 输出停止多久后再检查屏幕，避免在界面重绘过程中误判
+	settleDelay = 300 * time.Millisecond
+	// fullScanEvery 每隔多少个检查周期对所有会话做一次全量检查
+	fullScanEvery = 30
+)
+
+var (
+	ErrNoPendingPrompt = errors.New("no pending prompt")
+	ErrPromptChanged   = errors.New("prompt has changed")
+	ErrUnknownOption   = errors.New("unknown option")
+)
+
+// Action 对提示的响应方式
+type Action string
+
+const (
+	ActionApprove Action = "approve"
+	ActionDeny    Action = "deny"
+	ActionChoose  Action = "choose"
+)
+
+// Detector 检测会话中等待批准的 AI 代理提示。会话有新输出并稳定后检查其屏幕，
+// 识别到的提示通过 pending_prompt 暴露并发布事件
+type Detector struct {
+	manager    *tmux.Manager
+	bus        *events.Bus
+	signatures []*compiledSignature
+
+	scanMu  sync.Mutex // 串行化屏幕检查，避免重复发布事件
+	mu      sync.Mutex
+	pending map[string]*PendingPrompt // 会话名 -> 等待中的提示
+	dirty   map[string]time.Time      // 会话名 -> 最近一次输出时间
+	cancel  func()
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewDetector 创建提示检测器
+func NewDetector(manager *tmux.Manager, bus *events.Bus, signatures []Signature) (*Detector, error) {
+	d := &Detector{
+		manager: manager,
+		bus:     bus,
+		pending: make(map[string]*PendingPrompt),
+		dirty:   make(map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	for _, sig := range signatures {
+		compiled, err := sig.compile()
+		if err != nil {
+			return nil, err
+		}
+		d.signatures = append(d.signatures, compiled)
+	}
+	return d, nil
+}
+
+// Signatures 返回使用中的提示签名
+func (d *Detector) Signatures() []Signature {
+	signatures := make([]Signature, 0, len(d.signatures))
+	for _, sig := range d.signatures {
+		signatures = append(signatures, sig.Signature)
+	}
+	return signatures
+}
+
+// Start 启动后台检测，interval 为检查周期，<= 0 时不启动
+func (d *Detector) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ch, cancel := d.manager.SubscribeOutput("", 256)
+	d.cancel = cancel
+
+	// 记录有新输出的会话
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for chunk := range ch {
+			d.mu.Lock()
+			d.dirty[chunk.Session] = time.Now()
+			d.mu.Unlock()
+		}
+	}()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for tick := 0; ; tick++ {
+			if tick%fullScanEvery == 0 {
+				d.scanAll()
+			} else {
+				d.scanDirty()
+			}
+			select {
+			case <-ticker.C:
+			case <-d.done:
+				return
+			}
+		}
+	}()
+	log.Printf("[Agent] Prompt detection enabled (%d signature(s), interval: %s)", len(d.signatures), interval)
+}
+
+// Stop 停止后台检测
+func (d *Detector) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	close(d.done)
+	d.wg.Wait()
+	d.cancel = nil
+}
+
+// scanAll 检查所有会话，并清理已不存在的会话的提示
+func (d *Detector) scanAll() {
+	sessions := d.manager.ListSessions()
+	alive := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		alive[session.Name] = true
+		d.scan(session)
+	}
+
+	d.mu.Lock()
+	for name := range d.pending {
+		if !alive[name] {
+			delete(d.pending, name)
+		}
+	}
+	d.mu.Unlock()
+}
+
+// scanDirty 检查输出已稳定的会话
+func (d *Detector) scanDirty() {
+	now := time.Now()
+	var names []string
+	d.mu.Lock()
+	for name, last := range d.dirty {
+		if now.Sub(last) >= settleDelay {
+			names = append(names, name)
+			delete(d.dirty, name)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, name := range names {
+		if session, err := d.manager.GetSession(name); err == nil {
+			d.scan(session)
+		}
+	}
+}
+
+// Detect 立即检查会话屏幕，返回识别到的提示（没有时为 nil）
+func (d *Detector) Detect(session *tmux.Session) (*PendingPrompt, error) {
+	screen, err := session.CaptureScreen()
+	if err != nil {
+		return nil, err
+	}
+	command, _ := session.CurrentCommand()
+
+	// 多个签名匹配时取最靠近屏幕底部（最新）的提示，位置相同时按签名顺序
+	lines := splitScreen(screen)
+	var found *PendingPrompt
+	foundAt := -1
+	for _, sig := range d.signatures {
+		if sig.command != nil && !sig.command.MatchString(command) {
+			continue
+		}
+		if prompt, at := sig.detect(lines); prompt != nil && at > foundAt {
+			found, foundAt = prompt, at
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+
+	found.Session = session.Name
+	found.ID = promptID(found)
+	found.DetectedAt = time.Now()
+	return found, nil
+}
+
+// scan 检查会话并在提示出现或消失时更新状态、发布事件
+func (d *Detector) scan(session *tmux.Session) *PendingPrompt {
+	d.scanMu.Lock()
+	defer d.scanMu.Unlock()
+
+	prompt, err := d.Detect(session)
+	if err != nil {
+		return d.Pending(session.Name)
+	}
+
+	d.mu.Lock()
+	previous := d.pending[session.Name]
+	switch {
+	case prompt == nil && previous == nil:
+		d.mu.Unlock()
+		return nil
+	case prompt != nil && previous != nil && prompt.ID == previous.ID:
+		d.mu.Unlock()
+		return previous
+	}
+	if prompt == nil {
+		delete(d.pending, session.Name)
+	} else {
+		d.pending[session.Name] = prompt
+	}
+	d.mu.Unlock()
+
+	if previous != nil {
+		d.publish(events.AgentPromptCleared, session, map[string]string{"id": previous.ID})
+	}
+	if prompt != nil {
+		log.Printf("[Agent] Session %s is waiting for approval (%s): %s", session.Name, prompt.Signature, prompt.Question)
+		d.publish(events.AgentPrompt, session, prompt)
+	}
+	return prompt
+}
+
+// publish 发布提示事件
+func (d *Detector) publish(eventType events.Type, session *tmux.Session, data interface{}) {
+	d.bus.Publish(events.Event{
+		Type:    eventType,
+		Session: session.Name,
+		Owner:   session.OwnerID,
+		Data:    data,
+	})
+}
+
+// Pending 返回会话当前等待中的提示，没有时为 nil
+func (d *Detector) Pending(name string) *PendingPrompt {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending[name]
+}
+
+// Refresh 立即重新检查会话并返回等待中的提示
+func (d *Detector) Refresh(session *tmux.Session) *PendingPrompt {
+	return d.scan(session)
+}
+
+// Respond 响应会话中等待的提示：批准、拒绝或选择指定选项。
+// promptID 非空时必须与当前提示一致，防止响应到已经变化的提示。返回发送的按键
+func (d *Detector) Respond(session *tmux.Session, action Action, optionKey, promptID string) ([]string, error) {
+	prompt := d.scan(session)
+	if prompt == nil {
+		return nil, ErrNoPendingPrompt
+	}
+	if promptID != "" && promptID != prompt.ID {
+		return nil, ErrPromptChanged
+	}
+
+	keys, err := prompt.keysFor(action, optionKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if err := session.SendKeys(key); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[Agent] Responded to prompt in session %s: %s %v", session.Name, action, keys)
+
+	// 界面更新后重新检查
+	d.mu.Lock()
+	d.dirty[session.Name] = time.Now()
+	d.mu.Unlock()
+
+	return keys, nil
+}
+
+// keysFor 返回执行响应需要发送的按键
+func (p *PendingPrompt) keysFor(action Action, optionKey string) ([]string, error) {
+	var chosen *Option
+	switch action {
+	case ActionApprove:
+		for i := range p.Options {
+			if p.sig.approve.MatchString(p.Options[i].Label) {
+				chosen = &p.Options[i]
+				break
+			}
+		}
+		if chosen == nil {
+			chosen = &p.Options[0]
+		}
+	case ActionDeny:
+		for i := range p.Options {
+			if p.sig.deny.MatchString(p.Options[i].Label) {
+				chosen = &p.Options[i]
+				break
+			}
+		}
+		if chosen == nil {
+			if len(p.sig.DenyKeys) == 0 {
+				return nil, ErrUnknownOption
+			}
+			return append([]string(nil), p.sig.DenyKeys...), nil
+		}
+	case ActionChoose:
+		for i := range p.Options {
+			if p.Options[i].Key == optionKey {
+				chosen = &p.Options[i]
+				break
+			}
+		}
+		if chosen == nil {
+			return nil, ErrUnknownOption
+		}
+	default:
+		return nil, ErrUnknownOption
+	}
+
+	keys := []string{chosen.Key}
+	if p.sig.SubmitEnter {
+		keys = append(keys, "Enter")
+	}
+	return keys, nil
+}
@@ -0,0 +1,330 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package agent
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxContextLines 提示问题上方最多保留的上下文行数（例如待批准的命令）
+	maxContextLines = 8
+	// maxTrailingLines 菜单选项之后最多允许的非空行数（如快捷键提示），
+	// 超过说明提示已不在屏幕底部、不再等待输入
+	maxTrailingLines = 2
+)
+
+// 选项标签的默认批准/拒绝匹配规则
+const (
+	defaultApprovePattern = `(?i)^(yes|y|allow|approve|accept|proceed|continue)\b`
+	defaultDenyPattern    = `(?i)^(no|n|deny|reject|decline|cancel)\b`
+)
+
+// Option 提示中的一个选项
+type Option struct {
+	Key      string `json:"key"`   // 选择该选项时发送的按键
+	Label    string `json:"label"` // 选项文字
+	Selected bool   `json:"selected,omitempty"`
+}
+
+// Signature 提示签名：描述如何在屏幕上识别某类批准提示并解析其选项
+type Signature struct {
+	Name        string   `json:"name"`
+	Agent       string   `json:"agent"`                  // 代理名称，如 claude-code
+	Command     string   `json:"command,omitempty"`      // 匹配 pane 当前程序名的正则，为空表示不限制
+	Question    string   `json:"question"`               // 匹配提示问题行的正则
+	Option      string   `json:"option,omitempty"`       // 匹配问题之后选项行的正则：第 1 组为按键，第 2 组为文字
+	Options     []Option `json:"options,omitempty"`      // 固定选项（如 y/n 提示），与 Option 二选一
+	SubmitEnter bool     `json:"submit_enter,omitempty"` // 发送选项按键后再发送回车
+	Approve     string   `json:"approve,omitempty"`      // 识别批准选项的正则，匹配选项文字
+	Deny        string   `json:"deny,omitempty"`         // 识别拒绝选项的正则，匹配选项文字
+	DenyKeys    []string `json:"deny_keys,omitempty"`    // 没有拒绝选项时用于拒绝的按键，如 Escape
+}
+
+// compiledSignature 编译后的提示签名
+type compiledSignature struct {
+	Signature
+	command  *regexp.Regexp
+	question *regexp.Regexp
+	option   *regexp.Regexp
+	approve  *regexp.Regexp
+	deny     *regexp.Regexp
+}
+
+// numberedOption 带序号的菜单选项，如 "❯ 1. Yes"
+const numberedOption = `^(?:[❯›>▶]\s*)?(\d+)[.)]\s+(.+)$`
+
+// BuiltinSignatures 内置的提示签名，按顺序匹配
+var BuiltinSignatures = []Signature{
+	{
+		Name:     "claude-code-permission",
+		Agent:    "claude-code",
+		Command:  `(?i)claude|node`,
+		Question: `^Do you want to .+\?$`,
+		Option:   numberedOption,
+		DenyKeys: []string{"Escape"},
+	},
+	{
+		Name:     "codex-approval",
+		Agent:    "codex",
+		Command:  `(?i)codex|node`,
+		Question: `(?i)^(Would you like to|Allow) .+\?$`,
+		Option:   numberedOption,
+		DenyKeys: []string{"Escape"},
+	},
+	{
+		Name:     "numbered-approval",
+		Agent:    "generic",
+		Question: `(?i)^(do you want to|would you like to|allow|approve|apply|run|execute|proceed|continue)\b.*\?$`,
+		Option:   numberedOption,
+		DenyKeys: []string{"Escape"},
+	},
+	{
+		Name:     "yes-no",
+		Agent:    "generic",
+		Question: `(?i)(\[y/n\]|\(y/n\)|\(y\)es/\(n\)o)(\s*\[[^\]]*\])?\s*[:?]?$`,
+		Options: []Option{
+			{Key: "y", Label: "Yes"},
+			{Key: "n", Label: "No"},
+		},
+		SubmitEnter: true,
+	},
+}
+
+// LoadSignatures 加载提示签名：自定义签名文件（JSON 数组）中的签名优先，
+// 与内置签名同名时覆盖内置签名。文件不存在时只使用内置签名
+func LoadSignatures(path string) ([]Signature, error) {
+	var custom []Signature
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &custom); err != nil {
+				return nil, fmt.Errorf("invalid signatures file %s: %w", path, err)
+			}
+		}
+	}
+
+	signatures := append([]Signature{}, custom...)
+	overridden := make(map[string]bool, len(custom))
+	for _, sig := range custom {
+		overridden[sig.Name] = true
+	}
+	for _, sig := range BuiltinSignatures {
+		if !overridden[sig.Name] {
+			signatures = append(signatures, sig)
+		}
+	}
+	return signatures, nil
+}
+
+// compile 校验并编译签名
+func (s Signature) compile() (*compiledSignature, error) {
+	if s.Name == "" || s.Question == "" {
+		return nil, fmt.Errorf("signature requires name and question")
+	}
+	if (s.Option == "") == (len(s.Options) == 0) {
+		return nil, fmt.Errorf("signature %s requires exactly one of option and options", s.Name)
+	}
+
+	c := &compiledSignature{Signature: s}
+	patterns := []struct {
+		expr   string
+		def    string
+		target **regexp.Regexp
+	}{
+		{s.Command, "", &c.command},
+		{s.Question, "", &c.question},
+		{s.Option, "", &c.option},
+		{s.Approve, defaultApprovePattern, &c.approve},
+		{s.Deny, defaultDenyPattern, &c.deny},
+	}
+	for _, p := range patterns {
+		expr := p.expr
+		if expr == "" {
+			expr = p.def
+		}
+		if expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("signature %s: %w", s.Name, err)
+		}
+		*p.target = re
+	}
+	return c, nil
+}
+
+// PendingPrompt 会话中正在等待批准的提示
+type PendingPrompt struct {
+	ID         string    `json:"id"` // 由提示内容生成，用于确认响应的是同一个提示
+	Session    string    `json:"session"`
+	Agent      string    `json:"agent"`
+	Signature  string    `json:"signature"`
+	Question   string    `json:"question"`
+	Context    []string  `json:"context,omitempty"` // 问题上方的内容，如待执行的命令
+	Options    []Option  `json:"options"`
+	DetectedAt time.Time `json:"detected_at"`
+
+	sig *compiledSignature
+}
+
+// borderChars 文本界面边框字符，解析前从行首尾去除
+const borderChars = "│┃║|╭╮╰╯┌┐└┘─━ \t"
+
+// screenLine 屏幕上的一行
+type screenLine struct {
+	raw  string
+	text string // 去除边框后的文字
+}
+
+// splitScreen 将屏幕内容拆分成行并去除边框
+func splitScreen(screen string) []screenLine {
+	rawLines := strings.Split(strings.TrimRight(screen, "\n"), "\n")
+	lines := make([]screenLine, 0, len(rawLines))
+	for _, raw := range rawLines {
+		raw = strings.TrimRight(raw, " \t")
+		lines = append(lines, screenLine{raw: raw, text: strings.Trim(raw, borderChars)})
+	}
+	// 去除末尾空行
+	for len(lines) > 0 && lines[len(lines)-1].text == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// isBoxTop 判断是否为文本框的上边框
+func isBoxTop(raw string) bool {
+	trimmed := strings.TrimSpace(raw)
+	return strings.HasPrefix(trimmed, "╭") || strings.HasPrefix(trimmed, "┌")
+}
+
+// detect 在屏幕内容中按签名识别等待批准的提示，同时返回问题所在的行
+func (c *compiledSignature) detect(lines []screenLine) (*PendingPrompt, int) {
+	// 从底部向上查找问题行
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !c.question.MatchString(lines[i].text) {
+			continue
+		}
+
+		options, last := c.parseOptions(lines, i)
+		if len(options) < 2 {
+			return nil, -1
+		}
+
+		trailing := 0
+		for _, line := range lines[last+1:] {
+			if line.text != "" {
+				trailing++
+			}
+		}
+		// 固定选项的提示（如 y/n）等待输入时问题必然在最后一行
+		if trailing > maxTrailingLines || (c.option == nil && trailing > 0) {
+			return nil, -1
+		}
+
+		return &PendingPrompt{
+			Agent:     c.Agent,
+			Signature: c.Name,
+			Question:  lines[i].text,
+			Context:   contextLines(lines, i),
+			Options:   options,
+			sig:       c,
+		}, i
+	}
+	return nil, -1
+}
+
+// parseOptions 解析问题行之后的选项，返回选项和最后一个选项所在的行
+func (c *compiledSignature) parseOptions(lines []screenLine, question int) ([]Option, int) {
+	if c.option == nil {
+		return append([]Option(nil), c.Options...), question
+	}
+
+	var options []Option
+	last := question
+	for j := question + 1; j < len(lines); j++ {
+		text := lines[j].text
+		if text == "" {
+			if len(options) > 0 {
+				break
+			}
+			continue
+		}
+		m := c.option.FindStringSubmatch(text)
+		if m == nil || len(m) < 3 {
+			if len(options) > 0 {
+				break
+			}
+			continue
+		}
+		options = append(options, Option{
+			Key:      m[1],
+			Label:    strings.TrimSpace(m[2]),
+			Selected: strings.IndexAny(text, "❯›>▶") == 0,
+		})
+		last = j
+	}
+	return options, last
+}
+
+// contextLines 返回问题行上方、同一文本框内的内容
+func contextLines(lines []screenLine, question int) []string {
+	var result []string
+	blanks := 0
+	for j := question - 1; j >= 0 && len(result) < maxContextLines; j-- {
+		if isBoxTop(lines[j].raw) {
+			break
+		}
+		if lines[j].text == "" {
+			blanks++
+			if blanks >= 2 && len(result) > 0 {
+				break
+			}
+			continue
+		}
+		blanks = 0
+		result = append([]string{lines[j].text}, result...)
+	}
+	return result
+}
+
+// promptID 根据提示内容生成稳定的 ID
+func promptID(p *PendingPrompt) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", p.Session, p.Signature, p.Question)
+	for _, line := range p.Context {
+		fmt.Fprintln(h, line)
+	}
+	for _, option := range p.Options {
+		fmt.Fprintf(h, "%s\t%s\n", option.Key, option.Label)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
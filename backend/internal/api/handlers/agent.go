@@ -0,0 +1,136 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/agent"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+// AgentHandler AI 代理提示处理器
+type AgentHandler struct {
+	detector    *agent.Detector
+	tmuxManager *tmux.Manager
+}
+
+// NewAgentHandler 创建 AI 代理提示处理器
+func NewAgentHandler(detector *agent.Detector, tmuxManager *tmux.Manager) *AgentHandler {
+	return &AgentHandler{
+		detector:    detector,
+		tmuxManager: tmuxManager,
+	}
+}
+
+// GetPrompt 立即检查会话屏幕并返回等待批准的提示
+// GET /api/sessions/:name/prompt
+func (h *AgentHandler) GetPrompt(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session":        session.Name,
+		"pending_prompt": h.detector.Refresh(session),
+	})
+}
+
+// PromptResponseRequest 响应提示请求
+type PromptResponseRequest struct {
+	Action   agent.Action `json:"action" binding:"required"` // approve, deny, choose
+	Option   string       `json:"option"`                    // action 为 choose 时的选项按键
+	PromptID string       `json:"prompt_id"`                 // 可选，与当前提示不一致时拒绝响应
+}
+
+// RespondPrompt 批准、拒绝或选择提示中的选项，并向会话发送对应按键
+// POST /api/sessions/:name/prompt
+func (h *AgentHandler) RespondPrompt(c *gin.Context) {
+	var req PromptResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	switch req.Action {
+	case agent.ActionApprove, agent.ActionDeny:
+	case agent.ActionChoose:
+		if req.Option == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "option is required for choose action",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid action, expected one of: approve, deny, choose",
+		})
+		return
+	}
+
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	keys, err := h.detector.Respond(session, req.Action, req.Option, req.PromptID)
+	if err != nil {
+		switch err {
+		case agent.ErrNoPendingPrompt:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "no pending prompt",
+				"code":  "NO_PENDING_PROMPT",
+			})
+		case agent.ErrPromptChanged:
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "prompt has changed",
+				"code":           "PROMPT_CHANGED",
+				"pending_prompt": h.detector.Pending(session.Name),
+			})
+		case agent.ErrUnknownOption:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "option not available in this prompt",
+				"code":  "UNKNOWN_OPTION",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to send keys",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session": session.Name,
+		"action":  req.Action,
+		"keys":    keys,
+	})
+}
+
+// ListSignatures 列出使用中的提示签名
+// GET /api/agent/signatures
+func (h *AgentHandler) ListSignatures(c *gin.Context) {
+	c.JSON(http.StatusOK, h.detector.Signatures())
+}
@@ -20,28 +20,47 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
 	"github.com/xiaoliu10/remote-code/internal/auth"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/users"
 )
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	jwtManager    *auth.JWTManager
-	adminPassword string // 默认管理员密码的哈希
+	jwtManager *auth.JWTManager
+	users      *users.Store
+	events     *events.Bus
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(jwtManager *auth.JWTManager, adminPassword string) *AuthHandler {
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+func NewAuthHandler(jwtManager *auth.JWTManager, userStore *users.Store, bus *events.Bus) *AuthHandler {
 	return &AuthHandler{
-		jwtManager:    jwtManager,
-		adminPassword: string(hashedPassword),
+		jwtManager: jwtManager,
+		users:      userStore,
+		events:     bus,
 	}
 }
 
+// loginFailed 返回登录失败响应并发布登录失败事件
+func (h *AuthHandler) loginFailed(c *gin.Context, username string) {
+	h.events.Publish(events.Event{
+		Type: events.LoginFailed,
+		Data: gin.H{
+			"username":  username,
+			"client_ip": c.ClientIP(),
+		},
+	})
+
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": "invalid username or password",
+	})
+}
+
 // LoginRequest 登录请求
 type LoginRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=32"`
@@ -50,10 +69,12 @@ type LoginRequest struct {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expires_at"`
-	UserID    string `json:"user_id"`
-	Username  string `json:"username"`
+	Token       string `json:"token"`
+	ExpiresAt   int64  `json:"expires_at"`
+	UserID      string `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`
 }
 
 // Login 处理登录请求
@@ -66,24 +87,15 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 简单验证：用户名为 "admin"，密码匹配配置的密码
-	if req.Username != "admin" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "invalid username or password",
-		})
-		return
-	}
-
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(h.adminPassword), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "invalid username or password",
-		})
+	// 验证用户名和密码，停用的账号同样返回登录失败
+	user, err := h.users.Authenticate(req.Username, req.Password)
+	if err != nil {
+		h.loginFailed(c, req.Username)
 		return
 	}
 
-	// 生成 token
-	token, err := h.jwtManager.Generate("admin", req.Username)
+	// 生成 token，携带用户的真实 ID
+	token, err := h.jwtManager.Generate(user.ID, user.Username, user.Role, user.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to generate token",
@@ -93,13 +105,67 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// 返回 token
 	c.JSON(http.StatusOK, LoginResponse{
-		Token:     token,
-		ExpiresAt: 0, // 前端可以从 JWT 解析
-		UserID:    "admin",
-		Username:  req.Username,
+		Token:       token,
+		ExpiresAt:   0, // 前端可以从 JWT 解析
+		UserID:      user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
 	})
 }
 
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 修改当前用户的密码
+// POST /api/auth/password
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request format",
+		})
+		return
+	}
+
+	if err := users.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.users.ChangePassword(middleware.GetUserID(c), req.CurrentPassword, req.NewPassword)
+	switch {
+	case err == nil:
+		// 之前签发的令牌已失效，返回新令牌让当前客户端保持登录
+		token, err := h.jwtManager.Generate(user.ID, user.Username, user.Role, user.TokenVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to generate token",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "password changed", "token": token})
+	case errors.Is(err, users.ErrInvalidCredentials):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "current password is incorrect",
+			"code":  "INVALID_PASSWORD",
+		})
+	case errors.Is(err, users.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to change password",
+		})
+	}
+}
+
 // ValidateToken 验证 token 有效性
 func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	// 如果能到达这里，说明中间件已经验证过了
@@ -110,5 +176,6 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 		"valid":    true,
 		"user_id":  userID,
 		"username": username,
+		"role":     c.GetString("role"),
 	})
 }
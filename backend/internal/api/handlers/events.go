@@ -0,0 +1,274 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/auth"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/websocket"
+)
+
+const (
+	// eventsHeartbeat 事件流心跳间隔，防止代理因空闲断开连接
+	eventsHeartbeat = 15 * time.Second
+	// eventsBuffer 每个事件流订阅者的缓冲区大小
+	eventsBuffer = 256
+)
+
+// EventsHandler 服务端事件流处理器
+type EventsHandler struct {
+	bus      *events.Bus
+	upgrader *gorillaws.Upgrader
+	tickets  *auth.TicketStore
+}
+
+// NewEventsHandler 创建事件流处理器
+func NewEventsHandler(bus *events.Bus, origins *security.OriginPolicy, tickets *auth.TicketStore) *EventsHandler {
+	return &EventsHandler{bus: bus, upgrader: websocket.NewUpgrader(origins.Allowed), tickets: tickets}
+}
+
+// IssueTicket 用 JWT 换取事件流的一次性连接票据，供无法设置请求头的 EventSource 和 WebSocket 使用
+// POST /api/events/ticket
+func (h *EventsHandler) IssueTicket(c *gin.Context) {
+	ticket, err := h.tickets.Issue(middleware.GetClaims(c), auth.ScopeEvents, c.ClientIP())
+	if err != nil {
+		log.Printf("[Events] Failed to issue ticket: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to issue ticket", "code": "TICKET_UNAVAILABLE"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(h.tickets.TTL().Seconds()),
+	})
+}
+
+// eventFilter 按用户权限和事件类型过滤事件
+type eventFilter struct {
+	userID  string
+	isAdmin bool
+	types   map[events.Type]bool
+}
+
+// newEventFilter 从请求中解析事件过滤条件（?types=session.created,session.deleted）
+func newEventFilter(c *gin.Context) eventFilter {
+	filter := eventFilter{
+		userID:  middleware.GetUserID(c),
+		isAdmin: middleware.IsAdmin(c),
+	}
+	if types := c.Query("types"); types != "" {
+		filter.types = make(map[events.Type]bool)
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.types[events.Type(t)] = true
+			}
+		}
+	}
+	return filter
+}
+
+// allow 判断事件是否应发送给当前用户：非管理员只能收到自己会话或自己操作产生的事件
+func (f eventFilter) allow(event events.Event) bool {
+	if f.types != nil && !f.types[event.Type] {
+		return false
+	}
+	if event.Type.AdminOnly() && !f.isAdmin {
+		return false
+	}
+	if (event.Session != "" || event.Owner != "") && !f.isAdmin && event.Owner != f.userID {
+		return false
+	}
+	return true
+}
+
+// lastEventID 读取客户端最后收到的事件序列号（Last-Event-ID 头或 last_event_id 参数）
+func lastEventID(c *gin.Context) uint64 {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	seq, _ := strconv.ParseUint(value, 10, 64)
+	return seq
+}
+
+// StreamSSE 以 Server-Sent Events 推送事件
+// GET /api/events
+func (h *EventsHandler) StreamSSE(c *gin.Context) {
+	filter := newEventFilter(c)
+	backlog, ch, complete, cancel := h.bus.SubscribeFrom(lastEventID(c), eventsBuffer)
+	defer cancel()
+
+	// 事件流是长连接，取消服务器的写超时
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[Events] Failed to clear write deadline: %v", err)
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // 禁用 nginx 缓冲
+	c.Status(http.StatusOK)
+
+	// 告知客户端当前序列号，遗漏的事件已无法补发时要求客户端全量刷新
+	fmt.Fprintf(c.Writer, "retry: 3000\n\n")
+	if !complete {
+		writeSSE(c, 0, "resync", gin.H{"last_seq": h.bus.LastSeq()})
+	}
+	for _, event := range backlog {
+		if filter.allow(event) {
+			writeSSE(c, event.Seq, string(event.Type), event)
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !filter.allow(event) {
+				continue
+			}
+			if err := writeSSE(c, event.Seq, string(event.Type), event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprintf(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE 写入一条 SSE 消息，id 为 0 时不写 id 字段
+func writeSSE(c *gin.Context, id uint64, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// StreamWebSocket 通过 WebSocket 推送事件，每条消息为一个 JSON 事件
+// GET /api/events/ws
+func (h *EventsHandler) StreamWebSocket(c *gin.Context) {
+	filter := newEventFilter(c)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[Events] Failed to upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	backlog, ch, complete, cancel := h.bus.SubscribeFrom(lastEventID(c), eventsBuffer)
+	defer cancel()
+
+	// 读取协程：处理 pong 并检测连接关闭，客户端发送的消息被忽略
+	closed := make(chan struct{})
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(2 * eventsHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(2 * eventsHeartbeat))
+		return nil
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(v)
+	}
+
+	if !complete {
+		if err := write(gin.H{"type": "resync", "data": gin.H{"last_seq": h.bus.LastSeq()}}); err != nil {
+			return
+		}
+	}
+	for _, event := range backlog {
+		if filter.allow(event) {
+			if err := write(event); err != nil {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !filter.allow(event) {
+				continue
+			}
+			if err := write(event); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(gorillaws.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-closed:
+			return
+		}
+	}
+}
@@ -32,6 +32,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/events"
 )
 
 const (
@@ -152,15 +154,30 @@ func (v *PathValidator) GetAllowedDir() string {
 // FileHandler 文件操作处理器
 type FileHandler struct {
 	validator *PathValidator
+	events    *events.Bus
 }
 
 // NewFileHandler 创建文件处理器
-func NewFileHandler(validator *PathValidator) *FileHandler {
+func NewFileHandler(validator *PathValidator, bus *events.Bus) *FileHandler {
 	return &FileHandler{
 		validator: validator,
+		events:    bus,
 	}
 }
 
+// publishChange 发布文件变更事件，路径为相对于允许目录的路径
+func (h *FileHandler) publishChange(c *gin.Context, action string, data gin.H) {
+	data["action"] = action
+	userID := middleware.GetUserID(c)
+	data["user_id"] = userID
+	// 路径只发给操作者本人和管理员
+	h.events.Publish(events.Event{
+		Type:  events.FileChanged,
+		Owner: userID,
+		Data:  data,
+	})
+}
+
 // FileInfo 文件信息结构
 type FileInfo struct {
 	Name       string    `json:"name"`
@@ -475,6 +492,8 @@ func (h *FileHandler) CreateFileFolder(c *gin.Context) {
 	info, _ := os.Stat(validPath)
 	relPath, _ := filepath.Rel(h.validator.GetAllowedDir(), validPath)
 
+	h.publishChange(c, "created", gin.H{"path": normalizePath(relPath), "type": req.Type})
+
 	c.JSON(http.StatusCreated, FileInfo{
 		Name:       filepath.Base(validPath),
 		Path:       normalizePath(relPath),
@@ -564,6 +583,9 @@ func (h *FileHandler) RenameFileFolder(c *gin.Context) {
 	// 返回重命名后的资源信息
 	info, _ := os.Stat(newPath)
 	relPath, _ := filepath.Rel(h.validator.GetAllowedDir(), newPath)
+	oldRelPath, _ := filepath.Rel(h.validator.GetAllowedDir(), oldPath)
+
+	h.publishChange(c, "renamed", gin.H{"path": normalizePath(relPath), "old_path": normalizePath(oldRelPath)})
 
 	c.JSON(http.StatusOK, FileInfo{
 		Name:       filepath.Base(newPath),
@@ -640,6 +662,9 @@ func (h *FileHandler) DeleteFileFolder(c *gin.Context) {
 		}
 	}
 
+	relPath, _ := filepath.Rel(h.validator.GetAllowedDir(), validPath)
+	h.publishChange(c, "deleted", gin.H{"path": normalizePath(relPath), "type": getFileType(info)})
+
 	c.Status(http.StatusNoContent)
 }
 
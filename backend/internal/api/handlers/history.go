@@ -0,0 +1,128 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/history"
+)
+
+// defaultHistoryLimit 未指定 limit 时返回的条数
+const defaultHistoryLimit = 100
+
+// recordCommand 记录已发送到会话的命令，失败只记录日志，不影响命令本身
+func recordCommand(store *history.Store, entry history.Entry) history.Entry {
+	entry, err := store.Record(entry)
+	if err != nil {
+		log.Printf("[History] Failed to record command for session %s: %v", entry.Session, err)
+	}
+	return entry
+}
+
+// HistoryQuery 命令历史查询参数
+type HistoryQuery struct {
+	Query  string    `form:"q"`
+	UserID string    `form:"user"`
+	Source string    `form:"source"`
+	Since  time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Before string    `form:"before"` // 分页游标，上一页最后一条记录的 ID
+	Limit  int       `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// GetHistory 查询会话的命令历史（新的在前）
+// GET /api/sessions/:name/history?q=&user=&source=&since=&until=&before=&limit=
+func (h *SessionHandler) GetHistory(c *gin.Context) {
+	var req HistoryQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid query parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultHistoryLimit
+	}
+
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	entries, hasMore := h.history.Query(session.Name, history.Filter{
+		Query:  req.Query,
+		UserID: req.UserID,
+		Source: history.Source(req.Source),
+		Since:  req.Since,
+		Until:  req.Until,
+		Before: req.Before,
+		Limit:  req.Limit,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":  entries,
+		"has_more": hasMore,
+	})
+}
+
+// RerunCommand 重新发送历史中的命令，命令会按当前规则重新校验
+// POST /api/sessions/:name/history/:id/rerun
+func (h *SessionHandler) RerunCommand(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	entry, err := h.history.Get(session.Name, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "history entry not found",
+		})
+		return
+	}
+
+	if err := h.validator.SanitizeCommand(entry.Command); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := session.SendCommand(entry.Command); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to send command",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, recordCommand(h.history, history.Entry{
+		Session: session.Name,
+		Command: entry.Command,
+		UserID:  middleware.GetUserID(c),
+		Source:  history.SourceREST,
+		Ref:     entry.ID,
+	}))
+}
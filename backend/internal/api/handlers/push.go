@@ -0,0 +1,184 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/push"
+)
+
+// PushHandler Web Push 通知处理器
+type PushHandler struct {
+	notifier *push.Notifier // 为 nil 表示未启用推送
+}
+
+// NewPushHandler 创建 Web Push 通知处理器
+func NewPushHandler(notifier *push.Notifier) *PushHandler {
+	return &PushHandler{notifier: notifier}
+}
+
+// UnsubscribeRequest 取消订阅请求
+type UnsubscribeRequest struct {
+	Endpoint string `json:"endpoint" binding:"required"`
+}
+
+// requireEnabled 检查推送是否启用，失败时已写入响应
+func (h *PushHandler) requireEnabled(c *gin.Context) bool {
+	if h.notifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "push notifications are disabled",
+			"code":  "PUSH_DISABLED",
+		})
+		return false
+	}
+	return true
+}
+
+// GetPublicKey 获取浏览器订阅时使用的 VAPID 公钥
+// GET /api/push/vapid-public-key
+func (h *PushHandler) GetPublicKey(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"public_key": h.notifier.PublicKey(),
+	})
+}
+
+// ListSubscriptions 列出当前用户的订阅
+// GET /api/push/subscriptions
+func (h *PushHandler) ListSubscriptions(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.notifier.Store().Subscriptions(middleware.GetUserID(c)))
+}
+
+// Subscribe 保存浏览器的推送订阅（PushSubscription.toJSON() 的内容）
+// POST /api/push/subscriptions
+func (h *PushHandler) Subscribe(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	var sub push.Subscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+	sub.UserID = middleware.GetUserID(c)
+	sub.UserAgent = c.Request.UserAgent()
+
+	sub, err := h.notifier.Store().Subscribe(sub)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, push.ErrTooManySubscriptions) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+// Unsubscribe 删除当前用户的推送订阅
+// DELETE /api/push/subscriptions
+func (h *PushHandler) Unsubscribe(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	var req UnsubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request format",
+		})
+		return
+	}
+
+	if err := h.notifier.Store().Unsubscribe(req.Endpoint, middleware.GetUserID(c)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "subscription not found",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPreferences 获取当前用户的通知偏好
+// GET /api/push/preferences
+func (h *PushHandler) GetPreferences(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.notifier.Store().Preferences(middleware.GetUserID(c)))
+}
+
+// UpdatePreferences 更新当前用户的通知偏好，未提供的字段保持不变
+// PUT /api/push/preferences
+func (h *PushHandler) UpdatePreferences(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	prefs := h.notifier.Store().Preferences(userID)
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request format",
+		})
+		return
+	}
+
+	if err := h.notifier.Store().SetPreferences(userID, prefs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// TestPush 向当前用户的所有订阅发送测试通知
+// POST /api/push/test
+func (h *PushHandler) TestPush(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": h.notifier.Test(middleware.GetUserID(c)),
+	})
+}
@@ -0,0 +1,271 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/scheduler"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+// ScheduleHandler 定时命令处理器
+type ScheduleHandler struct {
+	scheduler   *scheduler.Scheduler
+	tmuxManager *tmux.Manager
+	validator   *security.SessionValidator
+}
+
+// NewScheduleHandler 创建定时命令处理器
+func NewScheduleHandler(s *scheduler.Scheduler, tmuxManager *tmux.Manager, validator *security.SessionValidator) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduler:   s,
+		tmuxManager: tmuxManager,
+		validator:   validator,
+	}
+}
+
+// ScheduleRequest 创建/更新定时任务请求
+type ScheduleRequest struct {
+	Name           string     `json:"name" binding:"required"`
+	Session        string     `json:"session" binding:"required"`
+	Command        string     `json:"command" binding:"required"`
+	Cron           string     `json:"cron"`   // 周期任务的 cron 表达式
+	RunAt          *time.Time `json:"run_at"` // 一次性任务的执行时间（RFC 3339）
+	Timezone       string     `json:"timezone"`
+	CaptureSeconds int        `json:"capture_seconds"`
+	Enabled        *bool      `json:"enabled"` // 默认启用
+}
+
+// accessible 判断当前用户能否查看和修改任务
+func (h *ScheduleHandler) accessible(c *gin.Context, job scheduler.Job) bool {
+	return middleware.IsAdmin(c) || (job.OwnerID != "" && job.OwnerID == middleware.GetUserID(c))
+}
+
+// lookupJob 获取当前用户可访问的任务，失败时已写入响应
+func (h *ScheduleHandler) lookupJob(c *gin.Context) (scheduler.Job, bool) {
+	job, err := h.scheduler.Store().Get(c.Param("id"))
+	if err != nil || !h.accessible(c, job) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "schedule not found",
+		})
+		return scheduler.Job{}, false
+	}
+	return job, true
+}
+
+// bindJob 解析并校验请求，失败时已写入响应
+func (h *ScheduleHandler) bindJob(c *gin.Context) (scheduler.Job, bool) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return scheduler.Job{}, false
+	}
+
+	if _, ok := lookupSession(c, h.tmuxManager, req.Session); !ok {
+		return scheduler.Job{}, false
+	}
+
+	// 命令与会话的其他输入使用相同的校验
+	if err := h.validator.SanitizeCommand(req.Command); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return scheduler.Job{}, false
+	}
+
+	job := scheduler.Job{
+		Name:           req.Name,
+		Session:        req.Session,
+		Command:        req.Command,
+		Cron:           req.Cron,
+		RunAt:          req.RunAt,
+		Timezone:       req.Timezone,
+		CaptureSeconds: req.CaptureSeconds,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		OwnerID:        middleware.GetUserID(c),
+	}
+	if err := job.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return scheduler.Job{}, false
+	}
+	return job, true
+}
+
+// saveJob 保存任务并唤醒调度器
+func (h *ScheduleHandler) saveJob(c *gin.Context, job scheduler.Job, status int) {
+	job, err := h.scheduler.Store().Put(job)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save schedule",
+		})
+		return
+	}
+	h.scheduler.Refresh()
+
+	c.JSON(status, job)
+}
+
+// ListSchedules 列出定时任务
+// GET /api/schedules?session=name
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	session := c.Query("session")
+
+	response := make([]scheduler.Job, 0)
+	for _, job := range h.scheduler.Store().List() {
+		if !h.accessible(c, job) {
+			continue
+		}
+		if session != "" && job.Session != session {
+			continue
+		}
+		response = append(response, job)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateSchedule 创建定时任务
+// POST /api/schedules
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	job, ok := h.bindJob(c)
+	if !ok {
+		return
+	}
+
+	h.saveJob(c, job, http.StatusCreated)
+}
+
+// GetSchedule 获取定时任务
+// GET /api/schedules/:id
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	job, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// UpdateSchedule 替换定时任务内容
+// PUT /api/schedules/:id
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	existing, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	job, ok := h.bindJob(c)
+	if !ok {
+		return
+	}
+	job.ID = existing.ID
+
+	h.saveJob(c, job, http.StatusOK)
+}
+
+// DeleteSchedule 删除定时任务及其执行记录
+// DELETE /api/schedules/:id
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	job, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduler.Store().Delete(job.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete schedule",
+		})
+		return
+	}
+	h.scheduler.Refresh()
+
+	c.Status(http.StatusNoContent)
+}
+
+// EnableSchedule 启用定时任务
+// POST /api/schedules/:id/enable
+func (h *ScheduleHandler) EnableSchedule(c *gin.Context) {
+	h.setEnabled(c, true)
+}
+
+// DisableSchedule 禁用定时任务
+// POST /api/schedules/:id/disable
+func (h *ScheduleHandler) DisableSchedule(c *gin.Context) {
+	h.setEnabled(c, false)
+}
+
+// setEnabled 修改任务的启用状态
+func (h *ScheduleHandler) setEnabled(c *gin.Context, enabled bool) {
+	job, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.scheduler.Store().SetEnabled(job.ID, enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save schedule",
+		})
+		return
+	}
+	h.scheduler.Refresh()
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RunSchedule 立即执行定时任务，不影响计划的下一次执行时间
+// POST /api/schedules/:id/run
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	job, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.scheduler.RunNow(job.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "schedule not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListScheduleRuns 列出定时任务的执行记录（新的在前）
+// GET /api/schedules/:id/runs
+func (h *ScheduleHandler) ListScheduleRuns(c *gin.Context) {
+	job, ok := h.lookupJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.scheduler.Store().Runs(job.ID))
+}
@@ -0,0 +1,260 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/terminal"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+// maxScreenScrollback 屏幕状态接口单次最多返回的历史行数
+const maxScreenScrollback = 5000
+
+// ScreenHandler 服务端终端屏幕模型和截图处理器
+type ScreenHandler struct {
+	tracker     *terminal.Tracker
+	renderer    *terminal.Renderer
+	tmuxManager *tmux.Manager
+}
+
+// NewScreenHandler 创建终端屏幕模型和截图处理器
+func NewScreenHandler(tracker *terminal.Tracker, renderer *terminal.Renderer, tmuxManager *tmux.Manager) *ScreenHandler {
+	return &ScreenHandler{
+		tracker:     tracker,
+		renderer:    renderer,
+		tmuxManager: tmuxManager,
+	}
+}
+
+// lookupScreen 获取当前用户可访问的会话的屏幕模型，失败时已写入响应
+func (h *ScreenHandler) lookupScreen(c *gin.Context) (*tmux.Session, *terminal.Screen, bool) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return nil, nil, false
+	}
+
+	screen, err := h.tracker.Screen(session)
+	if err != nil {
+		log.Printf("[Terminal] Failed to load screen of session %s: %v", session.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to load screen",
+			"code":  "SCREEN_UNAVAILABLE",
+		})
+		return nil, nil, false
+	}
+	return session, screen, true
+}
+
+// GetScreen 返回会话的屏幕状态（单元格、属性、光标）。
+// since 为上次返回的 seq，只返回之后变化的行；scrollback 为附带的历史行数；
+// format=text 时只返回各行纯文本
+// GET /api/sessions/:name/screen
+func (h *ScreenHandler) GetScreen(c *gin.Context) {
+	session, screen, ok := h.lookupScreen(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") == "text" {
+		c.JSON(http.StatusOK, gin.H{
+			"session": session.Name,
+			"lines":   screen.Text(),
+		})
+		return
+	}
+
+	var since uint64
+	if value := c.Query("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since must be a non-negative integer",
+				"code":  "INVALID_SINCE",
+			})
+			return
+		}
+		since = parsed
+	}
+
+	scrollback := 0
+	if value := c.Query("scrollback"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "scrollback must be a non-negative integer",
+				"code":  "INVALID_SCROLLBACK",
+			})
+			return
+		}
+		scrollback = min(parsed, maxScreenScrollback)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session": session.Name,
+		"screen":  screen.State(since, scrollback),
+	})
+}
+
+// SearchScreen 在屏幕和历史中搜索文本，最新的匹配在前
+// GET /api/sessions/:name/screen/search?q=
+func (h *ScreenHandler) SearchScreen(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "q is required",
+			"code":  "INVALID_QUERY",
+		})
+		return
+	}
+
+	session, screen, ok := h.lookupScreen(c)
+	if !ok {
+		return
+	}
+
+	ignoreCase := c.Query("ignore_case") == "true" || c.Query("ignore_case") == "1"
+	c.JSON(http.StatusOK, gin.H{
+		"session": session.Name,
+		"matches": screen.Search(query, ignoreCase),
+	})
+}
+
+// GetScreenshot 把会话的可见屏幕或一段历史渲染为 PNG、SVG 或 HTML。
+// from、to 为行号（0 为屏幕第一行，历史行为负数），默认为整个可见屏幕；
+// theme、font_size 覆盖默认配色和字号；cursor=false 不绘制光标；download=1 作为附件下载
+// GET /api/sessions/:name/screenshot
+func (h *ScreenHandler) GetScreenshot(c *gin.Context) {
+	format := terminal.Format(c.DefaultQuery("format", string(terminal.FormatPNG)))
+	if format.ContentType() == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be png, svg or html",
+			"code":  "INVALID_FORMAT",
+		})
+		return
+	}
+
+	fontSize, err := queryInt(c, "font_size", 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "font_size must be an integer",
+			"code":  "INVALID_FONT_SIZE",
+		})
+		return
+	}
+	opts, err := h.renderer.Options(c.Query("theme"), fontSize)
+	if errors.Is(err, terminal.ErrUnknownTheme) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unknown theme",
+			"code":  "UNKNOWN_THEME",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_FONT_SIZE",
+		})
+		return
+	}
+	opts.Cursor = c.Query("cursor") != "false" && c.Query("cursor") != "0"
+
+	session, screen, ok := h.lookupScreen(c)
+	if !ok {
+		return
+	}
+
+	_, rows := screen.Size()
+	from, errFrom := queryInt(c, "from", 0)
+	to, errTo := queryInt(c, "to", rows-1)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "from and to must be integers",
+			"code":  "INVALID_RANGE",
+		})
+		return
+	}
+	snap, err := screen.Snapshot(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("rows must be within the screen and scrollback, at most %d at a time", terminal.MaxSnapshotRows),
+			"code":  "INVALID_RANGE",
+		})
+		return
+	}
+	if snap.Title == "" {
+		snap.Title = session.Name
+	}
+
+	var buf bytes.Buffer
+	if err := h.renderer.Render(&buf, format, snap, opts); err != nil {
+		if errors.Is(err, terminal.ErrImageTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "image too large, request fewer rows or a smaller font",
+				"code":  "IMAGE_TOO_LARGE",
+			})
+			return
+		}
+		log.Printf("[Terminal] Failed to render screenshot of session %s: %v", session.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to render screenshot",
+		})
+		return
+	}
+
+	disposition := "inline"
+	if c.Query("download") == "1" || c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", session.Name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
+}
+
+// ListThemes 返回可用的截图配色和默认选项
+// GET /api/screenshot/themes
+func (h *ScreenHandler) ListThemes(c *gin.Context) {
+	defaults := h.renderer.Defaults()
+	c.JSON(http.StatusOK, gin.H{
+		"themes":      h.renderer.Themes(),
+		"default":     defaults.Theme,
+		"font_size":   defaults.FontSize,
+		"font_family": defaults.FontFamily,
+	})
+}
+
+// queryInt 读取整数查询参数，未提供时返回 def
+func queryInt(c *gin.Context, key string, def int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
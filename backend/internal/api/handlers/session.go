@@ -20,10 +20,16 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/agent"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/history"
 	"github.com/xiaoliu10/remote-code/internal/security"
 	"github.com/xiaoliu10/remote-code/internal/tmux"
 )
@@ -32,29 +38,83 @@ import (
 type SessionHandler struct {
 	tmuxManager *tmux.Manager
 	validator   *security.SessionValidator
+	detector    *agent.Detector
+	history     *history.Store
 }
 
 // NewSessionHandler 创建会话处理器
-func NewSessionHandler(tmuxManager *tmux.Manager, validator *security.SessionValidator) *SessionHandler {
+func NewSessionHandler(tmuxManager *tmux.Manager, validator *security.SessionValidator, detector *agent.Detector, historyStore *history.Store) *SessionHandler {
 	return &SessionHandler{
 		tmuxManager: tmuxManager,
 		validator:   validator,
+		detector:    detector,
+		history:     historyStore,
 	}
 }
 
 // CreateSessionRequest 创建会话请求
 type CreateSessionRequest struct {
-	Name    string `json:"name" binding:"required,min=1,max=32"`
-	WorkDir string `json:"work_dir"`
+	Name           string            `json:"name" binding:"required,min=1,max=32"`
+	WorkDir        string            `json:"work_dir"`
+	DisplayName    string            `json:"display_name"`
+	Description    string            `json:"description"`
+	Labels         map[string]string `json:"labels"`
+	Pinned         bool              `json:"pinned"`
+	StartupCommand string            `json:"startup_command"` // 创建及恢复后自动执行的命令
 }
 
 // SessionResponse 会话响应
 type SessionResponse struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	WorkDir   string `json:"work_dir"`
-	CreatedAt string `json:"created_at"`
-	IsActive  bool   `json:"is_active"`
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	WorkDir        string               `json:"work_dir"`
+	CreatedAt      string               `json:"created_at"`
+	IsActive       bool                 `json:"is_active"`
+	OwnerID        string               `json:"owner_id"`
+	DisplayName    string               `json:"display_name"`
+	Description    string               `json:"description"`
+	Labels         map[string]string    `json:"labels"`
+	Pinned         bool                 `json:"pinned"`
+	StartupCommand string               `json:"startup_command"` // 创建及恢复后自动执行的命令
+	UnreadAlerts   int                  `json:"unread_alerts"`   // 未确认的响铃/活动/静默提醒次数
+	PendingPrompt  *agent.PendingPrompt `json:"pending_prompt"`  // AI 代理等待批准的提示，没有时为 null
+}
+
+// newSessionResponse 构造会话响应
+func (h *SessionHandler) newSessionResponse(session *tmux.Session, isActive bool) SessionResponse {
+	info := session.Info()
+	labels := info.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return SessionResponse{
+		ID:             session.ID,
+		Name:           session.Name,
+		WorkDir:        session.WorkDir,
+		CreatedAt:      session.CreatedAt.Format(time.RFC3339),
+		IsActive:       isActive,
+		OwnerID:        session.OwnerID,
+		DisplayName:    info.DisplayName,
+		Description:    info.Description,
+		Labels:         labels,
+		Pinned:         info.Pinned,
+		StartupCommand: session.StartupCommand(),
+		UnreadAlerts:   h.tmuxManager.UnreadAlertCount(session.Name),
+		PendingPrompt:  h.detector.Pending(session.Name),
+	}
+}
+
+// lookupSession 获取当前用户可访问的会话，失败时已写入响应
+// 不属于当前用户的会话按不存在处理，避免泄露其他用户的会话名称
+func lookupSession(c *gin.Context, manager *tmux.Manager, name string) (*tmux.Session, bool) {
+	session, err := manager.GetAccessibleSession(name, middleware.GetUserID(c), middleware.IsAdmin(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "session not found",
+		})
+		return nil, false
+	}
+	return session, true
 }
 
 // CreateSession 创建新会话
@@ -86,8 +146,36 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		}
 	}
 
+	// 验证描述信息
+	if err := h.validateInfo(req.DisplayName, req.Description, req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 验证启动命令
+	if req.StartupCommand != "" {
+		if err := h.validator.SanitizeCommand(req.StartupCommand); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
 	// 创建会话
-	session, err := h.tmuxManager.CreateSession(req.Name, req.WorkDir)
+	session, err := h.tmuxManager.CreateSession(req.Name, tmux.CreateOptions{
+		WorkDir:        req.WorkDir,
+		OwnerID:        middleware.GetUserID(c),
+		StartupCommand: req.StartupCommand,
+		Info: tmux.SessionInfo{
+			DisplayName: req.DisplayName,
+			Description: req.Description,
+			Labels:      req.Labels,
+			Pinned:      req.Pinned,
+		},
+	})
 	if err != nil {
 		if err == tmux.ErrSessionExists {
 			c.JSON(http.StatusConflict, gin.H{
@@ -95,64 +183,178 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 			})
 			return
 		}
+		if err == tmux.ErrQuotaExceeded {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "session quota exceeded",
+				"code":  "SESSION_QUOTA_EXCEEDED",
+				"limit": h.tmuxManager.MaxSessionsPerUser(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to create session",
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, SessionResponse{
-		ID:        session.ID,
-		Name:      session.Name,
-		WorkDir:   session.WorkDir,
-		CreatedAt: session.CreatedAt.Format(time.RFC3339),
-		IsActive:  true,
-	})
+	c.JSON(http.StatusCreated, h.newSessionResponse(session, true))
+}
+
+// validateInfo 验证会话描述信息
+func (h *SessionHandler) validateInfo(displayName, description string, labels map[string]string) error {
+	if err := h.validator.ValidateDisplayName(displayName); err != nil {
+		return err
+	}
+	if err := h.validator.ValidateDescription(description); err != nil {
+		return err
+	}
+	return h.validator.ValidateLabels(labels)
 }
 
 // ListSessions 列出所有会话
+// GET /api/sessions?label=env:prod&label=team&q=build&sort=created_at&order=desc
 func (h *SessionHandler) ListSessions(c *gin.Context) {
-	sessions := h.tmuxManager.ListSessions()
+	opts := tmux.ListOptions{
+		Query:  c.Query("q"),
+		SortBy: c.DefaultQuery("sort", tmux.SortByName),
+		Desc:   c.Query("order") == "desc",
+	}
+
+	// 非管理员只能看到自己的会话
+	if !middleware.IsAdmin(c) {
+		opts.OwnerID = middleware.GetUserID(c)
+		if opts.OwnerID == "" {
+			c.JSON(http.StatusOK, []SessionResponse{})
+			return
+		}
+	}
+
+	switch opts.SortBy {
+	case tmux.SortByName, tmux.SortByDisplayName, tmux.SortByCreatedAt:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid sort field, expected one of: name, display_name, created_at",
+		})
+		return
+	}
+
+	// 标签过滤：label=key 或 label=key:value
+	for _, filter := range c.QueryArray("label") {
+		key, value, _ := strings.Cut(filter, ":")
+		if err := h.validator.ValidateLabelKey(key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if opts.Labels == nil {
+			opts.Labels = make(map[string]string)
+		}
+		opts.Labels[key] = value
+	}
+
+	sessions := h.tmuxManager.QuerySessions(opts)
 
 	response := make([]SessionResponse, 0, len(sessions))
 	for _, s := range sessions {
-		response = append(response, SessionResponse{
-			ID:        s.ID,
-			Name:      s.Name,
-			WorkDir:   s.WorkDir,
-			CreatedAt: s.CreatedAt.Format(time.RFC3339),
-			IsActive:  s.IsActive(),
-		})
+		response = append(response, h.newSessionResponse(s, s.IsActive()))
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// GetSession 获取指定会话信息
-func (h *SessionHandler) GetSession(c *gin.Context) {
+// UpdateSessionRequest 更新会话描述信息请求，未提供的字段保持不变
+type UpdateSessionRequest struct {
+	DisplayName    *string            `json:"display_name"`
+	Description    *string            `json:"description"`
+	Labels         map[string]*string `json:"labels"` // 值为 null 表示删除该标签
+	Pinned         *bool              `json:"pinned"`
+	StartupCommand *string            `json:"startup_command"` // 空字符串表示清除启动命令
+}
+
+// UpdateSession 更新会话描述信息
+// PATCH /api/sessions/:name
+func (h *SessionHandler) UpdateSession(c *gin.Context) {
 	name := c.Param("name")
 
-	session, err := h.tmuxManager.GetSession(name)
-	if err != nil {
+	var req UpdateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	current, ok := lookupSession(c, h.tmuxManager, name)
+	if !ok {
+		return
+	}
+
+	// 先校验请求本身，合并后的结果在会话锁内整体校验，确保标签数量等限制对最终结果生效
+	for key := range req.Labels {
+		if err := h.validator.ValidateLabelKey(key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	if req.StartupCommand != nil && *req.StartupCommand != "" {
+		if err := h.validator.SanitizeCommand(*req.StartupCommand); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	session, err := h.tmuxManager.UpdateSessionInfo(current.Name, tmux.SessionInfoUpdate{
+		DisplayName:    req.DisplayName,
+		Description:    req.Description,
+		Labels:         req.Labels,
+		Pinned:         req.Pinned,
+		StartupCommand: req.StartupCommand,
+		Validate: func(info tmux.SessionInfo) error {
+			return h.validateInfo(info.DisplayName, info.Description, info.Labels)
+		},
+	})
+	if errors.Is(err, tmux.ErrSessionNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "session not found",
 		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, SessionResponse{
-		ID:        session.ID,
-		Name:      session.Name,
-		WorkDir:   session.WorkDir,
-		CreatedAt: session.CreatedAt.Format(time.RFC3339),
-		IsActive:  session.IsActive(),
-	})
+	c.JSON(http.StatusOK, h.newSessionResponse(session, session.IsActive()))
+}
+
+// GetSession 获取指定会话信息
+func (h *SessionHandler) GetSession(c *gin.Context) {
+	name := c.Param("name")
+
+	session, ok := lookupSession(c, h.tmuxManager, name)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newSessionResponse(session, session.IsActive()))
 }
 
 // DeleteSession 删除会话
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
 	name := c.Param("name")
 
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
 	if err := h.tmuxManager.DeleteSession(name); err != nil {
 		if err == tmux.ErrSessionNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -173,11 +375,8 @@ func (h *SessionHandler) DeleteSession(c *gin.Context) {
 func (h *SessionHandler) GetSessionOutput(c *gin.Context) {
 	name := c.Param("name")
 
-	session, err := h.tmuxManager.GetSession(name)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "session not found",
-		})
+	session, ok := lookupSession(c, h.tmuxManager, name)
+	if !ok {
 		return
 	}
 
@@ -219,11 +418,8 @@ func (h *SessionHandler) SendCommand(c *gin.Context) {
 		return
 	}
 
-	session, err := h.tmuxManager.GetSession(name)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "session not found",
-		})
+	session, ok := lookupSession(c, h.tmuxManager, name)
+	if !ok {
 		return
 	}
 
@@ -233,6 +429,12 @@ func (h *SessionHandler) SendCommand(c *gin.Context) {
 		})
 		return
 	}
+	recordCommand(h.history, history.Entry{
+		Session: session.Name,
+		Command: req.Command,
+		UserID:  middleware.GetUserID(c),
+		Source:  history.SourceREST,
+	})
 
 	c.Status(http.StatusOK)
 }
@@ -251,11 +453,8 @@ func (h *SessionHandler) StreamOutput(c *gin.Context) {
 		req.Lines = 100 // 默认 100 行
 	}
 
-	session, err := h.tmuxManager.GetSession(name)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "session not found",
-		})
+	session, ok := lookupSession(c, h.tmuxManager, name)
+	if !ok {
 		return
 	}
 
@@ -271,3 +470,186 @@ func (h *SessionHandler) StreamOutput(c *gin.Context) {
 		"lines": lines,
 	})
 }
+
+// SnapshotSession 立即为会话生成快照（布局、当前目录和历史输出）
+// POST /api/sessions/:name/snapshot
+func (h *SessionHandler) SnapshotSession(c *gin.Context) {
+	name := c.Param("name")
+
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
+	snap, err := h.tmuxManager.SnapshotSession(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to snapshot session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
+
+// GetSnapshot 获取会话最近一次的快照
+// GET /api/sessions/:name/snapshot
+func (h *SessionHandler) GetSnapshot(c *gin.Context) {
+	name := c.Param("name")
+
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
+	snap, err := h.tmuxManager.GetSnapshot(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to load snapshot",
+		})
+		return
+	}
+	if snap == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "snapshot not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
+
+// RenameSessionRequest 重命名会话请求
+type RenameSessionRequest struct {
+	NewName string `json:"new_name" binding:"required,min=1,max=32"`
+}
+
+// RenameSession 重命名会话
+// POST /api/sessions/:name/rename
+func (h *SessionHandler) RenameSession(c *gin.Context) {
+	name := c.Param("name")
+
+	var req RenameSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.validator.ValidateSessionName(req.NewName); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
+	session, err := h.tmuxManager.RenameSession(name, req.NewName)
+	if err != nil {
+		switch err {
+		case tmux.ErrSessionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "session not found",
+			})
+		case tmux.ErrSessionExists:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "session already exists",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to rename session",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newSessionResponse(session, session.IsActive()))
+}
+
+// ListAlerts 列出当前用户可见的所有会话的未读提醒，最近的在前
+// GET /api/alerts
+func (h *SessionHandler) ListAlerts(c *gin.Context) {
+	opts := tmux.ListOptions{SortBy: tmux.SortByName}
+	if !middleware.IsAdmin(c) {
+		opts.OwnerID = middleware.GetUserID(c)
+		if opts.OwnerID == "" {
+			c.JSON(http.StatusOK, gin.H{"alerts": []tmux.Alert{}, "unread": 0})
+			return
+		}
+	}
+
+	alerts := make([]tmux.Alert, 0)
+	unread := 0
+	for _, s := range h.tmuxManager.QuerySessions(opts) {
+		for _, alert := range h.tmuxManager.Alerts(s.Name) {
+			alerts = append(alerts, alert)
+			unread += alert.Count
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].LastAt.After(alerts[j].LastAt)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"unread": unread,
+	})
+}
+
+// GetSessionAlerts 获取会话的未读提醒
+// GET /api/sessions/:name/alerts
+func (h *SessionHandler) GetSessionAlerts(c *gin.Context) {
+	name := c.Param("name")
+
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session": name,
+		"alerts":  h.tmuxManager.Alerts(name),
+		"unread":  h.tmuxManager.UnreadAlertCount(name),
+	})
+}
+
+// AckAlertsRequest 确认提醒请求，ids 为空表示确认会话的全部提醒
+type AckAlertsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// AckSessionAlerts 确认会话的提醒
+// POST /api/sessions/:name/alerts/ack
+func (h *SessionHandler) AckSessionAlerts(c *gin.Context) {
+	name := c.Param("name")
+
+	var req AckAlertsRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid request format",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	if _, ok := lookupSession(c, h.tmuxManager, name); !ok {
+		return
+	}
+
+	acked, err := h.tmuxManager.AcknowledgeAlerts(name, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "session not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"acknowledged": len(acked),
+		"unread":       h.tmuxManager.UnreadAlertCount(name),
+	})
+}
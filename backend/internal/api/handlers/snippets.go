@@ -0,0 +1,388 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/snippets"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+// snippetExportVersion 导出文件的格式版本
+const snippetExportVersion = 1
+
+// SnippetHandler 命令片段处理器
+type SnippetHandler struct {
+	store       *snippets.Store
+	tmuxManager *tmux.Manager
+	validator   *security.SessionValidator
+	history     *history.Store
+}
+
+// NewSnippetHandler 创建命令片段处理器
+func NewSnippetHandler(store *snippets.Store, tmuxManager *tmux.Manager, validator *security.SessionValidator, historyStore *history.Store) *SnippetHandler {
+	return &SnippetHandler{
+		store:       store,
+		tmuxManager: tmuxManager,
+		validator:   validator,
+		history:     historyStore,
+	}
+}
+
+// SnippetRequest 创建/更新片段请求
+type SnippetRequest struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Command     string         `json:"command" binding:"required"`
+	Scope       snippets.Scope `json:"scope"` // global 或 user，默认 user
+}
+
+// ExecuteSnippetRequest 执行片段请求
+type ExecuteSnippetRequest struct {
+	Session string            `json:"session" binding:"required"`
+	Params  map[string]string `json:"params"`
+}
+
+// SnippetExport 片段导入/导出格式
+type SnippetExport struct {
+	Version  int             `json:"version"`
+	Snippets []SnippetRecord `json:"snippets"`
+}
+
+// SnippetRecord 导出的片段内容，不含 ID 和所有者
+type SnippetRecord struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Command     string         `json:"command"`
+	Scope       snippets.Scope `json:"scope,omitempty"`
+}
+
+// renderSnippet 渲染当前用户可见的片段，并按会话命令的规则校验结果
+func renderSnippet(store *snippets.Store, validator *security.SessionValidator, id string, params map[string]string, userID string, isAdmin bool) (string, error) {
+	snippet, err := store.Get(id)
+	if err != nil || !snippet.VisibleTo(userID, isAdmin) {
+		return "", snippets.ErrSnippetNotFound
+	}
+	command, err := snippet.Render(params)
+	if err != nil {
+		return "", err
+	}
+	if err := validator.SanitizeCommand(command); err != nil {
+		return "", err
+	}
+	return command, nil
+}
+
+// lookupSnippet 获取当前用户可见的片段，失败时已写入响应
+func (h *SnippetHandler) lookupSnippet(c *gin.Context) (snippets.Snippet, bool) {
+	snippet, err := h.store.Get(c.Param("id"))
+	if err != nil || !snippet.VisibleTo(middleware.GetUserID(c), middleware.IsAdmin(c)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "snippet not found",
+		})
+		return snippets.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// lookupEditableSnippet 获取当前用户可修改的片段，失败时已写入响应
+func (h *SnippetHandler) lookupEditableSnippet(c *gin.Context) (snippets.Snippet, bool) {
+	snippet, ok := h.lookupSnippet(c)
+	if !ok {
+		return snippets.Snippet{}, false
+	}
+	if !snippet.EditableBy(middleware.GetUserID(c), middleware.IsAdmin(c)) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "only administrators can modify global snippets",
+			"code":  "GLOBAL_SNIPPET_FORBIDDEN",
+		})
+		return snippets.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// newSnippet 按请求的范围构造片段，非管理员不能创建全局片段。失败时已写入响应
+func (h *SnippetHandler) newSnippet(c *gin.Context, record SnippetRecord) (snippets.Snippet, bool) {
+	snippet := snippets.Snippet{
+		Name:        record.Name,
+		Description: record.Description,
+		Command:     record.Command,
+		Scope:       record.Scope,
+		OwnerID:     middleware.GetUserID(c),
+	}
+	if snippet.Scope == "" {
+		snippet.Scope = snippets.ScopeUser
+	}
+	if snippet.Scope == snippets.ScopeGlobal && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "only administrators can create global snippets",
+			"code":  "GLOBAL_SNIPPET_FORBIDDEN",
+		})
+		return snippets.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// bindSnippet 解析并校验请求，失败时已写入响应
+func (h *SnippetHandler) bindSnippet(c *gin.Context) (snippets.Snippet, bool) {
+	var req SnippetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return snippets.Snippet{}, false
+	}
+
+	snippet, ok := h.newSnippet(c, SnippetRecord{
+		Name:        req.Name,
+		Description: req.Description,
+		Command:     req.Command,
+		Scope:       req.Scope,
+	})
+	if !ok {
+		return snippets.Snippet{}, false
+	}
+	if err := snippet.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return snippets.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// visibleSnippets 返回当前用户可见的片段，scope 不为空时按范围过滤
+func (h *SnippetHandler) visibleSnippets(c *gin.Context, scope string) []snippets.Snippet {
+	userID, isAdmin := middleware.GetUserID(c), middleware.IsAdmin(c)
+
+	visible := make([]snippets.Snippet, 0)
+	for _, snippet := range h.store.List() {
+		if !snippet.VisibleTo(userID, isAdmin) {
+			continue
+		}
+		if scope != "" && string(snippet.Scope) != scope {
+			continue
+		}
+		visible = append(visible, snippet)
+	}
+	return visible
+}
+
+// ListSnippets 列出片段
+// GET /api/snippets?scope=global|user
+func (h *SnippetHandler) ListSnippets(c *gin.Context) {
+	c.JSON(http.StatusOK, h.visibleSnippets(c, c.Query("scope")))
+}
+
+// CreateSnippet 创建片段
+// POST /api/snippets
+func (h *SnippetHandler) CreateSnippet(c *gin.Context) {
+	snippet, ok := h.bindSnippet(c)
+	if !ok {
+		return
+	}
+
+	snippet, err := h.store.Put(snippet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save snippet",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, snippet)
+}
+
+// GetSnippet 获取片段
+// GET /api/snippets/:id
+func (h *SnippetHandler) GetSnippet(c *gin.Context) {
+	snippet, ok := h.lookupSnippet(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, snippet)
+}
+
+// UpdateSnippet 替换片段内容
+// PUT /api/snippets/:id
+func (h *SnippetHandler) UpdateSnippet(c *gin.Context) {
+	existing, ok := h.lookupEditableSnippet(c)
+	if !ok {
+		return
+	}
+
+	snippet, ok := h.bindSnippet(c)
+	if !ok {
+		return
+	}
+	snippet.ID = existing.ID
+	// 修改范围时保留原所有者，管理员编辑他人的片段不会变成自己的
+	if snippet.Scope == snippets.ScopeUser && existing.Scope == snippets.ScopeUser {
+		snippet.OwnerID = existing.OwnerID
+	}
+
+	snippet, err := h.store.Put(snippet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save snippet",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, snippet)
+}
+
+// DeleteSnippet 删除片段
+// DELETE /api/snippets/:id
+func (h *SnippetHandler) DeleteSnippet(c *gin.Context) {
+	snippet, ok := h.lookupEditableSnippet(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(snippet.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete snippet",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ExecuteSnippet 渲染片段并作为命令发送到会话
+// POST /api/snippets/:id/execute
+func (h *SnippetHandler) ExecuteSnippet(c *gin.Context) {
+	var req ExecuteSnippetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	userID, isAdmin := middleware.GetUserID(c), middleware.IsAdmin(c)
+	session, ok := lookupSession(c, h.tmuxManager, req.Session)
+	if !ok {
+		return
+	}
+
+	command, err := renderSnippet(h.store, h.validator, c.Param("id"), req.Params, userID, isAdmin)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, snippets.ErrSnippetNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := session.SendCommand(command); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to send command",
+		})
+		return
+	}
+	recordCommand(h.history, history.Entry{
+		Session: session.Name,
+		Command: command,
+		UserID:  userID,
+		Source:  history.SourceSnippet,
+		Ref:     c.Param("id"),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"command": command,
+	})
+}
+
+// ExportSnippets 导出当前用户可见的片段
+// GET /api/snippets/export?scope=global|user
+func (h *SnippetHandler) ExportSnippets(c *gin.Context) {
+	export := SnippetExport{
+		Version:  snippetExportVersion,
+		Snippets: make([]SnippetRecord, 0),
+	}
+	userID := middleware.GetUserID(c)
+	for _, snippet := range h.visibleSnippets(c, c.Query("scope")) {
+		// 管理员只导出全局片段和自己的片段
+		if snippet.Scope == snippets.ScopeUser && snippet.OwnerID != userID {
+			continue
+		}
+		export.Snippets = append(export.Snippets, SnippetRecord{
+			Name:        snippet.Name,
+			Description: snippet.Description,
+			Command:     snippet.Command,
+			Scope:       snippet.Scope,
+		})
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="snippets.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// ImportSnippets 导入片段，同一范围内的同名片段会被覆盖
+// POST /api/snippets/import
+func (h *SnippetHandler) ImportSnippets(c *gin.Context) {
+	var req SnippetExport
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Version > snippetExportVersion {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "unsupported snippet export version",
+		})
+		return
+	}
+
+	records := make([]snippets.Snippet, 0, len(req.Snippets))
+	for _, record := range req.Snippets {
+		snippet, ok := h.newSnippet(c, record)
+		if !ok {
+			return
+		}
+		records = append(records, snippet)
+	}
+
+	imported, err := h.store.Import(records)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, imported)
+}
@@ -0,0 +1,383 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/websocket"
+)
+
+// 终端 I/O 的传输方式
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+	TransportPoll      = "poll"
+)
+
+const (
+	// pollDefaultTimeout 长轮询默认等待时间
+	pollDefaultTimeout = 25 * time.Second
+	// pollMaxTimeout 长轮询最大等待时间
+	pollMaxTimeout = 55 * time.Second
+	// streamIdleTimeout 长轮询流在没有请求时的过期时间
+	streamIdleTimeout = 60 * time.Second
+	// maxInputSize 单条输入消息的最大字节数，与 WebSocket 读取限制一致
+	maxInputSize = 512 * 1024
+)
+
+// fallbackStream 一个 SSE 或长轮询的终端流，以无连接客户端的形式注册到 Hub，
+// 消息格式与 WebSocket 完全相同
+type fallbackStream struct {
+	id         string
+	transport  string
+	client     *websocket.Client
+	session    *tmux.Session
+	done       chan struct{}
+	lastActive time.Time // 受 streamsMu 保护
+	closed     bool      // 受 streamsMu 保护
+}
+
+// TransportInfo 终端传输协商响应
+type TransportInfo struct {
+	Session    string   `json:"session"`
+	Transports []string `json:"transports"` // 按优先级排序
+	WebSocket  string   `json:"websocket"`
+	SSE        string   `json:"sse"`
+	Poll       string   `json:"poll"`
+	Input      string   `json:"input"`
+}
+
+// GetTransports 返回会话可用的终端传输方式，客户端按顺序尝试，
+// WebSocket 被代理拦截时依次回退到 SSE 和长轮询
+// GET /api/sessions/:name/terminal
+func (h *WebSocketHandler) GetTransports(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	base := "/api/sessions/" + session.Name + "/terminal"
+	c.JSON(http.StatusOK, TransportInfo{
+		Session:    session.Name,
+		Transports: []string{TransportWebSocket, TransportSSE, TransportPoll},
+		WebSocket:  "/api/ws/" + session.Name,
+		SSE:        base + "/sse",
+		Poll:       base + "/poll",
+		Input:      base + "/input",
+	})
+}
+
+// openStream 创建回退流：注册到 Hub 并启动输出推送
+func (h *WebSocketHandler) openStream(c *gin.Context, session *tmux.Session, transport string) *fallbackStream {
+	stream := &fallbackStream{
+		id:        newStreamID(),
+		transport: transport,
+		client: &websocket.Client{
+			Hub:       h.hub,
+			Send:      make(chan []byte, 256),
+			SessionID: session.Name,
+			UserID:    middleware.GetUserID(c),
+			IsAdmin:   middleware.IsAdmin(c),
+			LastSeq:   lastSeq(c),
+		},
+		session:    session,
+		done:       make(chan struct{}),
+		lastActive: time.Now(),
+	}
+
+	h.streamsMu.Lock()
+	h.streams[stream.id] = stream
+	h.streamsMu.Unlock()
+	h.janitorOnce.Do(func() { go h.expireStreams() })
+
+	h.hub.Register(stream.client)
+	h.publishClientEvent(events.ClientAttached, stream.client, session)
+	go h.pumpStreamOutput(stream)
+
+	log.Printf("[Terminal] Opened %s stream %s for session %s", transport, stream.id, session.Name)
+	return stream
+}
+
+// closeStream 关闭回退流并从 Hub 注销
+func (h *WebSocketHandler) closeStream(stream *fallbackStream) {
+	h.streamsMu.Lock()
+	if stream.closed {
+		h.streamsMu.Unlock()
+		return
+	}
+	stream.closed = true
+	delete(h.streams, stream.id)
+	h.streamsMu.Unlock()
+
+	close(stream.done)
+	h.hub.Unregister(stream.client)
+	h.publishClientEvent(events.ClientDetached, stream.client, stream.session)
+	log.Printf("[Terminal] Closed %s stream %s for session %s", stream.transport, stream.id, stream.session.Name)
+}
+
+// getStream 按 ID 查找属于当前用户和会话的流，并刷新活动时间
+func (h *WebSocketHandler) getStream(c *gin.Context, session *tmux.Session) (*fallbackStream, bool) {
+	id := c.Query("stream")
+
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+
+	stream, ok := h.streams[id]
+	if !ok || stream.session != session || stream.client.UserID != middleware.GetUserID(c) {
+		return nil, false
+	}
+	stream.lastActive = time.Now()
+	return stream, true
+}
+
+// pumpStreamOutput 定期推送终端输出，与 WebSocket 连接的输出节奏一致
+func (h *WebSocketHandler) pumpStreamOutput(stream *fallbackStream) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !h.sendOutput(stream.client, stream.session) {
+				// 等待客户端取走 session_ended 消息后再关闭
+				time.Sleep(time.Second)
+				h.closeStream(stream)
+				return
+			}
+		case <-stream.done:
+			return
+		}
+	}
+}
+
+// expireStreams 定期关闭长时间没有请求的长轮询流
+func (h *WebSocketHandler) expireStreams() {
+	ticker := time.NewTicker(streamIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []*fallbackStream
+		h.streamsMu.Lock()
+		for _, stream := range h.streams {
+			if stream.transport == TransportPoll && time.Since(stream.lastActive) > streamIdleTimeout {
+				expired = append(expired, stream)
+			}
+		}
+		h.streamsMu.Unlock()
+
+		for _, stream := range expired {
+			h.closeStream(stream)
+		}
+	}
+}
+
+// StreamSSE 通过 Server-Sent Events 推送终端输出。首个事件为 stream，携带输入时使用的
+// stream_id；之后每个 message 事件的 data 与 WebSocket 消息相同
+// GET /api/sessions/:name/terminal/sse
+func (h *WebSocketHandler) StreamSSE(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	// SSE 是长连接，取消服务器的写超时
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[Terminal] Failed to clear write deadline: %v", err)
+	}
+
+	stream := h.openStream(c, session, TransportSSE)
+	defer h.closeStream(stream)
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	writeSSE(c, 0, "stream", gin.H{"stream_id": stream.id, "input": "/api/sessions/" + session.Name + "/terminal/input?stream=" + stream.id})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message, ok := <-stream.client.Send:
+			if !ok {
+				// 被新连接踢出或流已关闭
+				return
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: message\ndata: %s\n\n", message); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprintf(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// PollResponse 长轮询响应
+type PollResponse struct {
+	StreamID string            `json:"stream_id"`
+	Messages []json.RawMessage `json:"messages"` // 与 WebSocket 消息格式相同
+	Closed   bool              `json:"closed"`   // 流已关闭（被踢出或会话结束），客户端不应继续轮询
+}
+
+// Poll 长轮询获取终端消息。不带 stream 参数时创建新流并立即返回 stream_id；
+// 带 stream 参数时等待直到有消息或超时（?timeout=秒，默认 25）
+// GET /api/sessions/:name/terminal/poll?stream=<id>&timeout=25
+func (h *WebSocketHandler) Poll(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	if c.Query("stream") == "" {
+		stream := h.openStream(c, session, TransportPoll)
+		c.JSON(http.StatusOK, PollResponse{StreamID: stream.id, Messages: []json.RawMessage{}})
+		return
+	}
+
+	stream, ok := h.getStream(c, session)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "stream not found",
+			"code":  "STREAM_NOT_FOUND",
+		})
+		return
+	}
+
+	timeout := pollDefaultTimeout
+	if seconds, err := strconv.Atoi(c.Query("timeout")); err == nil && seconds >= 0 {
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > pollMaxTimeout {
+			timeout = pollMaxTimeout
+		}
+	}
+	// 等待时间可能超过服务器的写超时
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second)); err != nil {
+		log.Printf("[Terminal] Failed to extend write deadline: %v", err)
+	}
+
+	response := PollResponse{StreamID: stream.id, Messages: []json.RawMessage{}}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// 等待第一条消息，然后取走所有已排队的消息
+	select {
+	case message, ok := <-stream.client.Send:
+		if !ok {
+			response.Closed = true
+			break
+		}
+		response.Messages = append(response.Messages, message)
+	drain:
+		for {
+			select {
+			case message, ok := <-stream.client.Send:
+				if !ok {
+					response.Closed = true
+					break drain
+				}
+				response.Messages = append(response.Messages, message)
+			default:
+				break drain
+			}
+		}
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	if response.Closed {
+		h.closeStream(stream)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SendInput 通过 HTTP 发送终端输入，请求体与 WebSocket 客户端消息格式相同，
+// 例如 {"type": "keys", "data": "ls"}
+// POST /api/sessions/:name/terminal/input?stream=<id>
+func (h *WebSocketHandler) SendInput(c *gin.Context) {
+	session, ok := lookupSession(c, h.tmuxManager, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	stream, ok := h.getStream(c, session)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "stream not found",
+			"code":  "STREAM_NOT_FOUND",
+		})
+		return
+	}
+
+	message, err := io.ReadAll(io.LimitReader(c.Request.Body, maxInputSize+1))
+	if err != nil || len(message) > maxInputSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+			"code":  "INVALID_PARAMS",
+		})
+		return
+	}
+	if !json.Valid(message) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid message format",
+			"code":  "INVALID_PARAMS",
+		})
+		return
+	}
+
+	h.handleClientMessage(stream.client, session, message)
+	c.Status(http.StatusAccepted)
+}
+
+// newStreamID 生成随机的流 ID
+func newStreamID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("stream_%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,248 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
+)
+
+// TriggerHandler 输出匹配规则处理器
+type TriggerHandler struct {
+	engine      *triggers.Engine
+	tmuxManager *tmux.Manager
+	validator   *security.SessionValidator
+}
+
+// NewTriggerHandler 创建输出匹配规则处理器
+func NewTriggerHandler(engine *triggers.Engine, tmuxManager *tmux.Manager, validator *security.SessionValidator) *TriggerHandler {
+	return &TriggerHandler{
+		engine:      engine,
+		tmuxManager: tmuxManager,
+		validator:   validator,
+	}
+}
+
+// TriggerRequest 创建/更新规则请求
+type TriggerRequest struct {
+	Name            string          `json:"name" binding:"required"`
+	Session         string          `json:"session"` // 为空表示全局规则（仅管理员）
+	Pattern         string          `json:"pattern" binding:"required"`
+	Action          triggers.Action `json:"action"`
+	DebounceSeconds *int            `json:"debounce_seconds"` // 默认 triggers.DefaultDebounceSeconds
+	RateLimit       *int            `json:"rate_limit"`       // 默认 triggers.DefaultRateLimit
+	Enabled         *bool           `json:"enabled"`          // 默认启用
+}
+
+// TriggerResponse 规则响应，附带运行状态
+type TriggerResponse struct {
+	triggers.Rule
+	Status triggers.Status `json:"status"`
+}
+
+// newTriggerResponse 构造规则响应
+func (h *TriggerHandler) newTriggerResponse(rule triggers.Rule) TriggerResponse {
+	return TriggerResponse{
+		Rule:   rule,
+		Status: h.engine.Status(rule.ID),
+	}
+}
+
+// accessible 判断当前用户能否查看和修改规则
+func (h *TriggerHandler) accessible(c *gin.Context, rule triggers.Rule) bool {
+	return middleware.IsAdmin(c) || (rule.OwnerID != "" && rule.OwnerID == middleware.GetUserID(c))
+}
+
+// lookupRule 获取当前用户可访问的规则，失败时已写入响应
+func (h *TriggerHandler) lookupRule(c *gin.Context) (triggers.Rule, bool) {
+	rule, err := h.engine.Store().Get(c.Param("id"))
+	if err != nil || !h.accessible(c, rule) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "trigger not found",
+		})
+		return triggers.Rule{}, false
+	}
+	return rule, true
+}
+
+// bindRule 解析并校验请求，失败时已写入响应
+func (h *TriggerHandler) bindRule(c *gin.Context) (triggers.Rule, bool) {
+	var req TriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return triggers.Rule{}, false
+	}
+
+	if req.Session == "" {
+		if !middleware.IsAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "only administrators can create global triggers",
+				"code":  "GLOBAL_TRIGGER_FORBIDDEN",
+			})
+			return triggers.Rule{}, false
+		}
+	} else {
+		if _, ok := lookupSession(c, h.tmuxManager, req.Session); !ok {
+			return triggers.Rule{}, false
+		}
+	}
+
+	// 动作参数与会话的其他输入使用相同的校验
+	var err error
+	switch req.Action.Type {
+	case triggers.ActionSendKeys:
+		err = h.validator.SanitizeCommand(req.Action.Keys)
+	case triggers.ActionTag:
+		err = h.validator.ValidateLabels(map[string]string{req.Action.LabelKey: req.Action.LabelValue})
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return triggers.Rule{}, false
+	}
+
+	rule := triggers.Rule{
+		Name:            req.Name,
+		Session:         req.Session,
+		Pattern:         req.Pattern,
+		Action:          req.Action,
+		DebounceSeconds: triggers.DefaultDebounceSeconds,
+		RateLimit:       triggers.DefaultRateLimit,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		OwnerID:         middleware.GetUserID(c),
+	}
+	if req.DebounceSeconds != nil {
+		rule.DebounceSeconds = *req.DebounceSeconds
+	}
+	if req.RateLimit != nil {
+		rule.RateLimit = *req.RateLimit
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return triggers.Rule{}, false
+	}
+	return rule, true
+}
+
+// ListTriggers 列出规则
+// GET /api/triggers?session=name
+func (h *TriggerHandler) ListTriggers(c *gin.Context) {
+	session := c.Query("session")
+
+	response := make([]TriggerResponse, 0)
+	for _, rule := range h.engine.Store().List() {
+		if !h.accessible(c, rule) {
+			continue
+		}
+		if session != "" && rule.Session != session {
+			continue
+		}
+		response = append(response, h.newTriggerResponse(rule))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateTrigger 创建规则
+// POST /api/triggers
+func (h *TriggerHandler) CreateTrigger(c *gin.Context) {
+	rule, ok := h.bindRule(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.engine.Store().Put(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save trigger",
+		})
+		return
+	}
+	h.engine.Refresh()
+
+	c.JSON(http.StatusCreated, h.newTriggerResponse(rule))
+}
+
+// GetTrigger 获取规则
+// GET /api/triggers/:id
+func (h *TriggerHandler) GetTrigger(c *gin.Context) {
+	rule, ok := h.lookupRule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newTriggerResponse(rule))
+}
+
+// UpdateTrigger 替换规则内容
+// PUT /api/triggers/:id
+func (h *TriggerHandler) UpdateTrigger(c *gin.Context) {
+	existing, ok := h.lookupRule(c)
+	if !ok {
+		return
+	}
+
+	rule, ok := h.bindRule(c)
+	if !ok {
+		return
+	}
+	rule.ID = existing.ID
+
+	rule, err := h.engine.Store().Put(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save trigger",
+		})
+		return
+	}
+	h.engine.Refresh()
+
+	c.JSON(http.StatusOK, h.newTriggerResponse(rule))
+}
+
+// DeleteTrigger 删除规则
+// DELETE /api/triggers/:id
+func (h *TriggerHandler) DeleteTrigger(c *gin.Context) {
+	rule, ok := h.lookupRule(c)
+	if !ok {
+		return
+	}
+
+	if err := h.engine.Store().Delete(rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete trigger",
+		})
+		return
+	}
+	h.engine.Refresh()
+
+	c.Status(http.StatusNoContent)
+}
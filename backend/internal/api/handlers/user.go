@@ -0,0 +1,241 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/auth"
+	"github.com/xiaoliu10/remote-code/internal/users"
+	"github.com/xiaoliu10/remote-code/internal/websocket"
+)
+
+// UserHandler 用户账号处理器，仅管理员可管理
+type UserHandler struct {
+	users *users.Store
+	hub   *websocket.Hub
+}
+
+// NewUserHandler 创建用户账号处理器
+func NewUserHandler(userStore *users.Store, hub *websocket.Hub) *UserHandler {
+	return &UserHandler{users: userStore, hub: hub}
+}
+
+// UserRequest 创建/更新用户请求
+type UserRequest struct {
+	Username    string `json:"username" binding:"required"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`     // admin 或 user，默认 user
+	Password    string `json:"password"` // 创建时必填，更新时为空则保留原密码
+	Enabled     *bool  `json:"enabled"`  // 默认启用
+}
+
+// withoutPassword 返回隐藏密码哈希的用户
+func withoutPassword(user users.User) users.User {
+	user.PasswordHash = ""
+	user.TokenVersion = 0
+	return user
+}
+
+// requireAdmin 检查当前用户是否为管理员，失败时已写入响应
+func (h *UserHandler) requireAdmin(c *gin.Context) bool {
+	if !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "only administrators can manage users",
+			"code":  "ADMIN_REQUIRED",
+		})
+		return false
+	}
+	return true
+}
+
+// lookupUser 获取用户，失败时已写入响应
+func (h *UserHandler) lookupUser(c *gin.Context) (users.User, bool) {
+	if !h.requireAdmin(c) {
+		return users.User{}, false
+	}
+	user, err := h.users.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return users.User{}, false
+	}
+	return user, true
+}
+
+// bindUser 解析请求，失败时已写入响应
+func (h *UserHandler) bindUser(c *gin.Context) (users.User, string, bool) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return users.User{}, "", false
+	}
+
+	user := users.User{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Role:        req.Role,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if user.Role == "" {
+		user.Role = auth.RoleUser
+	}
+	if err := user.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return users.User{}, "", false
+	}
+	if req.Password != "" {
+		if err := users.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return users.User{}, "", false
+		}
+	}
+	return user, req.Password, true
+}
+
+// userStoreError 将存储错误写入响应
+func userStoreError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, users.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "USERNAME_TAKEN",
+		})
+	case errors.Is(err, users.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "LAST_ADMIN",
+		})
+	case errors.Is(err, users.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message,
+		})
+	}
+}
+
+// ListUsers 列出用户
+// GET /api/users
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	list := h.users.List()
+	response := make([]users.User, 0, len(list))
+	for _, user := range list {
+		response = append(response, withoutPassword(user))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateUser 创建用户
+// POST /api/users
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	user, password, ok := h.bindUser(c)
+	if !ok {
+		return
+	}
+	if password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "password is required",
+		})
+		return
+	}
+
+	user, err := h.users.Create(user, password)
+	if err != nil {
+		userStoreError(c, err, "failed to save user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, withoutPassword(user))
+}
+
+// GetUser 获取用户
+// GET /api/users/:id
+func (h *UserHandler) GetUser(c *gin.Context) {
+	user, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, withoutPassword(user))
+}
+
+// UpdateUser 替换用户资料，password 不为空时重置密码
+// PUT /api/users/:id
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	existing, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+	user, password, ok := h.bindUser(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Update(existing.ID, user, password)
+	if err != nil {
+		userStoreError(c, err, "failed to save user")
+		return
+	}
+	// 已建立的终端连接按旧的权限认证，账号停用、角色变化或密码被重置后断开
+	if !user.Enabled || user.Role != existing.Role || password != "" {
+		h.hub.DisconnectUser(user.ID, "Your account has been changed by an administrator")
+	}
+
+	c.JSON(http.StatusOK, withoutPassword(user))
+}
+
+// DeleteUser 删除用户，用户创建的会话保留
+// DELETE /api/users/:id
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.Delete(user.ID); err != nil {
+		userStoreError(c, err, "failed to delete user")
+		return
+	}
+	h.hub.DisconnectUser(user.ID, "Your account has been removed by an administrator")
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,256 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/webhook"
+)
+
+// WebhookHandler 出站 webhook 处理器，webhook 会收到所有用户的事件，仅管理员可管理
+type WebhookHandler struct {
+	dispatcher *webhook.Dispatcher
+}
+
+// NewWebhookHandler 创建出站 webhook 处理器
+func NewWebhookHandler(dispatcher *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{dispatcher: dispatcher}
+}
+
+// WebhookRequest 创建/更新端点请求
+type WebhookRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	URL     string   `json:"url" binding:"required"`
+	Secret  string   `json:"secret"`  // 创建时为空则自动生成，更新时为空则保留原密钥
+	Events  []string `json:"events"`  // 为空表示所有事件
+	Enabled *bool    `json:"enabled"` // 默认启用
+}
+
+// withoutSecret 返回隐藏密钥的端点，密钥只在创建时返回一次
+func withoutSecret(endpoint webhook.Endpoint) webhook.Endpoint {
+	endpoint.Secret = ""
+	return endpoint
+}
+
+// requireAdmin 检查当前用户是否为管理员，失败时已写入响应
+func (h *WebhookHandler) requireAdmin(c *gin.Context) bool {
+	if !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "only administrators can manage webhooks",
+			"code":  "ADMIN_REQUIRED",
+		})
+		return false
+	}
+	return true
+}
+
+// lookupEndpoint 获取端点，失败时已写入响应
+func (h *WebhookHandler) lookupEndpoint(c *gin.Context) (webhook.Endpoint, bool) {
+	if !h.requireAdmin(c) {
+		return webhook.Endpoint{}, false
+	}
+	endpoint, err := h.dispatcher.Store().Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "webhook not found",
+		})
+		return webhook.Endpoint{}, false
+	}
+	return endpoint, true
+}
+
+// bindEndpoint 解析请求，失败时已写入响应
+func (h *WebhookHandler) bindEndpoint(c *gin.Context) (webhook.Endpoint, bool) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return webhook.Endpoint{}, false
+	}
+
+	endpoint := webhook.Endpoint{
+		Name:    req.Name,
+		URL:     req.URL,
+		Secret:  req.Secret,
+		Events:  req.Events,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if endpoint.Events == nil {
+		endpoint.Events = []string{}
+	}
+	if err := endpoint.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return webhook.Endpoint{}, false
+	}
+	return endpoint, true
+}
+
+// ListWebhooks 列出端点
+// GET /api/webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	endpoints := h.dispatcher.Store().List()
+	response := make([]webhook.Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		response = append(response, withoutSecret(endpoint))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateWebhook 创建端点，响应中包含签名密钥
+// POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	endpoint, ok := h.bindEndpoint(c)
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.dispatcher.Store().Put(endpoint)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save webhook",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+// GetWebhook 获取端点
+// GET /api/webhooks/:id
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	endpoint, ok := h.lookupEndpoint(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, withoutSecret(endpoint))
+}
+
+// UpdateWebhook 替换端点配置
+// PUT /api/webhooks/:id
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	existing, ok := h.lookupEndpoint(c)
+	if !ok {
+		return
+	}
+	endpoint, ok := h.bindEndpoint(c)
+	if !ok {
+		return
+	}
+	endpoint.ID = existing.ID
+
+	endpoint, err := h.dispatcher.Store().Put(endpoint)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to save webhook",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, withoutSecret(endpoint))
+}
+
+// DeleteWebhook 删除端点并取消其待重试的投递
+// DELETE /api/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	endpoint, ok := h.lookupEndpoint(c)
+	if !ok {
+		return
+	}
+
+	if err := h.dispatcher.Store().Delete(endpoint.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete webhook",
+		})
+		return
+	}
+	h.dispatcher.Forget(endpoint.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries 获取端点最近的投递记录
+// GET /api/webhooks/:id/deliveries
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	endpoint, ok := h.lookupEndpoint(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.dispatcher.Deliveries(endpoint.ID))
+}
+
+// TestWebhook 向端点发送测试事件，返回首次投递结果
+// POST /api/webhooks/:id/test
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	endpoint, ok := h.lookupEndpoint(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.dispatcher.Test(endpoint.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ListDeadLetters 获取重试次数用尽的投递
+// GET /api/webhooks/dead-letters?endpoint=id&limit=100
+func (h *WebhookHandler) ListDeadLetters(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	letters, err := h.dispatcher.DeadLetters(c.Query("endpoint"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to read dead letter log",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
@@ -20,14 +20,24 @@
 package handlers
 
 import (
-	"encoding/json"
+	"compress/flate"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	gorillaws "github.com/gorilla/websocket"
+	"github.com/xiaoliu10/remote-code/internal/api/middleware"
+	"github.com/xiaoliu10/remote-code/internal/auth"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/snippets"
 	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
 	"github.com/xiaoliu10/remote-code/internal/websocket"
 )
 
@@ -35,19 +45,125 @@ import (
 type WebSocketHandler struct {
 	hub        *websocket.Hub
 	tmuxManager *tmux.Manager
+	events     *events.Bus
+	snippets   *snippets.Store
+	validator  *security.SessionValidator
+	history    *history.Store
+	upgrader   *gorillaws.Upgrader
+	tickets    *auth.TicketStore
+
+	// SSE/长轮询回退传输的活动流
+	streams     map[string]*fallbackStream
+	streamsMu   sync.Mutex
+	janitorOnce sync.Once
 }
 
 // NewWebSocketHandler 创建 WebSocket 处理器
-func NewWebSocketHandler(hub *websocket.Hub, tmuxManager *tmux.Manager) *WebSocketHandler {
-	return &WebSocketHandler{
+func NewWebSocketHandler(hub *websocket.Hub, tmuxManager *tmux.Manager, bus *events.Bus, snippetStore *snippets.Store, validator *security.SessionValidator, historyStore *history.Store, origins *security.OriginPolicy, tickets *auth.TicketStore) *WebSocketHandler {
+	h := &WebSocketHandler{
 		hub:        hub,
 		tmuxManager: tmuxManager,
+		events:     bus,
+		snippets:   snippetStore,
+		validator:  validator,
+		history:    historyStore,
+		upgrader:   websocket.NewUpgrader(origins.Allowed, websocket.SubprotocolV2, websocket.SubprotocolV1),
+		tickets:    tickets,
+		streams:    make(map[string]*fallbackStream),
+	}
+	if bus != nil {
+		go h.forwardAlerts()
 	}
+	return h
+}
+
+// forwardAlerts 将会话提醒、规则通知和代理批准提示推送给会话所有者和管理员的所有终端连接，
+// 并在会话删除或重命名后丢弃其重连缓冲区
+func (h *WebSocketHandler) forwardAlerts() {
+	ch, _ := h.events.Subscribe(64)
+	for event := range ch {
+		switch event.Type {
+		case events.SessionRenamed:
+			if data, ok := event.Data.(map[string]string); ok {
+				h.hub.ResetSession(data["old_name"])
+			}
+		case events.SessionDeleted, events.SessionExited:
+			h.hub.ResetSession(event.Session)
+		case events.SessionAlert:
+			h.hub.SendToUser(event.Owner, websocket.TypeAlert, event.Session, event.Data)
+		case events.AlertsAcked:
+			h.hub.SendToUser(event.Owner, websocket.TypeAlertsAcked, event.Session, event.Data)
+		case events.AgentPrompt:
+			h.hub.SendToUser(event.Owner, websocket.TypePrompt, event.Session, event.Data)
+		case events.TriggerFired:
+			if firing, ok := event.Data.(triggers.Firing); ok && firing.Action == triggers.ActionNotify {
+				h.hub.SendToUser(event.Owner, websocket.TypeTrigger, event.Session, firing)
+			}
+		}
+	}
+}
+
+// GetStats 返回终端连接的流控指标：发送队列积压、丢弃和合并的消息数、输出暂停时长。
+// 管理员可以看到所有连接，其他用户只能看到自己的连接
+// GET /api/terminal/stats
+func (h *WebSocketHandler) GetStats(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if middleware.IsAdmin(c) {
+		userID = ""
+	} else if userID == "" {
+		c.JSON(http.StatusOK, websocket.Stats{Clients: []websocket.ClientStats{}})
+		return
+	}
+	c.JSON(http.StatusOK, h.hub.Stats(userID))
+}
+
+// lastSeq 解析重连时携带的 ?last_seq=，无效时按新连接处理
+func lastSeq(c *gin.Context) uint64 {
+	seq, _ := strconv.ParseUint(c.Query("last_seq"), 10, 64)
+	return seq
+}
+
+// publishClientEvent 发布客户端连接/断开事件
+func (h *WebSocketHandler) publishClientEvent(eventType events.Type, client *websocket.Client, session *tmux.Session) {
+	h.events.Publish(events.Event{
+		Type:    eventType,
+		Session: session.Name,
+		Owner:   session.OwnerID,
+		Data:    map[string]string{"user_id": client.UserID},
+	})
+}
+
+// sessionEnded 检查会话是否已被删除、退出或重命名
+func (h *WebSocketHandler) sessionEnded(session *tmux.Session) bool {
+	current, err := h.tmuxManager.GetSession(session.Name)
+	return err != nil || current != session
+}
+
+// IssueTicket 用 JWT 换取一次性连接票据，票据绑定会话和客户端 IP
+// POST /api/sessions/:name/ws-ticket
+func (h *WebSocketHandler) IssueTicket(c *gin.Context) {
+	sessionName := c.Param("name")
+	if _, ok := lookupSession(c, h.tmuxManager, sessionName); !ok {
+		return
+	}
+
+	ticket, err := h.tickets.Issue(middleware.GetClaims(c), auth.SessionScope(sessionName), c.ClientIP())
+	if err != nil {
+		log.Printf("[WS] Failed to issue ticket: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to issue ticket", "code": "TICKET_UNAVAILABLE"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"session":    sessionName,
+		"expires_in": int(h.tickets.TTL().Seconds()),
+	})
 }
 
 // HandleWebSocket 处理 WebSocket 连接
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	// 从 JWT 获取用户信息
+	// 从连接票据获取用户信息
 	userID := c.GetString("user_id")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -61,24 +177,18 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	// 检查会话是否存在
-	session, err := h.tmuxManager.GetSession(sessionName)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	session, ok := lookupSession(c, h.tmuxManager, sessionName)
+	if !ok {
 		return
 	}
 
-	// 升级到 WebSocket
-	conn, err := (&gorillaws.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // 生产环境应设置严格的 Origin 检查
-		},
-	}).Upgrade(c.Writer, c.Request, nil)
+	// 升级到 WebSocket，通过子协议协商协议版本，并协商 permessage-deflate
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("[WS] Failed to upgrade: %v", err)
 		return
 	}
+	conn.SetCompressionLevel(flate.BestSpeed)
 
 	// 创建客户端
 	client := &websocket.Client{
@@ -87,10 +197,15 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		Send:      make(chan []byte, 256),
 		SessionID: session.Name,
 		UserID:    userID,
+		IsAdmin:   middleware.IsAdmin(c),
+		Protocol:  websocket.NegotiatedProtocol(conn),
+		LastSeq:   lastSeq(c),
 	}
+	log.Printf("[WS] Client connected to session %s with protocol v%d", session.Name, client.Protocol)
 
 	// 注册客户端
 	h.hub.Register(client)
+	h.publishClientEvent(events.ClientAttached, client, session)
 
 	// 启动读写协程
 	go client.WritePump()
@@ -101,6 +216,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 func (h *WebSocketHandler) readPumpWithOutput(client *websocket.Client, session *tmux.Session) {
 	defer func() {
 		h.hub.Unregister(client)
+		h.publishClientEvent(events.ClientDetached, client, session)
 		client.Conn.Close()
 		// 注意：不要在这里关闭 client.Send，Hub 的 unregisterClient 会负责关闭
 	}()
@@ -117,41 +233,30 @@ func (h *WebSocketHandler) readPumpWithOutput(client *websocket.Client, session
 	outputTicker := time.NewTicker(500 * time.Millisecond)
 	defer outputTicker.Stop()
 
-	// 用于检测输出的变化
-	lastOutput := ""
-
 	// 创建一个 channel 用于接收客户端消息
 	messageChan := make(chan []byte, 10)
 	go func() {
 		for {
-			_, message, err := client.Conn.ReadMessage()
+			frameType, message, err := client.Conn.ReadMessage()
 			if err != nil {
 				close(messageChan)
 				return
 			}
-			messageChan <- message
+			// v2 客户端的二进制帧为 MessagePack，统一转换为 JSON 处理
+			data, err := websocket.ToJSON(frameType, message)
+			if err != nil {
+				log.Printf("[WS] Invalid binary message: %v", err)
+				continue
+			}
+			messageChan <- data
 		}
 	}()
 
 	for {
 		select {
 		case <-outputTicker.C:
-			// 获取当前输出
-			currentOutput, err := session.CaptureOutput()
-			if err != nil {
-				h.hub.SendToSession(session.Name, "error", "Failed to capture output")
-				continue
-			}
-
-			// 只在输出变化时发送
-			if currentOutput != lastOutput {
-				// 发送增量更新（这里简化为发送全部）
-				// 生产环境应该实现增量更新以减少带宽
-				h.hub.SendToSession(session.Name, "output", map[string]interface{}{
-					"text":      currentOutput,
-					"timestamp": time.Now().Unix(),
-				})
-				lastOutput = currentOutput
+			if !h.sendOutput(client, session) {
+				return
 			}
 
 		case message, ok := <-messageChan:
@@ -167,98 +272,178 @@ func (h *WebSocketHandler) readPumpWithOutput(client *websocket.Client, session
 	}
 }
 
-// handleClientMessage 处理来自客户端的消息
+// sendOutput 捕获会话输出并由 Hub 在变化时推送给客户端，会话已结束时返回 false。
+// v1 客户端每次收到完整输出，v2 客户端只收到变化的行
+func (h *WebSocketHandler) sendOutput(client *websocket.Client, session *tmux.Session) bool {
+	// 客户端消费过慢时暂停捕获，恢复后一次推送合并后的变化
+	if h.hub.PauseOutput(client) {
+		return true
+	}
+
+	// 获取当前输出
+	currentOutput, err := session.CaptureOutput()
+	if err != nil {
+		// 会话已被删除、退出或重命名时通知客户端并断开连接
+		if h.sessionEnded(session) {
+			h.hub.SendToSession(session.Name, websocket.TypeSessionEnded, "Session no longer exists")
+			return false
+		}
+		h.hub.SendError(client, "", websocket.CodeCaptureFailed, "Failed to capture output")
+		return true
+	}
+
+	h.hub.PublishOutput(client, currentOutput)
+	return true
+}
+
+// handleClientMessage 处理来自客户端的消息。带 id 的请求处理成功后回复 ack，
+// 失败时回复带错误码的 error；不带 id 的请求保持原有的 status 通知
 func (h *WebSocketHandler) handleClientMessage(client *websocket.Client, session *tmux.Session, message []byte) {
-	var msg map[string]interface{}
-	if err := json.Unmarshal(message, &msg); err != nil {
+	msg, err := websocket.ParseClientMessage(message)
+	if err != nil {
 		log.Printf("[WS] Invalid message format: %v", err)
+		h.hub.SendError(client, msg.ID, websocket.CodeInvalidMessage, "Invalid message format")
 		return
 	}
 
-	msgType, _ := msg["type"].(string)
-
-	switch msgType {
-	case "command":
+	switch msg.Type {
+	case websocket.TypeCommand:
 		// 发送命令到会话
-		command, _ := msg["data"].(string)
+		command, err := msg.Text()
+		if err != nil {
+			h.hub.SendError(client, msg.ID, websocket.CodeInvalidData, "Command must be a string")
+			return
+		}
 		log.Printf("[WS] Received command: %q for session %s", command, session.Name)
-		if command != "" {
-			if err := session.SendCommand(command); err != nil {
-				log.Printf("[WS] Failed to send command: %v", err)
-				h.hub.SendToSession(session.Name, "error", "Failed to send command")
-			} else {
-				log.Printf("[WS] Command sent successfully")
-				h.hub.SendToSession(session.Name, "status", "Command sent")
+		if command == "" {
+			h.hub.Ack(client, msg.ID, nil)
+			return
+		}
+		if err := session.SendCommand(command); err != nil {
+			log.Printf("[WS] Failed to send command: %v", err)
+			h.hub.SendError(client, msg.ID, websocket.CodeSendFailed, "Failed to send command")
+			return
+		}
+		log.Printf("[WS] Command sent successfully")
+		recordCommand(h.history, history.Entry{
+			Session: session.Name,
+			Command: command,
+			UserID:  client.UserID,
+			Source:  history.SourceWS,
+		})
+		h.succeed(client, session, msg, "Command sent")
+
+	case websocket.TypeSnippet:
+		// 渲染命令片段并发送到会话：{"type": "snippet", "data": {"id": "...", "params": {...}}}
+		var req websocket.SnippetRequest
+		if err := msg.Decode(&req); err != nil || req.ID == "" {
+			h.hub.SendError(client, msg.ID, websocket.CodeInvalidData, "Invalid snippet message")
+			return
+		}
+		command, err := renderSnippet(h.snippets, h.validator, req.ID, req.Params, client.UserID, client.IsAdmin)
+		if err != nil {
+			log.Printf("[WS] Rejected snippet %s for session %s: %v", req.ID, session.Name, err)
+			code := websocket.CodeCommandRejected
+			if errors.Is(err, snippets.ErrSnippetNotFound) {
+				code = websocket.CodeSnippetNotFound
 			}
+			h.hub.SendError(client, msg.ID, code, err.Error())
+			return
+		}
+		log.Printf("[WS] Received snippet %s: %q for session %s", req.ID, command, session.Name)
+		if err := session.SendCommand(command); err != nil {
+			log.Printf("[WS] Failed to send snippet: %v", err)
+			h.hub.SendError(client, msg.ID, websocket.CodeSendFailed, "Failed to send command")
+			return
 		}
+		recordCommand(h.history, history.Entry{
+			Session: session.Name,
+			Command: command,
+			UserID:  client.UserID,
+			Source:  history.SourceSnippet,
+			Ref:     req.ID,
+		})
+		h.succeed(client, session, msg, "Command sent")
 
-	case "keys":
+	case websocket.TypeKeys:
 		// 发送按键到会话（不回车）
-		keys, _ := msg["data"].(string)
+		keys, err := msg.Text()
+		if err != nil {
+			h.hub.SendError(client, msg.ID, websocket.CodeInvalidData, "Keys must be a string")
+			return
+		}
 		log.Printf("[WS] Received keys: %q for session %s", keys, session.Name)
 		if keys != "" {
 			if err := session.SendKeys(keys); err != nil {
 				log.Printf("[WS] Failed to send keys: %v", err)
-				h.hub.SendToSession(session.Name, "error", "Failed to send keys")
-			} else {
-				log.Printf("[WS] Keys sent successfully")
+				h.hub.SendError(client, msg.ID, websocket.CodeSendFailed, "Failed to send keys")
+				return
 			}
+			log.Printf("[WS] Keys sent successfully")
 		}
+		h.hub.Ack(client, msg.ID, nil)
 
-	case "enter_copy_mode":
+	case websocket.TypeEnterCopyMode:
 		// 进入 tmux copy mode
 		log.Printf("[WS] Entering copy mode for session %s", session.Name)
 		if err := session.EnterCopyMode(); err != nil {
 			log.Printf("[WS] Failed to enter copy mode: %v", err)
-			h.hub.SendToSession(session.Name, "error", "Failed to enter copy mode")
-		} else {
-			log.Printf("[WS] Entered copy mode successfully")
-			h.hub.SendToSession(session.Name, "status", "Entered copy mode")
+			h.hub.SendError(client, msg.ID, websocket.CodeCopyModeFailed, "Failed to enter copy mode")
+			return
 		}
+		log.Printf("[WS] Entered copy mode successfully")
+		h.succeed(client, session, msg, "Entered copy mode")
 
-	case "exit_copy_mode":
+	case websocket.TypeExitCopyMode:
 		// 退出 tmux copy mode
 		log.Printf("[WS] Exiting copy mode for session %s", session.Name)
 		if err := session.ExitCopyMode(); err != nil {
 			log.Printf("[WS] Failed to exit copy mode: %v", err)
-			h.hub.SendToSession(session.Name, "error", "Failed to exit copy mode")
-		} else {
-			log.Printf("[WS] Exited copy mode successfully")
-			h.hub.SendToSession(session.Name, "status", "Exited copy mode")
+			h.hub.SendError(client, msg.ID, websocket.CodeCopyModeFailed, "Failed to exit copy mode")
+			return
 		}
+		log.Printf("[WS] Exited copy mode successfully")
+		h.succeed(client, session, msg, "Exited copy mode")
 
-	case "scroll_up":
-		// 在 copy mode 中向上滚动
-		lines, _ := msg["lines"].(float64)
-		if lines == 0 {
+	case websocket.TypeScrollUp, websocket.TypeScrollDown:
+		// 在 copy mode 中滚动
+		lines := msg.Lines
+		if lines <= 0 {
 			lines = 1
 		}
-		log.Printf("[WS] Scrolling up %.0f lines in copy mode for session %s", lines, session.Name)
-		if err := session.ScrollUp(int(lines)); err != nil {
-			log.Printf("[WS] Failed to scroll up: %v", err)
-			h.hub.SendToSession(session.Name, "error", "Failed to scroll up")
+		scroll, direction := session.ScrollUp, "up"
+		if msg.Type == websocket.TypeScrollDown {
+			scroll, direction = session.ScrollDown, "down"
 		}
-
-	case "scroll_down":
-		// 在 copy mode 中向下滚动
-		lines, _ := msg["lines"].(float64)
-		if lines == 0 {
-			lines = 1
-		}
-		log.Printf("[WS] Scrolling down %.0f lines in copy mode for session %s", lines, session.Name)
-		if err := session.ScrollDown(int(lines)); err != nil {
-			log.Printf("[WS] Failed to scroll down: %v", err)
-			h.hub.SendToSession(session.Name, "error", "Failed to scroll down")
+		log.Printf("[WS] Scrolling %s %d lines in copy mode for session %s", direction, lines, session.Name)
+		if err := scroll(lines); err != nil {
+			log.Printf("[WS] Failed to scroll %s: %v", direction, err)
+			h.hub.SendError(client, msg.ID, websocket.CodeScrollFailed, "Failed to scroll "+direction)
+			return
 		}
+		h.hub.Ack(client, msg.ID, nil)
 
-	case "resize":
+	case websocket.TypeResize:
 		// 处理终端大小调整（暂未实现）
-		log.Printf("[WS] Resize requested: %+v", msg)
+		log.Printf("[WS] Resize requested: %s", msg.Data)
+		if msg.ID != "" {
+			h.hub.SendError(client, msg.ID, websocket.CodeUnsupported, "Resize is not supported")
+		}
 
-	case "ping":
-		h.hub.SendToSession(session.Name, "pong", nil)
+	case websocket.TypePing:
+		h.hub.Reply(client, websocket.Message{Type: websocket.TypePong, ID: msg.ID})
 
 	default:
-		log.Printf("[WS] Unknown message type: %s", msgType)
+		log.Printf("[WS] Unknown message type: %s", msg.Type)
+		h.hub.SendError(client, msg.ID, websocket.CodeUnknownType, "Unknown message type: "+msg.Type)
+	}
+}
+
+// succeed 回复请求成功：带 id 的请求回复 ack，否则发送 status 通知
+func (h *WebSocketHandler) succeed(client *websocket.Client, session *tmux.Session, msg websocket.ClientMessage, status string) {
+	if msg.ID != "" {
+		h.hub.Ack(client, msg.ID, status)
+		return
 	}
+	h.hub.SendToSession(session.Name, websocket.TypeStatus, status)
 }
@@ -20,15 +20,20 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoliu10/remote-code/internal/auth"
+	"github.com/xiaoliu10/remote-code/internal/users"
 )
 
-// AuthMiddleware JWT 认证中间件
-func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
+// AuthMiddleware JWT 认证中间件，allowQueryToken 为 false 时不接受 ?token= 查询参数
+//
+// 用户被删除或停用后，已签发的 token 立即失效；角色以用户存储中的为准。
+// 推送、定时任务和匹配规则同样在使用时查询用户，已建立的终端连接由 UserHandler 断开
+func AuthMiddleware(jwtManager *auth.JWTManager, userStore *users.Store, allowQueryToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tokenString string
 
@@ -45,7 +50,7 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			}
 			tokenString = parts[1]
 		} else {
-			// 尝试从查询参数获取 token（用于 WebSocket 连接）
+			// 尝试从查询参数获取 token（用于 EventSource 等无法设置请求头的客户端）
 			tokenString = c.Query("token")
 			if tokenString == "" {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -53,6 +58,13 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 				})
 				return
 			}
+			if !allowQueryToken {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "query token authentication is disabled, use the Authorization header or a connection ticket",
+					"code":  "QUERY_TOKEN_DISABLED",
+				})
+				return
+			}
 		}
 
 		claims, err := jwtManager.Verify(tokenString)
@@ -63,13 +75,110 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			return
 		}
 
-		// 将用户信息存入 context
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
+		if !refreshClaims(c, userStore, claims) {
+			return
+		}
+
+		setClaims(c, claims)
 		c.Next()
 	}
 }
 
+// TicketScope 从请求中得出票据的用途
+type TicketScope func(c *gin.Context) string
+
+// SessionTicket 票据绑定路由参数 param 指定的会话
+func SessionTicket(param string) TicketScope {
+	return func(c *gin.Context) string {
+		return auth.SessionScope(c.Param(param))
+	}
+}
+
+// EventsTicket 票据用于事件流
+func EventsTicket(c *gin.Context) string {
+	return auth.ScopeEvents
+}
+
+// TicketAuth 一次性连接票据认证中间件
+//
+// 票据从 ?ticket= 读取，必须与 scope 得出的用途和客户端 IP 匹配。
+// 请求没有票据时交给 fallback 认证，fallback 为 nil 表示只接受票据。
+// 与 AuthMiddleware 一样，用户状态和角色在使用票据时从用户存储查询
+func TicketAuth(tickets *auth.TicketStore, userStore *users.Store, scope TicketScope, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("ticket")
+		if id == "" {
+			if fallback != nil {
+				fallback(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing ticket",
+				"code":  "TICKET_REQUIRED",
+			})
+			return
+		}
+
+		claims, err := tickets.Redeem(id, scope(c), c.ClientIP())
+		if err != nil {
+			log.Printf("[Auth] Rejected ticket for %s from %s", scope(c), c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+				"code":  "INVALID_TICKET",
+			})
+			return
+		}
+
+		if !refreshClaims(c, userStore, claims) {
+			return
+		}
+
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// refreshClaims 按用户存储的当前状态校验认证信息并刷新用户名和角色，失败时已写入响应
+func refreshClaims(c *gin.Context, userStore *users.Store, claims *auth.Claims) bool {
+	user, err := userStore.Get(claims.UserID)
+	if err != nil || !user.Enabled {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "account disabled or removed",
+			"code":  "ACCOUNT_DISABLED",
+		})
+		return false
+	}
+	// 修改密码后之前签发的令牌失效
+	if claims.Version != user.TokenVersion {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "token has been revoked",
+			"code":  "TOKEN_REVOKED",
+		})
+		return false
+	}
+	claims.Username = user.Username
+	claims.Role = user.Role
+	return true
+}
+
+// setClaims 将用户信息存入 context
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("token_version", claims.Version)
+}
+
+// GetClaims 从 context 还原当前用户的认证信息
+func GetClaims(c *gin.Context) *auth.Claims {
+	return &auth.Claims{
+		UserID:   GetUserID(c),
+		Username: GetUsername(c),
+		Role:     c.GetString("role"),
+		Version:  c.GetInt("token_version"),
+	}
+}
+
 // GetUserID 从 context 获取用户 ID
 func GetUserID(c *gin.Context) string {
 	if userID, exists := c.Get("user_id"); exists {
@@ -78,6 +187,11 @@ func GetUserID(c *gin.Context) string {
 	return ""
 }
 
+// IsAdmin 判断当前用户是否为管理员
+func IsAdmin(c *gin.Context) bool {
+	return c.GetString("role") == auth.RoleAdmin
+}
+
 // GetUsername 从 context 获取用户名
 func GetUsername(c *gin.Context) string {
 	if username, exists := c.Get("username"); exists {
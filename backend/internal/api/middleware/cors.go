@@ -20,19 +20,28 @@
 package middleware
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/security"
 )
 
-// CORS 跨域中间件
-func CORS() gin.HandlerFunc {
+// CORS 跨域中间件，只为白名单中的来源返回 CORS 头，其他带 Origin 的请求（包括预检）直接拒绝
+func CORS(origins *security.OriginPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.GetHeader("Origin")
+		c.Writer.Header().Add("Vary", "Origin")
 
-		// 生产环境应该设置允许的域名白名单
-		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		if origin != "" {
+			if !origins.Allowed(c.Request) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed", "code": "ORIGIN_NOT_ALLOWED"})
+				return
+			}
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		}
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -21,43 +21,77 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoliu10/remote-code/internal/agent"
 	"github.com/xiaoliu10/remote-code/internal/api/handlers"
 	"github.com/xiaoliu10/remote-code/internal/api/middleware"
 	"github.com/xiaoliu10/remote-code/internal/auth"
 	"github.com/xiaoliu10/remote-code/internal/config"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/push"
+	"github.com/xiaoliu10/remote-code/internal/scheduler"
 	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/snippets"
+	"github.com/xiaoliu10/remote-code/internal/terminal"
 	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
+	"github.com/xiaoliu10/remote-code/internal/users"
+	"github.com/xiaoliu10/remote-code/internal/webhook"
 	"github.com/xiaoliu10/remote-code/internal/websocket"
 )
 
 // RouterConfig 路由配置
 type RouterConfig struct {
-	JWTManager    *auth.JWTManager
-	TmuxManager   *tmux.Manager
-	Validator     *security.SessionValidator
-	Hub           *websocket.Hub
-	AdminPassword string
-	Config        *config.Config
+	JWTManager  *auth.JWTManager
+	TmuxManager *tmux.Manager
+	Validator   *security.SessionValidator
+	Hub         *websocket.Hub
+	EventBus    *events.Bus
+	Triggers    *triggers.Engine
+	Scheduler   *scheduler.Scheduler
+	Snippets    *snippets.Store
+	History     *history.Store
+	Detector    *agent.Detector
+	Terminal    *terminal.Tracker
+	Renderer    *terminal.Renderer
+	Webhooks    *webhook.Dispatcher
+	Push        *push.Notifier // 为 nil 表示未启用推送
+	Users       *users.Store
+	Config      *config.Config
 }
 
 // SetupRouter 设置路由
 func SetupRouter(cfg *RouterConfig) *gin.Engine {
 	router := gin.Default()
 
+	// 来源白名单，CORS 和 WebSocket 升级共用
+	origins := security.NewOriginPolicy(cfg.Config.Security.AllowedOrigins, cfg.Config.Security.FrontendPort)
+
 	// 中间件
-	router.Use(middleware.CORS())
+	router.Use(middleware.CORS(origins))
+	jwtAuth := middleware.AuthMiddleware(cfg.JWTManager, cfg.Users, cfg.Config.Auth.QueryToken)
+	tickets := auth.NewTicketStore(cfg.Config.WebSocket.TicketTTL)
 
 	// 创建 handlers
-	authHandler := handlers.NewAuthHandler(cfg.JWTManager, cfg.AdminPassword)
-	sessionHandler := handlers.NewSessionHandler(cfg.TmuxManager, cfg.Validator)
-	wsHandler := handlers.NewWebSocketHandler(cfg.Hub, cfg.TmuxManager)
+	authHandler := handlers.NewAuthHandler(cfg.JWTManager, cfg.Users, cfg.EventBus)
+	userHandler := handlers.NewUserHandler(cfg.Users, cfg.Hub)
+	sessionHandler := handlers.NewSessionHandler(cfg.TmuxManager, cfg.Validator, cfg.Detector, cfg.History)
+	wsHandler := handlers.NewWebSocketHandler(cfg.Hub, cfg.TmuxManager, cfg.EventBus, cfg.Snippets, cfg.Validator, cfg.History, origins, tickets)
+	eventsHandler := handlers.NewEventsHandler(cfg.EventBus, origins, tickets)
+	triggerHandler := handlers.NewTriggerHandler(cfg.Triggers, cfg.TmuxManager, cfg.Validator)
+	scheduleHandler := handlers.NewScheduleHandler(cfg.Scheduler, cfg.TmuxManager, cfg.Validator)
+	snippetHandler := handlers.NewSnippetHandler(cfg.Snippets, cfg.TmuxManager, cfg.Validator, cfg.History)
+	agentHandler := handlers.NewAgentHandler(cfg.Detector, cfg.TmuxManager)
+	screenHandler := handlers.NewScreenHandler(cfg.Terminal, cfg.Renderer, cfg.TmuxManager)
+	webhookHandler := handlers.NewWebhookHandler(cfg.Webhooks)
+	pushHandler := handlers.NewPushHandler(cfg.Push)
 
 	// 创建文件处理器
 	pathValidator, err := handlers.NewPathValidator(cfg.Config.Security.AllowedWorkDir)
 	if err != nil {
 		panic("failed to create path validator: " + err.Error())
 	}
-	fileHandler := handlers.NewFileHandler(pathValidator)
+	fileHandler := handlers.NewFileHandler(pathValidator, cfg.EventBus)
 
 	// 公开路由
 	public := router.Group("/api")
@@ -67,22 +101,106 @@ func SetupRouter(cfg *RouterConfig) *gin.Engine {
 
 	// 需要 JWT 认证的路由
 	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTManager))
+	protected.Use(jwtAuth)
 	{
 		// 认证相关
 		protected.GET("/auth/validate", authHandler.ValidateToken)
+		protected.POST("/auth/password", authHandler.ChangePassword)
+
+		// 用户账号（仅管理员）
+		protected.GET("/users", userHandler.ListUsers)
+		protected.POST("/users", userHandler.CreateUser)
+		protected.GET("/users/:id", userHandler.GetUser)
+		protected.PUT("/users/:id", userHandler.UpdateUser)
+		protected.DELETE("/users/:id", userHandler.DeleteUser)
 
 		// 会话管理
 		protected.POST("/sessions", sessionHandler.CreateSession)
 		protected.GET("/sessions", sessionHandler.ListSessions)
 		protected.GET("/sessions/:name", sessionHandler.GetSession)
+		protected.PATCH("/sessions/:name", sessionHandler.UpdateSession)
 		protected.DELETE("/sessions/:name", sessionHandler.DeleteSession)
 		protected.GET("/sessions/:name/output", sessionHandler.GetSessionOutput)
 		protected.POST("/sessions/:name/command", sessionHandler.SendCommand)
 		protected.GET("/sessions/:name/stream", sessionHandler.StreamOutput)
+		protected.GET("/sessions/:name/snapshot", sessionHandler.GetSnapshot)
+		protected.POST("/sessions/:name/snapshot", sessionHandler.SnapshotSession)
+		protected.POST("/sessions/:name/rename", sessionHandler.RenameSession)
+		protected.GET("/sessions/:name/alerts", sessionHandler.GetSessionAlerts)
+		protected.POST("/sessions/:name/alerts/ack", sessionHandler.AckSessionAlerts)
+		protected.GET("/alerts", sessionHandler.ListAlerts)
+		protected.GET("/sessions/:name/history", sessionHandler.GetHistory)
+		protected.POST("/sessions/:name/history/:id/rerun", sessionHandler.RerunCommand)
+
+		// 输出匹配规则
+		protected.GET("/triggers", triggerHandler.ListTriggers)
+		protected.POST("/triggers", triggerHandler.CreateTrigger)
+		protected.GET("/triggers/:id", triggerHandler.GetTrigger)
+		protected.PUT("/triggers/:id", triggerHandler.UpdateTrigger)
+		protected.DELETE("/triggers/:id", triggerHandler.DeleteTrigger)
+
+		// 定时命令
+		protected.GET("/schedules", scheduleHandler.ListSchedules)
+		protected.POST("/schedules", scheduleHandler.CreateSchedule)
+		protected.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		protected.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+		protected.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+		protected.POST("/schedules/:id/enable", scheduleHandler.EnableSchedule)
+		protected.POST("/schedules/:id/disable", scheduleHandler.DisableSchedule)
+		protected.POST("/schedules/:id/run", scheduleHandler.RunSchedule)
+		protected.GET("/schedules/:id/runs", scheduleHandler.ListScheduleRuns)
+
+		// 命令片段
+		protected.GET("/snippets", snippetHandler.ListSnippets)
+		protected.POST("/snippets", snippetHandler.CreateSnippet)
+		protected.GET("/snippets/export", snippetHandler.ExportSnippets)
+		protected.POST("/snippets/import", snippetHandler.ImportSnippets)
+		protected.GET("/snippets/:id", snippetHandler.GetSnippet)
+		protected.PUT("/snippets/:id", snippetHandler.UpdateSnippet)
+		protected.DELETE("/snippets/:id", snippetHandler.DeleteSnippet)
+		protected.POST("/snippets/:id/execute", snippetHandler.ExecuteSnippet)
+
+		// AI 代理等待批准的提示
+		protected.GET("/sessions/:name/prompt", agentHandler.GetPrompt)
+		protected.POST("/sessions/:name/prompt", agentHandler.RespondPrompt)
+		protected.GET("/agent/signatures", agentHandler.ListSignatures)
+
+		// 服务端终端屏幕模型
+		protected.GET("/sessions/:name/screen", screenHandler.GetScreen)
+		protected.GET("/sessions/:name/screen/search", screenHandler.SearchScreen)
+		protected.GET("/sessions/:name/screenshot", screenHandler.GetScreenshot)
+		protected.GET("/screenshot/themes", screenHandler.ListThemes)
+
+		// 出站 webhook（仅管理员）
+		protected.GET("/webhooks", webhookHandler.ListWebhooks)
+		protected.POST("/webhooks", webhookHandler.CreateWebhook)
+		protected.GET("/webhooks/dead-letters", webhookHandler.ListDeadLetters)
+		protected.GET("/webhooks/:id", webhookHandler.GetWebhook)
+		protected.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+		protected.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+		protected.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		protected.POST("/webhooks/:id/test", webhookHandler.TestWebhook)
 
-		// WebSocket
-		protected.GET("/ws/:session", wsHandler.HandleWebSocket)
+		// Web Push 通知
+		protected.GET("/push/vapid-public-key", pushHandler.GetPublicKey)
+		protected.GET("/push/subscriptions", pushHandler.ListSubscriptions)
+		protected.POST("/push/subscriptions", pushHandler.Subscribe)
+		protected.DELETE("/push/subscriptions", pushHandler.Unsubscribe)
+		protected.GET("/push/preferences", pushHandler.GetPreferences)
+		protected.PUT("/push/preferences", pushHandler.UpdatePreferences)
+		protected.POST("/push/test", pushHandler.TestPush)
+
+		// WebSocket 连接票据
+		protected.POST("/sessions/:name/ws-ticket", wsHandler.IssueTicket)
+
+		// 终端 I/O 回退传输（WebSocket 不可用时使用 SSE 或长轮询）
+		protected.GET("/sessions/:name/terminal", wsHandler.GetTransports)
+		protected.GET("/sessions/:name/terminal/poll", wsHandler.Poll)
+		protected.POST("/sessions/:name/terminal/input", wsHandler.SendInput)
+		protected.GET("/terminal/stats", wsHandler.GetStats)
+
+		// 服务端事件流的连接票据
+		protected.POST("/events/ticket", eventsHandler.IssueTicket)
 
 		// 文件系统操作
 		files := protected.Group("/files")
@@ -93,6 +211,18 @@ func SetupRouter(cfg *RouterConfig) *gin.Engine {
 		files.DELETE("", fileHandler.DeleteFileFolder)
 	}
 
+	// 浏览器无法为 WebSocket 和 EventSource 设置请求头，使用一次性票据认证；
+	// 终端 WebSocket 只接受票据，其余没有票据时按 JWT 认证
+	ticketed := router.Group("/api")
+	{
+		ticketed.GET("/ws/:session", middleware.TicketAuth(tickets, cfg.Users, middleware.SessionTicket("session"), nil), wsHandler.HandleWebSocket)
+		ticketed.GET("/sessions/:name/terminal/sse", middleware.TicketAuth(tickets, cfg.Users, middleware.SessionTicket("name"), jwtAuth), wsHandler.StreamSSE)
+
+		// 服务端事件流（SSE 与 WebSocket）
+		ticketed.GET("/events", middleware.TicketAuth(tickets, cfg.Users, middleware.EventsTicket, jwtAuth), eventsHandler.StreamSSE)
+		ticketed.GET("/events/ws", middleware.TicketAuth(tickets, cfg.Users, middleware.EventsTicket, jwtAuth), eventsHandler.StreamWebSocket)
+	}
+
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
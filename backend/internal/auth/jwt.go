@@ -26,9 +26,17 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// 用户角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
 type Claims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	Version  int    `json:"ver,omitempty"` // 签发时用户的令牌版本，修改密码后旧版本的令牌失效
 	jwt.RegisteredClaims
 }
 
@@ -41,10 +49,12 @@ func NewJWTManager(secretKey string, duration time.Duration) *JWTManager {
 	return &JWTManager{secretKey, duration}
 }
 
-func (m *JWTManager) Generate(userID, username string) (string, error) {
+func (m *JWTManager) Generate(userID, username, role string, version int) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
+		Role:     role,
+		Version:  version,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
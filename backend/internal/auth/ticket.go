@@ -0,0 +1,121 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTicket 票据不存在、已使用、已过期，或用途、客户端 IP 不匹配
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// ScopeEvents 事件流票据的用途，不绑定会话
+const ScopeEvents = "events"
+
+// SessionScope 终端连接票据的用途，绑定一个会话
+func SessionScope(session string) string {
+	return "session:" + session
+}
+
+// maxTickets 未使用票据的数量上限，超过后拒绝签发，防止内存被耗尽
+const maxTickets = 10000
+
+// ticket 一次性连接票据，绑定用途和客户端 IP
+type ticket struct {
+	claims    Claims
+	scope     string
+	clientIP  string
+	expiresAt time.Time
+}
+
+// TicketStore 一次性连接票据存储
+//
+// 浏览器建立 WebSocket 连接时无法设置 Authorization 头，先用 JWT 换取短期票据，
+// 再把票据放在查询参数中，避免长期有效的 JWT 出现在代理的访问日志里
+type TicketStore struct {
+	ttl     time.Duration
+	tickets map[string]*ticket
+	mu      sync.Mutex
+}
+
+// NewTicketStore 创建票据存储，ttl 为票据有效期
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]*ticket),
+	}
+}
+
+// TTL 票据有效期
+func (s *TicketStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue 为已认证的用户签发绑定用途和客户端 IP 的票据，scope 为 SessionScope 或 ScopeEvents
+func (s *TicketStore) Issue(claims *Claims, scope, clientIP string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, t := range s.tickets {
+		if now.After(t.expiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	if len(s.tickets) >= maxTickets {
+		return "", errors.New("too many pending tickets")
+	}
+
+	s.tickets[id] = &ticket{
+		claims: Claims{
+			UserID:   claims.UserID,
+			Username: claims.Username,
+			Role:     claims.Role,
+			Version:  claims.Version,
+		},
+		scope:     scope,
+		clientIP:  clientIP,
+		expiresAt: now.Add(s.ttl),
+	}
+	return id, nil
+}
+
+// Redeem 使用票据，无论校验是否通过票据都会失效
+func (s *TicketStore) Redeem(id, scope, clientIP string) (*Claims, error) {
+	s.mu.Lock()
+	t, ok := s.tickets[id]
+	delete(s.tickets, id)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(t.expiresAt) || t.scope != scope || t.clientIP != clientIP {
+		return nil, ErrInvalidTicket
+	}
+	return &t.claims, nil
+}
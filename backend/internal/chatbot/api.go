@@ -0,0 +1,175 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Telegram Bot API 的最小子集，任何兼容该接口的服务（包括测试用的本地替身）都可以使用
+
+const (
+	// maxMessageLength 单条消息的最大字符数
+	maxMessageLength = 4096
+	// maxCaptionLength 图片说明的最大字符数
+	maxCaptionLength = 1024
+)
+
+// Chat 会话（私聊或群组）
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// User 消息发送者
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username,omitempty"`
+}
+
+// Message 收到的消息
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from,omitempty"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// Update getUpdates 返回的更新
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+// apiResponse Bot API 的响应格式
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description,omitempty"`
+}
+
+// client Bot API 客户端
+type client struct {
+	baseURL string // 如 https://api.telegram.org/bot<token>
+	http    *http.Client
+}
+
+// newClient 创建 Bot API 客户端
+func newClient(apiURL, token string, httpClient *http.Client) *client {
+	return &client{
+		baseURL: strings.TrimRight(apiURL, "/") + "/bot" + token,
+		http:    httpClient,
+	}
+}
+
+// call 以 JSON 参数调用 Bot API 方法，result 为 nil 时忽略返回值
+func (c *client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.post(ctx, method, "application/json", bytes.NewReader(body), result)
+}
+
+// post 发送请求并解析 Bot API 的响应
+func (c *client) post(ctx context.Context, method, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// 不要在错误中暴露包含 token 的 URL
+		return fmt.Errorf("%s request failed: %w", method, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("%s returned status %d", method, resp.StatusCode)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("%s failed: %s", method, apiResp.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(apiResp.Result, result)
+	}
+	return nil
+}
+
+// getUpdates 长轮询获取新消息
+func (c *client) getUpdates(ctx context.Context, offset int64, timeoutSeconds int) ([]Update, error) {
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         timeoutSeconds,
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// sendMessage 发送 HTML 格式的消息，超长时截断
+func (c *client) sendMessage(ctx context.Context, chatID int64, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     truncate(text, maxMessageLength),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// sendPhoto 以 multipart 上传并发送 PNG 图片，caption 为 HTML 格式的说明，超长时截断
+func (c *client) sendPhoto(ctx context.Context, chatID int64, filename string, photo []byte, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		form.WriteField("caption", truncate(caption, maxCaptionLength))
+		form.WriteField("parse_mode", "HTML")
+	}
+	part, err := form.CreateFormFile("photo", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(photo); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.post(ctx, "sendPhoto", form.FormDataContentType(), &body, nil)
+}
+
+// truncate 把文本截断到 limit 个字符以内
+func truncate(text string, limit int) string {
+	if runes := []rune(text); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+	return text
+}
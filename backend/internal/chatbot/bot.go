@@ -0,0 +1,360 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/agent"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/security"
+	"github.com/xiaoliu10/remote-code/internal/terminal"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
+	"github.com/xiaoliu10/remote-code/internal/users"
+)
+
+const (
+	// retryDelay 轮询失败后的等待时间
+	retryDelay = 5 * time.Second
+	// sendTimeout 发送一条消息的超时时间
+	sendTimeout = 15 * time.Second
+)
+
+// Config 机器人配置
+type Config struct {
+	Token        string        // Bot token
+	APIURL       string        // Bot API 地址，测试时可指向本地替身
+	AllowedChats []int64       // 允许发送命令和接收提醒的 chat ID 白名单
+	UserID       string        // 机器人代表的用户 ID
+	PollTimeout  time.Duration // getUpdates 长轮询超时
+	Notify       bool          // 向白名单中的 chat 推送提醒
+	Screenshots  bool          // 提醒附带会话屏幕截图
+}
+
+// Bot 聊天机器人桥接：通过长轮询接收白名单 chat 的命令，并把会话提醒推送到这些 chat。
+// 机器人代表 Config.UserID 对应的用户，只能访问该用户可以访问的会话，所有输入与 SessionHandler.SendCommand 使用相同的校验
+type Bot struct {
+	cfg       Config
+	api       *client
+	allowed   map[int64]bool
+	manager   *tmux.Manager
+	validator *security.SessionValidator
+	detector  *agent.Detector
+	bus       *events.Bus
+	history   *history.Store
+	screens   *terminal.Tracker
+	renderer  *terminal.Renderer
+	users     *users.Store
+
+	// announced 最近一次推送或展示的提示 ID，批准时用于确认响应的是同一个提示
+	announced map[string]string
+	mu        sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBot 创建聊天机器人
+func NewBot(cfg Config, manager *tmux.Manager, validator *security.SessionValidator, detector *agent.Detector, bus *events.Bus,
+	historyStore *history.Store, screens *terminal.Tracker, renderer *terminal.Renderer, userStore *users.Store) *Bot {
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = 30 * time.Second
+	}
+	allowed := make(map[int64]bool, len(cfg.AllowedChats))
+	for _, id := range cfg.AllowedChats {
+		allowed[id] = true
+	}
+	return &Bot{
+		cfg: cfg,
+		// HTTP 超时需要比长轮询超时更长
+		api:       newClient(cfg.APIURL, cfg.Token, &http.Client{Timeout: cfg.PollTimeout + 10*time.Second}),
+		allowed:   allowed,
+		manager:   manager,
+		validator: validator,
+		detector:  detector,
+		bus:       bus,
+		history:   historyStore,
+		screens:   screens,
+		renderer:  renderer,
+		users:     userStore,
+		announced: make(map[string]string),
+	}
+}
+
+// Start 开始接收命令和推送提醒
+func (b *Bot) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	if len(b.allowed) == 0 {
+		log.Printf("[Chatbot] No allowed chats configured, all commands will be rejected")
+	}
+	if _, ok := b.account(); !ok {
+		log.Printf("[Chatbot] User %q not found or disabled, commands and alerts are unavailable until CHATBOT_USER_ID is set to an enabled user", b.cfg.UserID)
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.poll(ctx)
+	}()
+
+	if b.cfg.Notify {
+		ch, unsubscribe := b.bus.Subscribe(64)
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer unsubscribe()
+			for {
+				select {
+				case event := <-ch:
+					if !b.visible(event) {
+						continue
+					}
+					if text := b.formatEvent(event); text != "" {
+						b.notify(ctx, event, text)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	log.Printf("[Chatbot] Started with %d allowed chat(s)", len(b.allowed))
+}
+
+// Stop 停止机器人
+func (b *Bot) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+}
+
+// poll 长轮询接收消息并处理命令
+func (b *Bot) poll(ctx context.Context) {
+	var offset int64
+	timeout := int(b.cfg.PollTimeout.Seconds())
+
+	for ctx.Err() == nil {
+		updates, err := b.api.getUpdates(ctx, offset, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Chatbot] Failed to get updates: %v", err)
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Text == "" {
+				continue
+			}
+			b.handleMessage(ctx, update.Message)
+		}
+	}
+}
+
+// handleMessage 处理白名单 chat 的命令，其他 chat 的消息只记录日志
+func (b *Bot) handleMessage(ctx context.Context, msg *Message) {
+	if !b.allowed[msg.Chat.ID] {
+		log.Printf("[Chatbot] Ignored message from unauthorized chat %d", msg.Chat.ID)
+		return
+	}
+
+	// 截图以图片回复，不经过文本命令
+	if command, args := parseCommand(msg.Text); command == "shot" {
+		b.shot(ctx, msg.Chat.ID, args)
+		return
+	}
+
+	reply := b.execute(msg.Chat.ID, msg.Text)
+	if reply == "" {
+		return
+	}
+	b.send(ctx, msg.Chat.ID, reply)
+}
+
+// account 返回机器人代表的用户。用户的状态和角色在使用时查询，
+// 停用、删除或降级的账号立即不再能通过机器人访问会话
+func (b *Bot) account() (users.User, bool) {
+	if b.cfg.UserID == "" {
+		return users.User{}, false
+	}
+	user, err := b.users.Get(b.cfg.UserID)
+	if err != nil || !user.Enabled {
+		return users.User{}, false
+	}
+	return user, true
+}
+
+// visible 判断机器人代表的用户能否看到该事件：管理员看到全部，普通用户只看到自己会话的事件
+func (b *Bot) visible(event events.Event) bool {
+	user, ok := b.account()
+	if !ok {
+		return false
+	}
+	if user.IsAdmin() {
+		return true
+	}
+	return !event.Type.AdminOnly() && event.Owner != "" && event.Owner == user.ID
+}
+
+// notify 推送提醒。开启截图时附带会话当前屏幕，截图失败时只发送文字
+func (b *Bot) notify(ctx context.Context, event events.Event, text string) {
+	if !b.cfg.Screenshots || event.Type == events.SessionExited {
+		b.broadcast(ctx, text)
+		return
+	}
+	session, err := b.manager.GetSession(event.Session)
+	if err != nil {
+		b.broadcast(ctx, text)
+		return
+	}
+	photo, err := b.screenshot(session)
+	if err != nil {
+		log.Printf("[Chatbot] Failed to capture screen of session %s: %v", session.Name, err)
+		b.broadcast(ctx, text)
+		return
+	}
+	for chatID := range b.allowed {
+		b.sendPhoto(ctx, chatID, session.Name, photo, text)
+	}
+}
+
+// broadcast 向所有白名单 chat 发送消息
+func (b *Bot) broadcast(ctx context.Context, text string) {
+	for chatID := range b.allowed {
+		b.send(ctx, chatID, text)
+	}
+}
+
+// send 发送消息，失败只记录日志
+func (b *Bot) send(ctx context.Context, chatID int64, text string) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	if err := b.api.sendMessage(ctx, chatID, text); err != nil {
+		log.Printf("[Chatbot] Failed to send message to chat %d: %v", chatID, err)
+	}
+}
+
+// sendPhoto 发送会话截图，失败时改为发送文字说明
+func (b *Bot) sendPhoto(ctx context.Context, chatID int64, session string, photo []byte, caption string) {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	if err := b.api.sendPhoto(sendCtx, chatID, session+".png", photo, caption); err != nil {
+		log.Printf("[Chatbot] Failed to send screenshot to chat %d: %v", chatID, err)
+		b.send(ctx, chatID, caption)
+	}
+}
+
+// formatEvent 把需要提醒的事件格式化为消息，其他事件返回空字符串
+func (b *Bot) formatEvent(event events.Event) string {
+	name := html.EscapeString(event.Session)
+
+	switch event.Type {
+	case events.SessionAlert:
+		alert, ok := event.Data.(tmux.Alert)
+		if !ok || alert.Kind != tmux.AlertBell {
+			return ""
+		}
+		return fmt.Sprintf("🔔 Bell in <b>%s</b> (window %d)", name, alert.Window)
+
+	case events.TriggerFired:
+		firing, ok := event.Data.(triggers.Firing)
+		if !ok || firing.Action != triggers.ActionNotify {
+			return ""
+		}
+		text := firing.Message
+		if text == "" {
+			text = firing.Line
+		}
+		return fmt.Sprintf("📣 <b>%s</b> · %s\n%s", html.EscapeString(firing.RuleName), name, html.EscapeString(text))
+
+	case events.AgentPrompt:
+		prompt, ok := event.Data.(*agent.PendingPrompt)
+		if !ok {
+			return ""
+		}
+		b.remember(prompt)
+		return formatPrompt(prompt)
+
+	case events.SessionExited:
+		return fmt.Sprintf("⏹ Session <b>%s</b> exited", name)
+	}
+	return ""
+}
+
+// remember 记录已展示给用户的提示
+func (b *Bot) remember(prompt *agent.PendingPrompt) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.announced[prompt.Session] = prompt.ID
+}
+
+// announcedPrompt 返回最近展示给用户的提示 ID
+func (b *Bot) announcedPrompt(session string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.announced[session]
+}
+
+// formatPrompt 格式化等待批准的提示及可用的命令
+func formatPrompt(prompt *agent.PendingPrompt) string {
+	name := html.EscapeString(prompt.Session)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⏳ <b>%s</b> is waiting for approval\n", name)
+	if len(prompt.Context) > 0 {
+		fmt.Fprintf(&sb, "<pre>%s</pre>\n", html.EscapeString(strings.Join(prompt.Context, "\n")))
+	}
+	fmt.Fprintf(&sb, "%s\n", html.EscapeString(prompt.Question))
+	for _, option := range prompt.Options {
+		fmt.Fprintf(&sb, "  %s. %s\n", html.EscapeString(option.Key), html.EscapeString(option.Label))
+	}
+	fmt.Fprintf(&sb, "\n/approve %s · /deny %s · /choose %s &lt;option&gt;", name, name, name)
+	return sb.String()
+}
+
+// unwrapURLError 去掉 url.Error 中包含 token 的请求地址
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,322 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xiaoliu10/remote-code/internal/agent"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/terminal"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+const (
+	// defaultTailLines /tail 默认返回的行数
+	defaultTailLines = 20
+	// maxTailLines /tail 最多返回的行数
+	maxTailLines = 100
+	// maxTailChars /tail 输出的最大字符数，保证消息不超过长度限制
+	maxTailChars = 3500
+)
+
+const helpText = `<b>Remote Code</b>
+/sessions - list sessions
+/tail &lt;session&gt; [lines] - show the last lines of output (default 20)
+/shot &lt;session&gt; - send a screenshot of the screen
+/send &lt;session&gt; &lt;text&gt; - type text and press Enter
+/prompt &lt;session&gt; - show the pending approval prompt
+/approve &lt;session&gt; - approve the pending prompt
+/deny &lt;session&gt; - deny the pending prompt
+/choose &lt;session&gt; &lt;option&gt; - choose an option of the pending prompt`
+
+// execute 执行一条命令并返回回复内容
+func (b *Bot) execute(chatID int64, text string) string {
+	command, args := parseCommand(text)
+
+	switch command {
+	case "start", "help":
+		return helpText
+	case "sessions", "list":
+		return b.listSessions()
+	case "tail":
+		return b.tail(args)
+	case "send":
+		return b.sendCommand(chatID, text)
+	case "prompt":
+		return b.showPrompt(args)
+	case "approve":
+		return b.respond(args, agent.ActionApprove)
+	case "deny":
+		return b.respond(args, agent.ActionDeny)
+	case "choose":
+		return b.respond(args, agent.ActionChoose)
+	case "":
+		return ""
+	}
+	return "Unknown command. Send /help for the list of commands."
+}
+
+// parseCommand 解析 "/command@botname arg1 arg2"，不是命令的消息返回空命令
+func parseCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil
+	}
+	command := strings.TrimPrefix(fields[0], "/")
+	if i := strings.Index(command, "@"); i >= 0 {
+		command = command[:i]
+	}
+	return strings.ToLower(command), fields[1:]
+}
+
+// cutField 切出第一个空白分隔的字段，返回字段和去掉前导空白的剩余部分
+func cutField(s string) (string, string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+}
+
+// unavailableReply 机器人没有可用的用户账号时的回复
+const unavailableReply = "The bot is not linked to an enabled user. Set CHATBOT_USER_ID on the server."
+
+// lookupSession 获取机器人代表的用户可以访问的会话，失败时返回回复内容
+func (b *Bot) lookupSession(name string) (*tmux.Session, string) {
+	user, ok := b.account()
+	if !ok {
+		return nil, unavailableReply
+	}
+	session, err := b.manager.GetAccessibleSession(name, user.ID, user.IsAdmin())
+	if err != nil {
+		return nil, fmt.Sprintf("Session <b>%s</b> not found.", html.EscapeString(name))
+	}
+	return session, ""
+}
+
+// listSessions 列出机器人代表的用户可以访问的会话及其未读提醒和等待中的提示
+func (b *Bot) listSessions() string {
+	user, ok := b.account()
+	if !ok {
+		return unavailableReply
+	}
+	var sessions []*tmux.Session
+	for _, session := range b.manager.ListSessions() {
+		if session.AccessibleBy(user.ID, user.IsAdmin()) {
+			sessions = append(sessions, session)
+		}
+	}
+	if len(sessions) == 0 {
+		return "No sessions."
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+
+	var sb strings.Builder
+	sb.WriteString("<b>Sessions</b>\n")
+	for _, session := range sessions {
+		status := "⚪"
+		if session.IsActive() {
+			status = "🟢"
+		}
+		fmt.Fprintf(&sb, "%s %s", status, html.EscapeString(session.Name))
+		if count := b.manager.UnreadAlertCount(session.Name); count > 0 {
+			fmt.Fprintf(&sb, " · 🔔 %d", count)
+		}
+		if b.detector.Pending(session.Name) != nil {
+			sb.WriteString(" · ⏳ waiting for approval")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// tail 返回会话最近的输出
+func (b *Bot) tail(args []string) string {
+	if len(args) == 0 {
+		return "Usage: /tail &lt;session&gt; [lines]"
+	}
+	session, reply := b.lookupSession(args[0])
+	if session == nil {
+		return reply
+	}
+
+	lineCount := defaultTailLines
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return "Usage: /tail &lt;session&gt; [lines]"
+		}
+		lineCount = min(n, maxTailLines)
+	}
+
+	lines, err := session.TailLines(lineCount)
+	if err != nil {
+		return "Failed to read output."
+	}
+	output := strings.Join(lines, "\n")
+	if runes := []rune(output); len(runes) > maxTailChars {
+		output = "…" + string(runes[len(runes)-maxTailChars:])
+	}
+	if strings.TrimSpace(output) == "" {
+		return fmt.Sprintf("<b>%s</b>: no output.", html.EscapeString(session.Name))
+	}
+	return fmt.Sprintf("<b>%s</b>\n<pre>%s</pre>", html.EscapeString(session.Name), html.EscapeString(output))
+}
+
+// shot 发送会话可见屏幕的截图
+func (b *Bot) shot(ctx context.Context, chatID int64, args []string) {
+	if len(args) == 0 {
+		b.send(ctx, chatID, "Usage: /shot &lt;session&gt;")
+		return
+	}
+	session, reply := b.lookupSession(args[0])
+	if session == nil {
+		b.send(ctx, chatID, reply)
+		return
+	}
+
+	photo, err := b.screenshot(session)
+	if err != nil {
+		log.Printf("[Chatbot] Failed to capture screen of session %s: %v", session.Name, err)
+		b.send(ctx, chatID, "Failed to capture the screen.")
+		return
+	}
+	b.sendPhoto(ctx, chatID, session.Name, photo, fmt.Sprintf("<b>%s</b>", html.EscapeString(session.Name)))
+}
+
+// screenshot 以默认选项把会话的可见屏幕渲染为 PNG
+func (b *Bot) screenshot(session *tmux.Session) ([]byte, error) {
+	screen, err := b.screens.Screen(session)
+	if err != nil {
+		return nil, err
+	}
+	_, rows := screen.Size()
+	snap, err := screen.Snapshot(0, rows-1)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Title == "" {
+		snap.Title = session.Name
+	}
+
+	var buf bytes.Buffer
+	if err := b.renderer.Render(&buf, terminal.FormatPNG, snap, b.renderer.Defaults()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendCommand 输入文本并回车，与 SessionHandler.SendCommand 使用相同的校验
+func (b *Bot) sendCommand(chatID int64, text string) string {
+	// 保留文本中的空格，只去掉命令和会话名
+	_, rest := cutField(strings.TrimSpace(text))
+	name, command := cutField(rest)
+	if name == "" || strings.TrimSpace(command) == "" {
+		return "Usage: /send &lt;session&gt; &lt;text&gt;"
+	}
+
+	if err := b.validator.SanitizeCommand(command); err != nil {
+		return "Rejected: " + html.EscapeString(err.Error())
+	}
+	session, reply := b.lookupSession(name)
+	if session == nil {
+		return reply
+	}
+
+	if err := session.SendCommand(command); err != nil {
+		return "Failed to send command."
+	}
+	if _, err := b.history.Record(history.Entry{
+		Session: session.Name,
+		Command: command,
+		UserID:  fmt.Sprintf("chat:%d", chatID),
+		Source:  history.SourceChatbot,
+	}); err != nil {
+		log.Printf("[Chatbot] Failed to record command for session %s: %v", session.Name, err)
+	}
+	return fmt.Sprintf("Sent to <b>%s</b>.", html.EscapeString(session.Name))
+}
+
+// showPrompt 展示会话中等待批准的提示
+func (b *Bot) showPrompt(args []string) string {
+	if len(args) == 0 {
+		return "Usage: /prompt &lt;session&gt;"
+	}
+	session, reply := b.lookupSession(args[0])
+	if session == nil {
+		return reply
+	}
+
+	prompt := b.detector.Refresh(session)
+	if prompt == nil {
+		return fmt.Sprintf("<b>%s</b> has no pending prompt.", html.EscapeString(session.Name))
+	}
+	b.remember(prompt)
+	return formatPrompt(prompt)
+}
+
+// respond 响应等待批准的提示。只响应最近展示给用户的提示，提示已变化时展示新提示
+func (b *Bot) respond(args []string, action agent.Action) string {
+	if len(args) == 0 || (action == agent.ActionChoose && len(args) < 2) {
+		if action == agent.ActionChoose {
+			return "Usage: /choose &lt;session&gt; &lt;option&gt;"
+		}
+		return fmt.Sprintf("Usage: /%s &lt;session&gt;", action)
+	}
+	session, reply := b.lookupSession(args[0])
+	if session == nil {
+		return reply
+	}
+
+	option := ""
+	if action == agent.ActionChoose {
+		option = args[1]
+	}
+
+	promptID := b.announcedPrompt(session.Name)
+	if promptID == "" {
+		// 用户还没看到过提示，先展示而不是直接响应
+		return b.showPrompt(args[:1])
+	}
+
+	keys, err := b.detector.Respond(session, action, option, promptID)
+	switch err {
+	case nil:
+		return fmt.Sprintf("✅ %s sent to <b>%s</b> (%s).", action, html.EscapeString(session.Name), html.EscapeString(strings.Join(keys, " ")))
+	case agent.ErrNoPendingPrompt:
+		return fmt.Sprintf("<b>%s</b> has no pending prompt.", html.EscapeString(session.Name))
+	case agent.ErrPromptChanged:
+		return "The prompt has changed, nothing was sent.\n\n" + b.showPrompt(args[:1])
+	case agent.ErrUnknownOption:
+		return "That option is not available in this prompt."
+	}
+	return "Failed to send keys."
+}
@@ -29,10 +29,17 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Auth     AuthConfig
-	Security SecurityConfig
-	Tmux     TmuxConfig
+	Server    ServerConfig
+	Auth      AuthConfig
+	Security  SecurityConfig
+	Tmux      TmuxConfig
+	Agent     AgentConfig
+	Webhook   WebhookConfig
+	Push      PushConfig
+	Chatbot   ChatbotConfig
+	History   HistoryConfig
+	Render    RenderConfig
+	WebSocket WebSocketConfig
 }
 
 type ServerConfig struct {
@@ -45,19 +52,74 @@ type AuthConfig struct {
 	JWTSecret     string
 	TokenDuration time.Duration
 	AdminPassword string // 默认管理员密码
+	QueryToken    bool   // 是否接受 ?token= 查询参数中的 JWT，令牌会出现在代理的访问日志中
 }
 
 type SecurityConfig struct {
 	MaxSessionsPerUser int
 	AllowedWorkDir     string
 	EnableRateLimit    bool
-	RateLimitRPS       int // 每秒请求数
-	RateLimitBurst     int // 突发请求数
+	RateLimitRPS       int      // 每秒请求数
+	RateLimitBurst     int      // 突发请求数
+	AllowedOrigins     []string // 允许跨域访问的来源，支持 https://*.example.com，默认只允许同源
+	FrontendPort       string   // 前端开发服务器端口，同主机该端口的来源视为同源
 }
 
 type TmuxConfig struct {
-	SocketPath      string // tmux socket 路径
-	ScrollbackLines int    // 终端历史缓冲区行数
+	SocketPath        string        // tmux socket 路径
+	ScrollbackLines   int           // 终端历史缓冲区行数
+	SnapshotInterval  time.Duration // 会话快照间隔，0 表示禁用定期快照
+	ReconcileInterval time.Duration // 与 tmux 服务对账的间隔，0 表示禁用
+	MonitorBell       bool          // 开启 monitor-bell，响铃时产生提醒
+	MonitorActivity   bool          // 开启 monitor-activity，窗口有输出时产生提醒
+	MonitorSilence    time.Duration // monitor-silence，窗口无输出超过该时长时产生提醒，0 表示禁用
+}
+
+type AgentConfig struct {
+	PromptDetection bool          // 检测 AI 代理等待批准的提示
+	DetectInterval  time.Duration // 检测周期
+	SignaturesFile  string        // 自定义提示签名文件（JSON），为空时使用数据目录下的 prompt_signatures.json
+}
+
+type WebhookConfig struct {
+	MaxAttempts int           // 最多尝试次数（含首次），用尽后写入死信日志
+	RetryBase   time.Duration // 首次重试间隔，之后每次翻倍
+	Timeout     time.Duration // 单次请求超时
+}
+
+type PushConfig struct {
+	Enabled bool   // 启用 Web Push 通知
+	Subject string // VAPID 联系方式（mailto: 或 https: URL），推送服务出问题时用于联系
+}
+
+type ChatbotConfig struct {
+	Token        string  // Bot token，为空表示不启用聊天机器人
+	APIURL       string  // Telegram 兼容的 Bot API 地址
+	AllowedChats []int64 // 允许发送命令的 chat ID 白名单
+	UserID       string  // 机器人代表的用户 ID，只能访问该用户可以访问的会话
+	Notify       bool    // 向白名单中的 chat 推送提醒
+	Screenshots  bool    // 提醒附带会话屏幕截图
+}
+
+type HistoryConfig struct {
+	MaxEntries int           // 每个会话保留的命令条数
+	Retention  time.Duration // 命令保留时长，0 表示不按时间清理
+}
+
+type RenderConfig struct {
+	Theme      string // 默认配色
+	ThemesFile string // 自定义配色文件（JSON），为空时使用数据目录下的 render_themes.json
+	FontFamily string // SVG/HTML 截图使用的字体
+	FontSize   int    // 字号（像素）
+	CellWidth  int    // 单元格宽度（像素），0 表示按字号计算
+	LineHeight int    // 行高（像素），0 表示按字号计算
+	Padding    int    // 四周留白（像素）
+}
+
+type WebSocketConfig struct {
+	ResumeFrames int           // 每个会话为断线重连保留的消息条数
+	ResumeTTL    time.Duration // 会话没有连接后保留重连缓冲区的时长
+	TicketTTL    time.Duration // 一次性连接票据的有效期
 }
 
 func Load() *Config {
@@ -74,17 +136,65 @@ func Load() *Config {
 			JWTSecret:     getEnv("JWT_SECRET", "change-me-in-production-please"),
 			TokenDuration: 24 * time.Hour,
 			AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
+			QueryToken:    getEnvBool("AUTH_QUERY_TOKEN", false),
 		},
 		Security: SecurityConfig{
-			MaxSessionsPerUser: 10,
+			MaxSessionsPerUser: getEnvInt("MAX_SESSIONS_PER_USER", 10),
 			AllowedWorkDir:     getEnv("ALLOWED_DIR", os.Getenv("HOME")),
 			EnableRateLimit:    getEnvBool("RATE_LIMIT_ENABLED", true),
 			RateLimitRPS:       getEnvInt("RATE_LIMIT_RPS", 10),
 			RateLimitBurst:     getEnvInt("RATE_LIMIT_BURST", 20),
+			AllowedOrigins:     getEnvList("ALLOWED_ORIGINS"),
+			FrontendPort:       getEnv("FRONTEND_PORT", "5173"),
 		},
 		Tmux: TmuxConfig{
-			SocketPath:      getEnv("TMUX_SOCKET", ""),
-			ScrollbackLines: getEnvInt("TERMINAL_SCROLLBACK", 1000),
+			SocketPath:        getEnv("TMUX_SOCKET", ""),
+			ScrollbackLines:   getEnvInt("TERMINAL_SCROLLBACK", 1000),
+			SnapshotInterval:  time.Duration(getEnvInt("SNAPSHOT_INTERVAL", 300)) * time.Second,
+			ReconcileInterval: time.Duration(getEnvInt("RECONCILE_INTERVAL", 5)) * time.Second,
+			MonitorBell:       getEnvBool("MONITOR_BELL", true),
+			MonitorActivity:   getEnvBool("MONITOR_ACTIVITY", true),
+			MonitorSilence:    time.Duration(getEnvInt("MONITOR_SILENCE", 0)) * time.Second,
+		},
+		Agent: AgentConfig{
+			PromptDetection: getEnvBool("AGENT_PROMPT_DETECTION", true),
+			DetectInterval:  time.Duration(getEnvInt("AGENT_DETECT_INTERVAL_MS", 1000)) * time.Millisecond,
+			SignaturesFile:  getEnv("AGENT_SIGNATURES_FILE", ""),
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 6),
+			RetryBase:   time.Duration(getEnvInt("WEBHOOK_RETRY_BASE", 5)) * time.Second,
+			Timeout:     time.Duration(getEnvInt("WEBHOOK_TIMEOUT", 10)) * time.Second,
+		},
+		Push: PushConfig{
+			Enabled: getEnvBool("PUSH_ENABLED", true),
+			Subject: getEnv("PUSH_SUBJECT", "mailto:admin@localhost"),
+		},
+		Chatbot: ChatbotConfig{
+			Token:        getEnv("CHATBOT_TOKEN", ""),
+			APIURL:       getEnv("CHATBOT_API_URL", "https://api.telegram.org"),
+			AllowedChats: getEnvInt64List("CHATBOT_ALLOWED_CHATS"),
+			UserID:       getEnv("CHATBOT_USER_ID", ""),
+			Notify:       getEnvBool("CHATBOT_NOTIFY", true),
+			Screenshots:  getEnvBool("CHATBOT_SCREENSHOTS", false),
+		},
+		History: HistoryConfig{
+			MaxEntries: getEnvInt("HISTORY_MAX_ENTRIES", 1000),
+			Retention:  time.Duration(getEnvInt("HISTORY_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		},
+		Render: RenderConfig{
+			Theme:      getEnv("RENDER_THEME", "dark"),
+			ThemesFile: getEnv("RENDER_THEMES_FILE", ""),
+			FontFamily: getEnv("RENDER_FONT_FAMILY", "Menlo, Consolas, 'DejaVu Sans Mono', monospace"),
+			FontSize:   getEnvInt("RENDER_FONT_SIZE", 14),
+			CellWidth:  getEnvInt("RENDER_CELL_WIDTH", 0),
+			LineHeight: getEnvInt("RENDER_LINE_HEIGHT", 0),
+			Padding:    getEnvInt("RENDER_PADDING", 10),
+		},
+		WebSocket: WebSocketConfig{
+			ResumeFrames: getEnvInt("WS_RESUME_FRAMES", 256),
+			ResumeTTL:    time.Duration(getEnvInt("WS_RESUME_TTL", 300)) * time.Second,
+			TicketTTL:    time.Duration(getEnvInt("WS_TICKET_TTL", 30)) * time.Second,
 		},
 	}
 }
@@ -141,6 +251,27 @@ func getEnvBool(key string, defaultVal bool) bool {
 	return defaultVal
 }
 
+func getEnvInt64List(key string) []int64 {
+	var list []int64
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		var i int64
+		if _, err := fmt.Sscanf(strings.TrimSpace(item), "%d", &i); err == nil {
+			list = append(list, i)
+		}
+	}
+	return list
+}
+
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvInt(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
 		var i int
@@ -0,0 +1,193 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Type 事件类型
+type Type string
+
+// 会话生命周期事件
+const (
+	SessionCreated     Type = "session.created"
+	SessionDeleted     Type = "session.deleted"
+	SessionRenamed     Type = "session.renamed"
+	SessionExited      Type = "session.exited"
+	SessionRestored    Type = "session.restored"
+	SessionAlert       Type = "session.alert"        // tmux 响铃/活动/静默提醒
+	AlertsAcked        Type = "session.alerts_acked" // 提醒已被确认
+	ClientAttached     Type = "client.attached"
+	ClientDetached     Type = "client.detached"
+	FileChanged        Type = "file.changed"
+	TriggerFired       Type = "trigger.fired"        // 输出匹配规则被触发
+	AgentPrompt        Type = "agent.prompt"         // AI 代理等待批准
+	AgentPromptCleared Type = "agent.prompt_cleared" // 等待批准的提示已消失
+	ServerRestarted    Type = "tmux.server_restarted"
+	LoginFailed        Type = "auth.login_failed" // 登录失败，仅管理员可见
+)
+
+// AllTypes 所有事件类型，用于校验订阅过滤条件
+var AllTypes = []Type{
+	SessionCreated, SessionDeleted, SessionRenamed, SessionExited, SessionRestored,
+	SessionAlert, AlertsAcked, ClientAttached, ClientDetached, FileChanged,
+	TriggerFired, AgentPrompt, AgentPromptCleared, ServerRestarted, LoginFailed,
+}
+
+// AdminOnly 判断该类型的事件是否只允许管理员接收
+func (t Type) AdminOnly() bool {
+	return t == LoginFailed
+}
+
+// DefaultHistorySize 事件总线默认保留的历史事件数量，用于断线续传
+const DefaultHistorySize = 1024
+
+// Event 内部事件
+type Event struct {
+	Seq     uint64      `json:"seq"`
+	Type    Type        `json:"type"`
+	Session string      `json:"session,omitempty"`
+	Owner   string      `json:"owner,omitempty"` // 事件所属用户（会话所有者或文件操作者），用于按用户过滤
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Bus 进程内事件总线，为每个事件分配递增的序列号并保留最近的历史，
+// 发布方不会因订阅方处理缓慢而阻塞
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[int]chan Event
+	nextID      int
+	seq         uint64
+	history     []Event // 环形缓冲区
+	historyPos  int
+	historySize int
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return NewBusWithHistory(DefaultHistorySize)
+}
+
+// NewBusWithHistory 创建保留指定数量历史事件的事件总线
+func NewBusWithHistory(size int) *Bus {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &Bus{
+		subscribers: make(map[int]chan Event),
+		history:     make([]Event, 0, size),
+		historySize: size,
+	}
+}
+
+// Publish 发布事件，订阅方缓冲区已满时丢弃该事件
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.Seq = b.seq
+
+	if len(b.history) < b.historySize {
+		b.history = append(b.history, event)
+	} else {
+		b.history[b.historyPos] = event
+		b.historyPos = (b.historyPos + 1) % b.historySize
+	}
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[Events] Subscriber %d is too slow, dropped %s event #%d", id, event.Type, event.Seq)
+		}
+	}
+}
+
+// LastSeq 返回最近一个事件的序列号
+func (b *Bus) LastSeq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Subscribe 订阅所有新事件，返回事件 channel 和取消订阅函数
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	_, ch, _, cancel := b.SubscribeFrom(0, buffer)
+	return ch, cancel
+}
+
+// SubscribeFrom 订阅序列号大于 afterSeq 的事件。backlog 为仍保留在历史中的遗漏事件；
+// 当 afterSeq 之后的部分事件已被淘汰时 complete 为 false，调用方应通知客户端全量刷新。
+// afterSeq 为 0 表示只订阅新事件
+func (b *Bus) SubscribeFrom(afterSeq uint64, buffer int) (backlog []Event, ch <-chan Event, complete bool, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if afterSeq > 0 && afterSeq < b.seq {
+		ordered := b.orderedHistoryLocked()
+		if len(ordered) == 0 || ordered[0].Seq > afterSeq+1 {
+			complete = false
+		}
+		for _, event := range ordered {
+			if event.Seq > afterSeq {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	id := b.nextID
+	b.nextID++
+	sub := make(chan Event, buffer)
+	b.subscribers[id] = sub
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+			close(sub)
+		})
+	}
+	return backlog, sub, complete, cancel
+}
+
+// orderedHistoryLocked 按序列号顺序返回历史事件（调用方需持有锁）
+func (b *Bus) orderedHistoryLocked() []Event {
+	ordered := make([]Event, 0, len(b.history))
+	if len(b.history) < b.historySize {
+		return append(ordered, b.history...)
+	}
+	ordered = append(ordered, b.history[b.historyPos:]...)
+	return append(ordered, b.history[:b.historyPos]...)
+}
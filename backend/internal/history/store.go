@@ -0,0 +1,375 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+)
+
+// Source 命令的来源
+type Source string
+
+const (
+	SourceREST     Source = "rest"     // POST /api/sessions/:name/command
+	SourceWS       Source = "ws"       // 终端 WebSocket（含 SSE/长轮询回退）的 command 消息
+	SourceSnippet  Source = "snippet"  // 执行命令片段
+	SourceSchedule Source = "schedule" // 定时任务
+	SourceChatbot  Source = "chatbot"  // 聊天机器人 /send
+)
+
+// 默认保留策略
+const (
+	DefaultMaxEntries = 1000
+	DefaultRetention  = 30 * 24 * time.Hour
+	// MaxQueryLimit 单次查询最多返回的条数
+	MaxQueryLimit = 500
+)
+
+var (
+	ErrEntryNotFound = errors.New("history entry not found")
+)
+
+// Entry 一条命令记录
+type Entry struct {
+	ID      string    `json:"id"`
+	Session string    `json:"session"`
+	Command string    `json:"command"`
+	UserID  string    `json:"user_id"`
+	Source  Source    `json:"source"`
+	Ref     string    `json:"ref,omitempty"` // 片段 ID、定时任务 ID 或重新执行的记录 ID
+	Time    time.Time `json:"time"`
+}
+
+// Filter 查询条件，零值字段表示不过滤
+type Filter struct {
+	Query  string // 命令中包含的文本（不区分大小写）
+	UserID string
+	Source Source
+	Since  time.Time
+	Until  time.Time
+	Before string // 分页游标：只返回该记录之前的记录
+	Limit  int
+}
+
+// Options 保留策略
+type Options struct {
+	MaxEntries int           // 每个会话保留的最多条数
+	Retention  time.Duration // 保留时长，0 表示不按时间清理
+}
+
+// Store 会话命令历史，每个会话一个 JSON Lines 文件，保存在数据目录的 history/ 下
+type Store struct {
+	dir      string
+	opts     Options
+	sessions map[string][]Entry // 会话名 -> 记录（旧的在前）
+	lastID   int64              // 最近一条记录的 ID 序号，保证 ID 递增不重复
+	mu       sync.RWMutex
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewStore 创建历史存储并加载已保存的记录
+func NewStore(dataDir string, opts Options) (*Store, error) {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	s := &Store{
+		dir:      filepath.Join(dataDir, "history"),
+		opts:     opts,
+		sessions: make(map[string][]Entry),
+		stop:     make(chan struct{}),
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		entries, err := readEntries(file)
+		if err != nil {
+			return nil, fmt.Errorf("load history of session %s: %w", name, err)
+		}
+		s.sessions[name] = entries
+	}
+	s.prune(time.Now())
+	return s, nil
+}
+
+// readEntries 读取 JSON Lines 文件，跳过写入中断导致的损坏行
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// path 返回会话的历史文件路径
+func (s *Store) path(session string) string {
+	return filepath.Join(s.dir, url.PathEscape(session)+".jsonl")
+}
+
+// rewriteLocked 用内存中的记录重写会话的历史文件（调用方需持有锁）
+func (s *Store) rewriteLocked(session string) error {
+	entries := s.sessions[session]
+	if len(entries) == 0 {
+		err := os.Remove(s.path(session))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	tmp := s.path(session) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(session))
+}
+
+// Record 追加一条命令记录。超出条数上限一定比例后才压缩文件，避免每次写入都重写
+func (s *Store) Record(entry Entry) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Time = time.Now()
+	s.lastID = max(s.lastID+1, entry.Time.UnixNano())
+	entry.ID = fmt.Sprintf("cmd_%d", s.lastID)
+
+	entries := append(s.sessions[entry.Session], entry)
+	s.sessions[entry.Session] = entries
+
+	if len(entries) > s.opts.MaxEntries+s.opts.MaxEntries/10 {
+		s.sessions[entry.Session] = append([]Entry(nil), entries[len(entries)-s.opts.MaxEntries:]...)
+		return entry, s.rewriteLocked(entry.Session)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	file, err := os.OpenFile(s.path(entry.Session), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return entry, err
+}
+
+// visible 返回会话中未超出保留策略的记录（调用方需持有锁）
+func (s *Store) visible(session string, now time.Time) []Entry {
+	entries := s.sessions[session]
+	if len(entries) > s.opts.MaxEntries {
+		entries = entries[len(entries)-s.opts.MaxEntries:]
+	}
+	if s.opts.Retention > 0 {
+		cutoff := now.Add(-s.opts.Retention)
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].Time.After(cutoff)
+		})
+		entries = entries[i:]
+	}
+	return entries
+}
+
+// Query 按条件查询会话的记录（新的在前），返回结果以及是否还有更早的记录
+func (s *Store) Query(session string, filter Filter) ([]Entry, bool) {
+	if filter.Limit <= 0 || filter.Limit > MaxQueryLimit {
+		filter.Limit = MaxQueryLimit
+	}
+	query := strings.ToLower(filter.Query)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.visible(session, time.Now())
+	result := make([]Entry, 0, min(filter.Limit, len(entries)))
+	skipping := filter.Before != ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if skipping {
+			if entry.ID == filter.Before {
+				skipping = false
+			}
+			continue
+		}
+		if (filter.UserID != "" && entry.UserID != filter.UserID) ||
+			(filter.Source != "" && entry.Source != filter.Source) ||
+			(!filter.Since.IsZero() && entry.Time.Before(filter.Since)) ||
+			(!filter.Until.IsZero() && entry.Time.After(filter.Until)) ||
+			(query != "" && !strings.Contains(strings.ToLower(entry.Command), query)) {
+			continue
+		}
+		if len(result) == filter.Limit {
+			return result, true
+		}
+		result = append(result, entry)
+	}
+	return result, false
+}
+
+// Get 获取会话中的指定记录
+func (s *Store) Get(session, id string) (Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.visible(session, time.Now()) {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrEntryNotFound
+}
+
+// prune 按保留策略清理所有会话的记录并重写有变化的文件
+func (s *Store) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for session, entries := range s.sessions {
+		kept := s.visible(session, now)
+		if len(kept) == len(entries) {
+			continue
+		}
+		if len(kept) == 0 {
+			delete(s.sessions, session)
+		} else {
+			s.sessions[session] = append([]Entry(nil), kept...)
+		}
+		if err := s.rewriteLocked(session); err != nil {
+			log.Printf("[History] Failed to prune history of session %s: %v", session, err)
+		}
+	}
+}
+
+// renameSession 会话重命名后移动其历史记录
+func (s *Store) renameSession(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, ok := s.sessions[oldName]
+	if !ok {
+		return nil
+	}
+	delete(s.sessions, oldName)
+	for i := range entries {
+		entries[i].Session = newName
+	}
+	s.sessions[newName] = append(s.sessions[newName], entries...)
+	sort.SliceStable(s.sessions[newName], func(i, j int) bool {
+		return s.sessions[newName][i].Time.Before(s.sessions[newName][j].Time)
+	})
+
+	if err := s.rewriteLocked(oldName); err != nil {
+		return err
+	}
+	return s.rewriteLocked(newName)
+}
+
+// removeSession 删除会话的历史记录
+func (s *Store) removeSession(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[name]; !ok {
+		return nil
+	}
+	delete(s.sessions, name)
+	return s.rewriteLocked(name)
+}
+
+// Start 定期按保留策略清理
+func (s *Store) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				s.prune(now)
+			}
+		}
+	}()
+}
+
+// SessionChanged 跟随会话的重命名、删除和退出维护历史记录，注册为 tmux.Manager 的会话钩子。
+// 历史按会话名称存储，会话退出后同名的新会话可能属于其他用户，因此退出时一并删除
+func (s *Store) SessionChanged(eventType events.Type, name, oldName string) {
+	var err error
+	switch eventType {
+	case events.SessionRenamed:
+		err = s.renameSession(oldName, name)
+	case events.SessionDeleted, events.SessionExited:
+		err = s.removeSession(name)
+	}
+	if err != nil {
+		log.Printf("[History] Failed to update history of session %s: %v", name, err)
+	}
+}
+
+// Stop 停止清理
+func (s *Store) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
@@ -0,0 +1,351 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/agent"
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/triggers"
+	"github.com/xiaoliu10/remote-code/internal/users"
+)
+
+const (
+	// pushTTL 推送服务在设备离线时保留消息的秒数
+	pushTTL = 24 * time.Hour
+	// pushTimeout 请求推送服务的超时时间
+	pushTimeout = 15 * time.Second
+	// maxConcurrentSends 同时进行的推送请求数
+	maxConcurrentSends = 8
+)
+
+// Kind 通知类型，对应用户偏好中的开关
+type Kind string
+
+const (
+	KindBell        Kind = "bell"
+	KindTrigger     Kind = "trigger"
+	KindAgentPrompt Kind = "agent_prompt"
+	KindSessionExit Kind = "session_exit"
+	KindTest        Kind = "test"
+)
+
+// Notification 推送给浏览器的通知内容，由 Service Worker 展示
+type Notification struct {
+	Kind    Kind      `json:"kind"`
+	Title   string    `json:"title"`
+	Body    string    `json:"body"`
+	Tag     string    `json:"tag,omitempty"` // 相同 tag 的通知互相替换
+	Session string    `json:"session,omitempty"`
+	URL     string    `json:"url,omitempty"` // 点击通知后打开的页面
+	Time    time.Time `json:"time"`
+}
+
+// Result 向单个订阅推送的结果
+type Result struct {
+	Endpoint   string `json:"endpoint"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Removed    bool   `json:"removed,omitempty"` // 订阅已失效并被删除
+}
+
+// Notifier 订阅事件总线，把用户选择的事件以 Web Push 推送到其浏览器
+type Notifier struct {
+	store   *Store
+	bus     *events.Bus
+	keys    *VAPIDKeys
+	subject string
+	users   *users.Store
+	client  *http.Client
+	sem     chan struct{}
+	cancel  func()
+	wg      sync.WaitGroup
+}
+
+// NewNotifier 创建推送通知器，subject 为推送服务联系方式（mailto: 或 https: URL）
+func NewNotifier(store *Store, bus *events.Bus, keys *VAPIDKeys, subject string, userStore *users.Store) *Notifier {
+	return &Notifier{
+		store:   store,
+		bus:     bus,
+		keys:    keys,
+		subject: subject,
+		users:   userStore,
+		client:  &http.Client{Timeout: pushTimeout},
+		sem:     make(chan struct{}, maxConcurrentSends),
+	}
+}
+
+// Store 返回订阅存储
+func (n *Notifier) Store() *Store {
+	return n.store
+}
+
+// PublicKey 返回浏览器订阅时使用的 VAPID 公钥
+func (n *Notifier) PublicKey() string {
+	return n.keys.PublicKey
+}
+
+// Start 开始订阅事件并推送
+func (n *Notifier) Start() {
+	ch, cancel := n.bus.Subscribe(64)
+	n.cancel = cancel
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		for event := range ch {
+			kind, notification, ok := notificationFor(event)
+			if !ok {
+				continue
+			}
+			for _, sub := range n.recipients(event.Owner, kind) {
+				n.wg.Add(1)
+				go func(sub Subscription) {
+					defer n.wg.Done()
+					n.send(sub, notification)
+				}(sub)
+			}
+		}
+	}()
+	log.Printf("[Push] Notifier started")
+}
+
+// Stop 停止推送并等待进行中的请求完成
+func (n *Notifier) Stop() {
+	if n.cancel != nil {
+		n.cancel()
+	}
+	n.wg.Wait()
+}
+
+// recipients 返回应收到通知的订阅：会话所有者和管理员中开启了该类型通知的用户
+//
+// 用户的状态和角色在发送时查询，停用、删除或降级的账号立即不再收到通知
+func (n *Notifier) recipients(owner string, kind Kind) []Subscription {
+	var subs []Subscription
+	for _, sub := range n.store.Subscriptions("") {
+		user, err := n.users.Get(sub.UserID)
+		if err != nil || !user.Enabled {
+			continue
+		}
+		if sub.UserID != owner && !user.IsAdmin() {
+			continue
+		}
+		if !n.store.Preferences(sub.UserID).allows(kind) {
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// allows 判断偏好是否开启了该类型的通知
+func (p Preferences) allows(kind Kind) bool {
+	switch kind {
+	case KindBell:
+		return p.Bell
+	case KindTrigger:
+		return p.Trigger
+	case KindAgentPrompt:
+		return p.AgentPrompt
+	case KindSessionExit:
+		return p.SessionExit
+	}
+	return false
+}
+
+// notificationFor 把事件转换为通知，不需要推送的事件返回 false
+func notificationFor(event events.Event) (Kind, Notification, bool) {
+	notification := Notification{
+		Session: event.Session,
+		URL:     "/app/sessions/" + url.PathEscape(event.Session),
+		Time:    event.Time,
+	}
+
+	switch event.Type {
+	case events.SessionAlert:
+		alert, ok := event.Data.(tmux.Alert)
+		if !ok || alert.Kind != tmux.AlertBell {
+			return "", Notification{}, false
+		}
+		notification.Kind = KindBell
+		notification.Title = "🔔 " + event.Session
+		notification.Body = "Bell in window " + strconv.Itoa(alert.Window)
+		if alert.WindowName != "" {
+			notification.Body += " (" + alert.WindowName + ")"
+		}
+		notification.Tag = "bell:" + event.Session
+
+	case events.TriggerFired:
+		firing, ok := event.Data.(triggers.Firing)
+		if !ok || firing.Action != triggers.ActionNotify {
+			return "", Notification{}, false
+		}
+		notification.Kind = KindTrigger
+		notification.Title = firing.RuleName + " · " + event.Session
+		notification.Body = firing.Message
+		if notification.Body == "" {
+			notification.Body = firing.Line
+		}
+		notification.Tag = "trigger:" + firing.RuleID + ":" + event.Session
+
+	case events.AgentPrompt:
+		prompt, ok := event.Data.(*agent.PendingPrompt)
+		if !ok {
+			return "", Notification{}, false
+		}
+		notification.Kind = KindAgentPrompt
+		notification.Title = "⏳ " + event.Session + " is waiting for approval"
+		notification.Body = prompt.Question
+		if len(prompt.Context) > 0 {
+			notification.Body = prompt.Context[len(prompt.Context)-1] + "\n" + prompt.Question
+		}
+		notification.Tag = "prompt:" + event.Session
+
+	case events.SessionExited:
+		notification.Kind = KindSessionExit
+		notification.Title = "Session " + event.Session + " exited"
+		notification.Body = "The tmux session is no longer running"
+		notification.Tag = "exit:" + event.Session
+		notification.URL = "/app/sessions"
+
+	default:
+		return "", Notification{}, false
+	}
+	return notification.Kind, notification, true
+}
+
+// Test 向用户的所有订阅发送测试通知并返回每个订阅的结果
+func (n *Notifier) Test(userID string) []Result {
+	notification := Notification{
+		Kind:  KindTest,
+		Title: "Remote Code",
+		Body:  "Push notifications are working",
+		Tag:   "test",
+		URL:   "/app/sessions",
+		Time:  time.Now(),
+	}
+
+	subs := n.store.Subscriptions(userID)
+	results := make([]Result, len(subs))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		wg.Add(1)
+		go func(i int, sub Subscription) {
+			defer wg.Done()
+			results[i] = n.send(sub, notification)
+		}(i, sub)
+	}
+	wg.Wait()
+	return results
+}
+
+// send 加密并推送通知，推送服务返回 404/410 时删除失效的订阅
+func (n *Notifier) send(sub Subscription, notification Notification) Result {
+	n.sem <- struct{}{}
+	defer func() { <-n.sem }()
+
+	result := Result{Endpoint: sub.Endpoint}
+	statusCode, err := n.post(sub, notification)
+	result.StatusCode = statusCode
+	if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+		if removeErr := n.store.Unsubscribe(sub.Endpoint, ""); removeErr == nil {
+			result.Removed = true
+			log.Printf("[Push] Removed expired subscription of user %s", sub.UserID)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("[Push] Failed to send %s notification to user %s: %v", notification.Kind, sub.UserID, err)
+	}
+	return result
+}
+
+// post 向推送服务发送一条加密消息
+func (n *Notifier) post(sub Subscription, notification Notification) (int, error) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) > MaxPayloadSize {
+		// 截断正文，保证消息能放进单条记录
+		notification.Body = truncate(notification.Body, len(notification.Body)-(len(payload)-MaxPayloadSize)-16)
+		if payload, err = json.Marshal(notification); err != nil {
+			return 0, err
+		}
+	}
+
+	body, err := encrypt(payload, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		return 0, err
+	}
+	authorization, err := n.keys.authorization(sub.Endpoint, n.subject)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		if message = bytes.TrimSpace(message); len(message) > 0 {
+			return resp.StatusCode, fmt.Errorf("push service returned status %d: %s", resp.StatusCode, message)
+		}
+		return resp.StatusCode, fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// truncate 按 rune 边界截断字符串
+func truncate(s string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "") + "…"
+}
@@ -0,0 +1,226 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 订阅字段限制
+const (
+	MaxEndpointLength       = 2048
+	MaxSubscriptionsPerUser = 20
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+	ErrTooManySubscriptions = fmt.Errorf("at most %d push subscriptions per user", MaxSubscriptionsPerUser)
+)
+
+// SubscriptionKeys 浏览器 PushSubscription 的加密密钥
+type SubscriptionKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// Subscription 一个浏览器的推送订阅，按推送服务地址区分
+type Subscription struct {
+	Endpoint  string           `json:"endpoint"`
+	Keys      SubscriptionKeys `json:"keys"`
+	UserID    string           `json:"user_id"`
+	UserAgent string           `json:"user_agent,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// Validate 校验订阅的推送地址和密钥
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" || len(s.Endpoint) > MaxEndpointLength {
+		return errors.New("endpoint must be an absolute https URL")
+	}
+	key, err := decodeKey(s.Keys.P256dh)
+	if err != nil || len(key) != 65 {
+		return errors.New("invalid p256dh key")
+	}
+	auth, err := decodeKey(s.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// Preferences 用户选择接收的通知类型
+type Preferences struct {
+	Bell        bool `json:"bell"`         // 后台会话响铃
+	Trigger     bool `json:"trigger"`      // 输出匹配规则的 notify 动作
+	AgentPrompt bool `json:"agent_prompt"` // AI 代理等待批准
+	SessionExit bool `json:"session_exit"` // 会话退出
+}
+
+// DefaultPreferences 未设置偏好的用户接收所有类型的通知
+func DefaultPreferences() Preferences {
+	return Preferences{Bell: true, Trigger: true, AgentPrompt: true, SessionExit: true}
+}
+
+// storeFile push.json 的内容
+type storeFile struct {
+	Subscriptions []*Subscription        `json:"subscriptions"`
+	Preferences   map[string]Preferences `json:"preferences"`
+}
+
+// Store 推送订阅和用户偏好存储，持久化到数据目录的 push.json
+type Store struct {
+	path          string
+	subscriptions map[string]*Subscription // endpoint -> 订阅
+	preferences   map[string]Preferences   // userID -> 偏好
+	mu            sync.RWMutex
+}
+
+// NewStore 创建推送存储并加载已保存的订阅
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path:          filepath.Join(dataDir, "push.json"),
+		subscriptions: make(map[string]*Subscription),
+		preferences:   make(map[string]Preferences),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, sub := range file.Subscriptions {
+		s.subscriptions[sub.Endpoint] = sub
+	}
+	for userID, prefs := range file.Preferences {
+		s.preferences[userID] = prefs
+	}
+	return s, nil
+}
+
+// saveLocked 写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	file := storeFile{
+		Subscriptions: s.listLocked(""),
+		Preferences:   s.preferences,
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按创建时间返回订阅，userID 为空时返回所有订阅（调用方需持有锁）
+func (s *Store) listLocked(userID string) []*Subscription {
+	subs := make([]*Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		if userID == "" || sub.UserID == userID {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+// Subscriptions 返回用户的订阅，userID 为空时返回所有订阅
+func (s *Store) Subscriptions(userID string) []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subs := make([]Subscription, 0)
+	for _, sub := range s.listLocked(userID) {
+		subs = append(subs, *sub)
+	}
+	return subs
+}
+
+// Subscribe 保存订阅，同一推送地址重复订阅时替换旧订阅（浏览器可能更换了密钥或登录用户）
+func (s *Store) Subscribe(sub Subscription) (Subscription, error) {
+	if err := sub.Validate(); err != nil {
+		return Subscription{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.subscriptions[sub.Endpoint]; !exists && len(s.listLocked(sub.UserID)) >= MaxSubscriptionsPerUser {
+		return Subscription{}, ErrTooManySubscriptions
+	}
+	sub.CreatedAt = time.Now()
+	s.subscriptions[sub.Endpoint] = &sub
+	if err := s.saveLocked(); err != nil {
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// Unsubscribe 删除订阅，userID 不为空时只能删除该用户的订阅
+func (s *Store) Unsubscribe(endpoint, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[endpoint]
+	if !ok || (userID != "" && sub.UserID != userID) {
+		return ErrSubscriptionNotFound
+	}
+	delete(s.subscriptions, endpoint)
+	return s.saveLocked()
+}
+
+// Preferences 返回用户的通知偏好
+func (s *Store) Preferences(userID string) Preferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if prefs, ok := s.preferences[userID]; ok {
+		return prefs
+	}
+	return DefaultPreferences()
+}
+
+// SetPreferences 保存用户的通知偏好
+func (s *Store) SetPreferences(userID string, prefs Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preferences[userID] = prefs
+	return s.saveLocked()
+}
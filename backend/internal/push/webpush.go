@@ -0,0 +1,243 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// recordSize aes128gcm 的记录大小，推送内容必须能放进单条记录
+	recordSize = 4096
+	// MaxPayloadSize 推送内容的最大字节数（记录大小减去填充分隔符和 GCM 标签）
+	MaxPayloadSize = recordSize - 17
+	// vapidTokenTTL VAPID JWT 的有效期（规范要求不超过 24 小时）
+	vapidTokenTTL = 12 * time.Hour
+)
+
+// b64 Web Push 使用的无填充 base64url 编码
+var b64 = base64.RawURLEncoding
+
+// VAPIDKeys 服务器的 VAPID 密钥对（P-256），公钥由浏览器订阅时使用
+type VAPIDKeys struct {
+	PublicKey  string `json:"public_key"`  // 未压缩的公钥点，base64url
+	PrivateKey string `json:"private_key"` // 私钥标量，base64url
+
+	private *ecdsa.PrivateKey
+}
+
+// LoadOrGenerateVAPIDKeys 从数据目录的 vapid.json 加载密钥，不存在时生成并保存
+func LoadOrGenerateVAPIDKeys(dataDir string) (*VAPIDKeys, error) {
+	path := filepath.Join(dataDir, "vapid.json")
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var keys VAPIDKeys
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, err
+		}
+		if err := keys.parse(); err != nil {
+			return nil, fmt.Errorf("invalid VAPID keys in %s: %w", path, err)
+		}
+		return &keys, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	public, err := private.PublicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	keys := &VAPIDKeys{
+		PublicKey:  b64.EncodeToString(public.Bytes()),
+		PrivateKey: b64.EncodeToString(private.D.FillBytes(make([]byte, 32))),
+		private:    private,
+	}
+
+	data, err = json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// parse 解析 base64url 编码的私钥并校验与公钥是否匹配
+func (k *VAPIDKeys) parse() error {
+	raw, err := b64.DecodeString(k.PrivateKey)
+	if err != nil {
+		return err
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return err
+	}
+	if b64.EncodeToString(ecdhKey.PublicKey().Bytes()) != k.PublicKey {
+		return errors.New("public key does not match private key")
+	}
+
+	curve := elliptic.P256()
+	private := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(raw)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(raw)
+	k.private = private
+	return nil
+}
+
+// authorization 生成推送服务要求的 VAPID Authorization 头（RFC 8292）
+func (k *VAPIDKeys) authorization(endpoint, subject string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTokenTTL).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, k.PublicKey), nil
+}
+
+// encrypt 按 RFC 8291（aes128gcm）加密推送内容
+func encrypt(plaintext []byte, p256dh, authSecret string) ([]byte, error) {
+	if len(plaintext) > MaxPayloadSize {
+		return nil, fmt.Errorf("payload exceeds %d bytes", MaxPayloadSize)
+	}
+
+	clientKeyBytes, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	clientKey, err := ecdh.P256().NewPublicKey(clientKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := decodeKey(authSecret)
+	if err != nil || len(auth) != 16 {
+		return nil, errors.New("invalid auth secret")
+	}
+
+	// 每条消息使用新的临时密钥对和随机盐
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := serverKey.ECDH(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), clientKeyBytes...)
+	keyInfo = append(keyInfo, serverPublic...)
+	ikm, err := expand(hkdf.Extract(sha256.New, shared, auth), keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 单条记录，0x02 为最后一条记录的分隔符
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	// 头部：salt(16) | rs(4) | idlen(1) | keyid(服务器临时公钥)
+	header := make([]byte, 0, 21+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// expand HKDF-Expand
+func expand(prk, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeKey 解码浏览器提供的密钥，兼容有无填充的 base64url 和标准 base64
+func decodeKey(value string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+		if data, err := encoding.DecodeString(value); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("invalid base64 encoding")
+}
@@ -0,0 +1,218 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchYears 查找下一次执行时间的范围，超过说明表达式永远不会匹配（如 2 月 30 日）
+const maxSearchYears = 5
+
+// Schedule 解析后的 cron 表达式（分 时 日 月 周）
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // 每个字段允许值的位图
+	domStar, dowStar              bool   // 日、周字段是否为 *（两者都有限制时满足其一即可）
+}
+
+// field 字段的取值范围和名称
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 周字段允许 0-7，0 和 7 都表示周日
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors 预定义的表达式
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron 解析标准 5 字段 cron 表达式，支持 *、列表、范围、步长、月份和星期名称以及 @daily 等预定义表达式
+func ParseCron(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if spec, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = spec
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	s := &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parse 解析一个字段，返回允许值的位图
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepSpec, f.name)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangeSpec == "*" || rangeSpec == "?":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangeSpec, "-"):
+			loSpec, hiSpec, _ := strings.Cut(rangeSpec, "-")
+			var err error
+			if lo, err = f.value(loSpec); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiSpec); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangeSpec, f.name)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rangeSpec); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// "5/15" 表示从 5 开始每 15 个单位
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value 解析单个数值或名称
+func (f field) value(spec string) (int, error) {
+	if v, ok := f.names[strings.ToLower(spec)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(spec)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field (expected %d-%d)", spec, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// dayMatches 判断日期是否满足日和周字段：两者都有限制时满足其一即可（与 cron 一致）
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next 返回 after 之后（不含）第一次匹配的时间，使用 after 所在的时区计算。
+// 表达式永远不会匹配时返回零值
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// 按绝对时间推进到下一个整点，夏令时切换时不会卡在同一小时；
+			// 不用 Truncate，它按 UTC 对齐，在半小时时区会出错
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		// 夏令时结束时同一钟点会出现两次，只执行第一次
+		if !wallClock(t).After(wallClock(after)) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// wallClock 返回不带时区偏移的本地钟点，用于比较夏令时重复的时段
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
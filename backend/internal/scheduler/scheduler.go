@@ -0,0 +1,270 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/history"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/users"
+)
+
+// 执行来源
+const (
+	TriggerSchedule = "schedule" // 按计划自动执行
+	TriggerManual   = "manual"   // 通过 API 立即执行
+)
+
+// outputLines 执行记录保存的输出行数
+const outputLines = 20
+
+// Scheduler 定时任务调度器：在任务到期时把命令发送到目标会话，并截取输出作为执行记录
+type Scheduler struct {
+	store   *Store
+	manager *tmux.Manager
+	history *history.Store
+	users   *users.Store
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+
+	// stopMu 保护 stopped，保证 Stop 开始等待后不再有新的 wg.Add
+	stopMu  sync.Mutex
+	stopped bool
+}
+
+// NewScheduler 创建调度器
+func NewScheduler(store *Store, manager *tmux.Manager, historyStore *history.Store, userStore *users.Store) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		manager: manager,
+		history: historyStore,
+		users:   userStore,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Store 返回任务存储
+func (s *Scheduler) Store() *Store {
+	return s.store
+}
+
+// Start 启动调度循环，并跟随会话的重命名、删除和退出维护绑定的任务
+func (s *Scheduler) Start() {
+	skipped, err := s.store.skipMissed(time.Now())
+	if err != nil {
+		log.Printf("[Scheduler] Failed to reschedule missed jobs: %v", err)
+	}
+	for _, id := range skipped {
+		log.Printf("[Scheduler] Skipped missed runs of job %s", id)
+	}
+
+	s.manager.AddSessionHook(s.sessionChanged)
+
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// sessionChanged 会话钩子：跟随会话的重命名、删除和退出维护绑定的任务
+func (s *Scheduler) sessionChanged(eventType events.Type, name, oldName string) {
+	var err error
+	switch eventType {
+	case events.SessionRenamed:
+		err = s.store.RenameSession(oldName, name)
+	case events.SessionDeleted:
+		err = s.store.RemoveSession(name)
+	case events.SessionExited:
+		err = s.store.DisableSession(name)
+	}
+	if err != nil {
+		log.Printf("[Scheduler] Failed to update jobs of session %s: %v", name, err)
+	}
+	s.Refresh()
+}
+
+// Stop 停止调度并等待正在截取输出的执行结束
+func (s *Scheduler) Stop() {
+	s.stopMu.Lock()
+	s.stopped = true
+	s.stopMu.Unlock()
+
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+}
+
+// Refresh 在任务变化后调用，让调度循环重新计算唤醒时间
+func (s *Scheduler) Refresh() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 调度循环：睡眠到最早的下一次执行时间，执行所有到期任务
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		for _, job := range s.store.due(now) {
+			s.run(job, TriggerSchedule)
+		}
+
+		delay := time.Hour
+		if next := s.store.nextWake(); !next.IsZero() {
+			delay = min(time.Until(next), delay)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(delay)
+
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// RunNow 立即执行任务，不影响计划的下一次执行时间
+func (s *Scheduler) RunNow(id string) (Run, error) {
+	job, err := s.store.Get(id)
+	if err != nil {
+		return Run{}, err
+	}
+	return s.run(job, TriggerManual), nil
+}
+
+// run 发送命令并记录执行，输出在 CaptureSeconds 之后异步截取
+func (s *Scheduler) run(job Job, trigger string) Run {
+	run := Run{
+		ID:        fmt.Sprintf("run_%d", time.Now().UnixNano()),
+		JobID:     job.ID,
+		Session:   job.Session,
+		Command:   job.Command,
+		Trigger:   trigger,
+		Status:    RunRunning,
+		StartedAt: time.Now(),
+	}
+
+	session, err := s.manager.GetSession(job.Session)
+	if err == nil {
+		err = s.checkOwner(job, session)
+	}
+	if err == nil {
+		err = session.SendCommand(job.Command)
+	}
+	if err != nil {
+		finished := time.Now()
+		run.Status = RunFailed
+		run.Error = err.Error()
+		run.FinishedAt = &finished
+	}
+
+	if err := s.store.startRun(job.ID, run); err != nil {
+		log.Printf("[Scheduler] Failed to record run of job %s: %v", job.ID, err)
+	}
+	if run.Status == RunFailed {
+		log.Printf("[Scheduler] Job %s (%s) failed: %s", job.ID, job.Name, run.Error)
+		return run
+	}
+	log.Printf("[Scheduler] Job %s (%s) sent to session %s", job.ID, job.Name, job.Session)
+	if _, err := s.history.Record(history.Entry{
+		Session: job.Session,
+		Command: job.Command,
+		UserID:  job.OwnerID,
+		Source:  history.SourceSchedule,
+		Ref:     job.ID,
+	}); err != nil {
+		log.Printf("[Scheduler] Failed to record command of job %s: %v", job.ID, err)
+	}
+
+	// 调度器已停止时（如 RunNow 与关闭并发）立即截取输出，不再启动新的协程
+	s.stopMu.Lock()
+	if s.stopped {
+		s.stopMu.Unlock()
+		s.capture(session, 0, run)
+		return run
+	}
+	s.wg.Add(1)
+	s.stopMu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		s.capture(session, job.captureDelay(), run)
+	}()
+	return run
+}
+
+// checkOwner 每次执行时检查任务所有者：账号被停用、删除，或失去会话的访问权限后任务不再执行
+func (s *Scheduler) checkOwner(job Job, session *tmux.Session) error {
+	owner, err := s.users.Get(job.OwnerID)
+	if err != nil || !owner.Enabled {
+		return errors.New("job owner is disabled or removed")
+	}
+	if !session.AccessibleBy(owner.ID, owner.IsAdmin()) {
+		return errors.New("job owner can no longer access the session")
+	}
+	return nil
+}
+
+// capture 等待命令输出后截取会话末尾的内容
+func (s *Scheduler) capture(session *tmux.Session, delay time.Duration, run Run) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.stop:
+	}
+
+	output, err := session.TailLines(outputLines)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err != nil {
+		run.Status = RunFailed
+		run.Error = fmt.Sprintf("capture output: %v", err)
+	} else {
+		run.Status = RunCompleted
+		run.Output = strings.Join(output, "\n")
+	}
+	if err := s.store.finishRun(run); err != nil {
+		log.Printf("[Scheduler] Failed to record output of job %s: %v", run.JobID, err)
+	}
+}
@@ -0,0 +1,494 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 任务字段限制
+const (
+	MaxNameLength      = 64
+	MaxCommandLength   = 4096
+	MaxCaptureSeconds  = 600
+	DefaultCaptureTime = 10 * time.Second
+	// MaxRunsPerJob 每个任务保留的执行记录数
+	MaxRunsPerJob = 50
+)
+
+var (
+	ErrJobNotFound = errors.New("scheduled job not found")
+)
+
+// Job 定时任务：按 cron 表达式周期执行，或在 RunAt 时刻执行一次
+type Job struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Session        string     `json:"session"`
+	Command        string     `json:"command"`                   // 输入到会话并回车的命令
+	Cron           string     `json:"cron,omitempty"`            // 周期任务的 cron 表达式，与 RunAt 二选一
+	RunAt          *time.Time `json:"run_at,omitempty"`          // 一次性任务的执行时间，执行后自动禁用
+	Timezone       string     `json:"timezone,omitempty"`        // IANA 时区，为空表示服务器本地时区
+	CaptureSeconds int        `json:"capture_seconds,omitempty"` // 执行后等待多少秒再截取输出，0 表示默认 10 秒
+	Enabled        bool       `json:"enabled"`
+	OwnerID        string     `json:"owner_id"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	schedule *Schedule
+	location *time.Location
+}
+
+// Validate 校验任务并解析 cron 表达式和时区
+func (j *Job) Validate() error {
+	if j.Name == "" || len(j.Name) > MaxNameLength {
+		return fmt.Errorf("name must be 1-%d characters", MaxNameLength)
+	}
+	if j.Session == "" {
+		return errors.New("session is required")
+	}
+	if j.Command == "" || len(j.Command) > MaxCommandLength {
+		return fmt.Errorf("command must be 1-%d characters", MaxCommandLength)
+	}
+	if j.CaptureSeconds < 0 || j.CaptureSeconds > MaxCaptureSeconds {
+		return fmt.Errorf("capture_seconds must be 0-%d", MaxCaptureSeconds)
+	}
+
+	loc := time.Local
+	if j.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(j.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone: %q", j.Timezone)
+		}
+	}
+
+	switch {
+	case j.Cron != "" && j.RunAt != nil:
+		return errors.New("cron and run_at are mutually exclusive")
+	case j.Cron != "":
+		schedule, err := ParseCron(j.Cron)
+		if err != nil {
+			return err
+		}
+		if schedule.Next(time.Now().In(loc)).IsZero() {
+			return errors.New("cron expression never matches")
+		}
+		j.schedule = schedule
+	case j.RunAt == nil:
+		return errors.New("either cron or run_at is required")
+	}
+
+	j.location = loc
+	return nil
+}
+
+// next 计算 after 之后的下一次执行时间，一次性任务已执行或已禁用时返回 nil
+func (j *Job) next(after time.Time) *time.Time {
+	if !j.Enabled {
+		return nil
+	}
+	if j.schedule == nil {
+		if j.RunAt == nil || (j.LastRunAt != nil && !j.LastRunAt.Before(*j.RunAt)) {
+			return nil
+		}
+		runAt := *j.RunAt
+		return &runAt
+	}
+	next := j.schedule.Next(after.In(j.location))
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// captureDelay 执行后截取输出前的等待时间
+func (j *Job) captureDelay() time.Duration {
+	if j.CaptureSeconds == 0 {
+		return DefaultCaptureTime
+	}
+	return time.Duration(j.CaptureSeconds) * time.Second
+}
+
+// RunStatus 执行状态
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"   // 命令已发送，等待截取输出
+	RunCompleted RunStatus = "completed" // 命令已发送并截取了输出
+	RunFailed    RunStatus = "failed"    // 会话不存在或发送失败
+)
+
+// Run 一次执行记录
+type Run struct {
+	ID         string     `json:"id"`
+	JobID      string     `json:"job_id"`
+	Session    string     `json:"session"`
+	Command    string     `json:"command"`
+	Trigger    string     `json:"trigger"` // schedule 或 manual
+	Status     RunStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Output     string     `json:"output,omitempty"` // 执行后截取的输出片段
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// storeFile schedules.json 的内容
+type storeFile struct {
+	Jobs []*Job           `json:"jobs"`
+	Runs map[string][]Run `json:"runs"`
+}
+
+// Store 任务和执行记录存储，持久化到数据目录的 schedules.json
+type Store struct {
+	path string
+	jobs map[string]*Job
+	runs map[string][]Run // jobID -> 执行记录（旧的在前）
+	mu   sync.RWMutex
+}
+
+// NewStore 创建任务存储并加载已保存的任务
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path: filepath.Join(dataDir, "schedules.json"),
+		jobs: make(map[string]*Job),
+		runs: make(map[string][]Run),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, job := range file.Jobs {
+		if err := job.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid scheduled job %s: %w", job.ID, err)
+		}
+		s.jobs[job.ID] = job
+	}
+	for jobID, runs := range file.Runs {
+		if _, ok := s.jobs[jobID]; ok {
+			s.runs[jobID] = runs
+		}
+	}
+	return s, nil
+}
+
+// saveLocked 写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(storeFile{Jobs: s.listLocked(), Runs: s.runs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按创建时间返回所有任务（调用方需持有锁）
+func (s *Store) listLocked() []*Job {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// List 返回所有任务的副本
+func (s *Store) List() []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.listLocked() {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// Get 获取指定任务
+func (s *Store) Get(id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Put 校验并保存任务，ID 为空时创建新任务。保存时重新计算下一次执行时间
+func (s *Store) Put(job Job) (Job, error) {
+	if err := job.Validate(); err != nil {
+		return Job{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job_%d", now.UnixNano())
+		job.CreatedAt = now
+		job.LastRunAt = nil
+	} else {
+		existing, ok := s.jobs[job.ID]
+		if !ok {
+			return Job{}, ErrJobNotFound
+		}
+		job.CreatedAt = existing.CreatedAt
+		job.OwnerID = existing.OwnerID
+		job.LastRunAt = existing.LastRunAt
+		// 修改一次性任务的执行时间后允许再次执行
+		if job.RunAt != nil && (existing.RunAt == nil || !job.RunAt.Equal(*existing.RunAt)) {
+			job.LastRunAt = nil
+		}
+	}
+	job.UpdatedAt = now
+	job.NextRunAt = job.next(now)
+
+	s.jobs[job.ID] = &job
+	if err := s.saveLocked(); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// SetEnabled 启用或禁用任务
+func (s *Store) SetEnabled(id string, enabled bool) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	// 复制后替换，调度器可能正在读取旧任务
+	job := *existing
+	job.Enabled = enabled
+	job.UpdatedAt = time.Now()
+	job.NextRunAt = job.next(job.UpdatedAt)
+	s.jobs[id] = &job
+	if err := s.saveLocked(); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// Delete 删除任务及其执行记录
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	delete(s.runs, id)
+	return s.saveLocked()
+}
+
+// Runs 返回任务的执行记录（新的在前）
+func (s *Store) Runs(jobID string) []Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.runs[jobID]
+	runs := make([]Run, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		runs = append(runs, history[i])
+	}
+	return runs
+}
+
+// startRun 记录一次执行，由调度触发时同时推进任务的下一次执行时间
+func (s *Store) startRun(jobID string, run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	job := *existing
+	job.LastRunAt = &run.StartedAt
+	if run.Trigger == TriggerSchedule {
+		job.NextRunAt = job.next(run.StartedAt)
+		if job.schedule == nil {
+			// 一次性任务执行后自动禁用
+			job.Enabled = false
+		}
+	}
+	s.jobs[jobID] = &job
+
+	runs := append(s.runs[jobID], run)
+	if len(runs) > MaxRunsPerJob {
+		runs = runs[len(runs)-MaxRunsPerJob:]
+	}
+	s.runs[jobID] = runs
+	return s.saveLocked()
+}
+
+// finishRun 更新执行记录的结果
+func (s *Store) finishRun(run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := s.runs[run.JobID]
+	for i := range runs {
+		if runs[i].ID == run.ID {
+			runs[i] = run
+			return s.saveLocked()
+		}
+	}
+	return nil
+}
+
+// due 返回到期的已启用任务
+func (s *Store) due(now time.Time) []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []Job
+	for _, job := range s.listLocked() {
+		if job.Enabled && job.NextRunAt != nil && !job.NextRunAt.After(now) {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// nextWake 返回最早的下一次执行时间，没有待执行的任务时返回零值
+func (s *Store) nextWake() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var earliest time.Time
+	for _, job := range s.jobs {
+		if job.Enabled && job.NextRunAt != nil && (earliest.IsZero() || job.NextRunAt.Before(earliest)) {
+			earliest = *job.NextRunAt
+		}
+	}
+	return earliest
+}
+
+// skipMissed 服务器停止期间错过的周期任务不补执行，从当前时间重新计算下一次执行时间
+func (s *Store) skipMissed(now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var skipped []string
+	for id, existing := range s.jobs {
+		if existing.schedule == nil || existing.NextRunAt == nil || !existing.NextRunAt.Before(now) {
+			continue
+		}
+		job := *existing
+		job.NextRunAt = job.next(now)
+		s.jobs[id] = &job
+		skipped = append(skipped, id)
+	}
+	if len(skipped) == 0 {
+		return nil, nil
+	}
+	return skipped, s.saveLocked()
+}
+
+// RenameSession 会话重命名后更新绑定该会话的任务
+func (s *Store) RenameSession(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for id, existing := range s.jobs {
+		if existing.Session == oldName {
+			job := *existing
+			job.Session = newName
+			s.jobs[id] = &job
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// DisableSession 会话退出后禁用绑定该会话的任务，保留任务和执行记录，
+// 同名会话重新创建后可由所有者重新启用
+func (s *Store) DisableSession(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	changed := false
+	for id, existing := range s.jobs {
+		if existing.Session == name && (existing.Enabled || existing.NextRunAt != nil) {
+			job := *existing
+			job.Enabled = false
+			job.NextRunAt = nil
+			job.UpdatedAt = now
+			s.jobs[id] = &job
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// RemoveSession 删除绑定到已删除的会话的任务
+func (s *Store) RemoveSession(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for id, job := range s.jobs {
+		if job.Session == name {
+			delete(s.jobs, id)
+			delete(s.runs, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package security
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy 浏览器请求来源（Origin）白名单，CORS 和 WebSocket 升级共用
+//
+// 默认只允许同源请求；前端开发服务器与后端同主机、不同端口，视为同源。
+// 白名单条目为 scheme://host[:port]，host 可以写成 *.example.com 匹配所有子域名
+type OriginPolicy struct {
+	exact        map[string]bool
+	wildcards    []originPattern
+	frontendPort string
+}
+
+// originPattern 通配子域名条目，suffix 为 ".example.com"
+type originPattern struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+// NewOriginPolicy 创建来源白名单，frontendPort 为前端开发服务器端口，为空表示不放行
+func NewOriginPolicy(allowed []string, frontendPort string) *OriginPolicy {
+	p := &OriginPolicy{
+		exact:        make(map[string]bool),
+		frontendPort: frontendPort,
+	}
+	for _, entry := range allowed {
+		scheme, host, port, ok := parseOrigin(strings.TrimSuffix(strings.TrimSpace(entry), "/"))
+		if !ok {
+			log.Printf("[Security] Ignoring invalid allowed origin %q", entry)
+			continue
+		}
+		if strings.HasPrefix(host, "*.") {
+			p.wildcards = append(p.wildcards, originPattern{scheme: scheme, suffix: host[1:], port: port})
+			continue
+		}
+		p.exact[formatOrigin(scheme, host, port)] = true
+	}
+	return p
+}
+
+// Allowed 检查请求的 Origin，没有 Origin 的请求（非浏览器客户端）直接放行，拒绝时记录日志
+func (p *OriginPolicy) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.allows(origin, r.Host) {
+		return true
+	}
+	log.Printf("[Security] Rejected origin %q: %s %s from %s", origin, r.Method, r.URL.Path, r.RemoteAddr)
+	return false
+}
+
+// allows 判断来源是否同源或在白名单中
+func (p *OriginPolicy) allows(origin, requestHost string) bool {
+	scheme, host, port, ok := parseOrigin(origin)
+	if !ok || strings.Contains(host, "*") {
+		return false
+	}
+
+	// 同源：比较主机和端口，协议在反向代理之后无法可靠判断
+	reqHost, reqPort := splitHost(requestHost)
+	if host == reqHost && (port == reqPort || (p.frontendPort != "" && port == p.frontendPort)) {
+		return true
+	}
+
+	if p.exact[formatOrigin(scheme, host, port)] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if scheme == w.scheme && port == w.port && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrigin 解析 scheme://host[:port]，host 转小写，默认端口返回空字符串
+func parseOrigin(origin string) (scheme, host, port string, ok bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", "", "", false
+	}
+	scheme = strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", "", "", false
+	}
+	host = strings.ToLower(u.Hostname())
+	port = u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	return scheme, host, port, true
+}
+
+// splitHost 拆分请求的 Host 头，去掉默认端口
+func splitHost(hostport string) (host, port string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = strings.Trim(hostport, "[]"), ""
+	}
+	if port == "80" || port == "443" {
+		port = ""
+	}
+	return strings.ToLower(host), port
+}
+
+// formatOrigin 生成规范化的来源字符串
+func formatOrigin(scheme, host, port string) string {
+	if port == "" {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
@@ -26,11 +26,26 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxDisplayNameLength 显示名称最大字符数
+	MaxDisplayNameLength = 64
+	// MaxDescriptionLength 描述最大字符数
+	MaxDescriptionLength = 1024
+	// MaxLabels 单个会话最多标签数
+	MaxLabels = 32
+	// MaxLabelValueLength 标签值最大字符数
+	MaxLabelValueLength = 128
 )
 
 var (
 	// 会话名称只允许字母、数字、下划线、短横线
 	sessionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+	// 标签键：字母数字开头，允许 . _ - /，最长 63 字符
+	labelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,62}$`)
 	// 危险命令检测
 	dangerousCommands = []string{
 		"rm -rf /",
@@ -59,6 +74,63 @@ func (v *SessionValidator) ValidateSessionName(name string) error {
 	return nil
 }
 
+// ValidateDisplayName 验证显示名称（允许 Unicode，不允许控制字符）
+func (v *SessionValidator) ValidateDisplayName(name string) error {
+	if !utf8.ValidString(name) {
+		return errors.New("invalid display name: not valid UTF-8")
+	}
+	if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return fmt.Errorf("invalid display name: at most %d characters allowed", MaxDisplayNameLength)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errors.New("invalid display name: control characters not allowed")
+	}
+	return nil
+}
+
+// ValidateDescription 验证会话描述（允许换行和制表符）
+func (v *SessionValidator) ValidateDescription(desc string) error {
+	if !utf8.ValidString(desc) {
+		return errors.New("invalid description: not valid UTF-8")
+	}
+	if utf8.RuneCountInString(desc) > MaxDescriptionLength {
+		return fmt.Errorf("invalid description: at most %d characters allowed", MaxDescriptionLength)
+	}
+	if strings.IndexFunc(desc, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t'
+	}) >= 0 {
+		return errors.New("invalid description: control characters not allowed")
+	}
+	return nil
+}
+
+// ValidateLabelKey 验证标签键
+func (v *SessionValidator) ValidateLabelKey(key string) error {
+	if !labelKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid label key '%s': must start with alphanumeric, only alphanumeric, '.', '_', '-' and '/' allowed (1-63 chars)", key)
+	}
+	return nil
+}
+
+// ValidateLabels 验证标签集合
+func (v *SessionValidator) ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("too many labels: at most %d allowed", MaxLabels)
+	}
+	for key, value := range labels {
+		if err := v.ValidateLabelKey(key); err != nil {
+			return err
+		}
+		if !utf8.ValidString(value) || utf8.RuneCountInString(value) > MaxLabelValueLength {
+			return fmt.Errorf("invalid label value for '%s': at most %d characters allowed", key, MaxLabelValueLength)
+		}
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("invalid label value for '%s': control characters not allowed", key)
+		}
+	}
+	return nil
+}
+
 func (v *SessionValidator) ValidateWorkDir(path string) error {
 	v.mu.RLock()
 	allowedDir := v.allowedWorkDir
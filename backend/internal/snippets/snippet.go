@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package snippets
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Scope 片段的可见范围
+type Scope string
+
+const (
+	ScopeGlobal Scope = "global" // 所有用户可见，仅管理员可修改
+	ScopeUser   Scope = "user"   // 仅创建者可见
+)
+
+// 片段字段限制
+const (
+	MaxNameLength        = 64
+	MaxDescriptionLength = 256
+	MaxCommandLength     = 4096
+	MaxValueLength       = 1024
+)
+
+var (
+	ErrSnippetNotFound = errors.New("snippet not found")
+)
+
+// paramPattern 匹配 {{name}} 和 {{name:default}} 占位符
+var paramPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?::([^}]*))?\}\}`)
+
+// Param 命令中的占位符参数
+type Param struct {
+	Name     string `json:"name"`
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required"` // 没有默认值的参数执行时必须提供
+}
+
+// Snippet 命令片段，命令中可以包含 {{name}} 或 {{name:default}} 占位符
+type Snippet struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Command     string    `json:"command"`
+	Scope       Scope     `json:"scope"`
+	OwnerID     string    `json:"owner_id,omitempty"` // 全局片段为空
+	Params      []Param   `json:"params"`             // 由命令解析得出
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate 校验片段并解析占位符参数
+func (s *Snippet) Validate() error {
+	if s.Name == "" || len(s.Name) > MaxNameLength {
+		return fmt.Errorf("name must be 1-%d characters", MaxNameLength)
+	}
+	if len(s.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", MaxDescriptionLength)
+	}
+	if s.Command == "" || len(s.Command) > MaxCommandLength {
+		return fmt.Errorf("command must be 1-%d characters", MaxCommandLength)
+	}
+	switch s.Scope {
+	case ScopeGlobal:
+		s.OwnerID = ""
+	case ScopeUser:
+		if s.OwnerID == "" {
+			return errors.New("user snippets require an owner")
+		}
+	default:
+		return fmt.Errorf("unknown scope: %q", s.Scope)
+	}
+
+	params, err := parseParams(s.Command)
+	if err != nil {
+		return err
+	}
+	s.Params = params
+	return nil
+}
+
+// parseParams 按首次出现的顺序解析占位符，同名参数的默认值必须一致
+func parseParams(command string) ([]Param, error) {
+	params := make([]Param, 0)
+	seen := make(map[string]int)
+	for _, m := range paramPattern.FindAllStringSubmatchIndex(command, -1) {
+		name := command[m[2]:m[3]]
+		param := Param{Name: name, Required: m[4] < 0}
+		if m[4] >= 0 {
+			param.Default = command[m[4]:m[5]]
+		}
+
+		if i, ok := seen[name]; ok {
+			if params[i] != param {
+				return nil, fmt.Errorf("parameter %q has conflicting defaults", name)
+			}
+			continue
+		}
+		seen[name] = len(params)
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// Render 用参数值替换占位符，未提供的参数使用默认值
+func (s *Snippet) Render(values map[string]string) (string, error) {
+	known := make(map[string]bool, len(s.Params))
+	for _, param := range s.Params {
+		known[param.Name] = true
+		value, ok := values[param.Name]
+		if !ok && param.Required {
+			return "", fmt.Errorf("missing parameter %q", param.Name)
+		}
+		if len(value) > MaxValueLength {
+			return "", fmt.Errorf("parameter %q must be at most %d characters", param.Name, MaxValueLength)
+		}
+		// 换行等控制字符会让一个片段执行多条命令
+		if strings.ContainsFunc(value, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+			return "", fmt.Errorf("parameter %q must not contain control characters", param.Name)
+		}
+	}
+	for name := range values {
+		if !known[name] {
+			return "", fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	return paramPattern.ReplaceAllStringFunc(s.Command, func(placeholder string) string {
+		m := paramPattern.FindStringSubmatch(placeholder)
+		if value, ok := values[m[1]]; ok {
+			return value
+		}
+		return m[2]
+	}), nil
+}
+
+// VisibleTo 判断用户能否查看和执行片段
+func (s *Snippet) VisibleTo(userID string, isAdmin bool) bool {
+	return s.Scope == ScopeGlobal || isAdmin || (s.OwnerID != "" && s.OwnerID == userID)
+}
+
+// EditableBy 判断用户能否修改和删除片段：全局片段仅管理员可修改
+func (s *Snippet) EditableBy(userID string, isAdmin bool) bool {
+	return isAdmin || (s.Scope == ScopeUser && s.OwnerID == userID)
+}
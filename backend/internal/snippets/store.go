@@ -0,0 +1,194 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package snippets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store 片段存储，持久化到数据目录的 snippets.json
+type Store struct {
+	path     string
+	snippets map[string]*Snippet
+	mu       sync.RWMutex
+}
+
+// NewStore 创建片段存储并加载已保存的片段
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path:     filepath.Join(dataDir, "snippets.json"),
+		snippets: make(map[string]*Snippet),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var snippets []*Snippet
+	if err := json.Unmarshal(data, &snippets); err != nil {
+		return nil, err
+	}
+	for _, snippet := range snippets {
+		if err := snippet.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid snippet %s: %w", snippet.ID, err)
+		}
+		s.snippets[snippet.ID] = snippet
+	}
+	return s, nil
+}
+
+// saveLocked 将所有片段写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按名称返回所有片段（调用方需持有锁）
+func (s *Store) listLocked() []*Snippet {
+	snippets := make([]*Snippet, 0, len(s.snippets))
+	for _, snippet := range s.snippets {
+		snippets = append(snippets, snippet)
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		if snippets[i].Name != snippets[j].Name {
+			return snippets[i].Name < snippets[j].Name
+		}
+		return snippets[i].CreatedAt.Before(snippets[j].CreatedAt)
+	})
+	return snippets
+}
+
+// List 返回所有片段的副本
+func (s *Store) List() []Snippet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snippets := make([]Snippet, 0, len(s.snippets))
+	for _, snippet := range s.listLocked() {
+		snippets = append(snippets, *snippet)
+	}
+	return snippets
+}
+
+// Get 获取指定片段
+func (s *Store) Get(id string) (Snippet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snippet, ok := s.snippets[id]
+	if !ok {
+		return Snippet{}, ErrSnippetNotFound
+	}
+	return *snippet, nil
+}
+
+// Put 校验并保存片段，ID 为空时创建新片段
+func (s *Store) Put(snippet Snippet) (Snippet, error) {
+	if err := snippet.Validate(); err != nil {
+		return Snippet{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.putLocked(&snippet, time.Now()); err != nil {
+		return Snippet{}, err
+	}
+	if err := s.saveLocked(); err != nil {
+		return Snippet{}, err
+	}
+	return snippet, nil
+}
+
+// putLocked 保存已校验的片段（调用方需持有锁）
+func (s *Store) putLocked(snippet *Snippet, now time.Time) error {
+	if snippet.ID == "" {
+		snippet.ID = fmt.Sprintf("snp_%d", now.UnixNano())
+		snippet.CreatedAt = now
+	} else {
+		existing, ok := s.snippets[snippet.ID]
+		if !ok {
+			return ErrSnippetNotFound
+		}
+		snippet.CreatedAt = existing.CreatedAt
+	}
+	snippet.UpdatedAt = now
+	s.snippets[snippet.ID] = snippet
+	return nil
+}
+
+// Import 批量导入片段：同一范围和所有者下的同名片段被覆盖，其余新建。全部校验通过才会写入
+func (s *Store) Import(snippets []Snippet) ([]Snippet, error) {
+	for i := range snippets {
+		snippets[i].ID = ""
+		if err := snippets[i].Validate(); err != nil {
+			return nil, fmt.Errorf("snippet %d (%s): %w", i, snippets[i].Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	imported := make([]Snippet, 0, len(snippets))
+	for i := range snippets {
+		snippet := snippets[i]
+		for _, existing := range s.snippets {
+			if existing.Scope == snippet.Scope && existing.OwnerID == snippet.OwnerID && existing.Name == snippet.Name {
+				snippet.ID = existing.ID
+				break
+			}
+		}
+		// 同一批次中的片段 ID 不能重复
+		if err := s.putLocked(&snippet, now.Add(time.Duration(i))); err != nil {
+			return nil, err
+		}
+		imported = append(imported, snippet)
+	}
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// Delete 删除片段
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.snippets[id]; !ok {
+		return ErrSnippetNotFound
+	}
+	delete(s.snippets, id)
+	return s.saveLocked()
+}
@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// Color 单元格颜色：0 表示默认颜色，其余按高位区分 256 色索引和 24 位真彩色
+type Color uint32
+
+const (
+	colorIndexed Color = 1 << 24
+	colorRGB     Color = 2 << 24
+	colorKind    Color = 0xff << 24
+)
+
+// IndexedColor 返回 256 色调色板中的颜色（0-15 为标准色和高亮色）
+func IndexedColor(index uint8) Color {
+	return colorIndexed | Color(index)
+}
+
+// RGBColor 返回 24 位真彩色
+func RGBColor(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// IsDefault 是否为终端默认颜色
+func (c Color) IsDefault() bool {
+	return c == 0
+}
+
+// Index 返回调色板索引，不是索引色时 ok 为 false
+func (c Color) Index() (index uint8, ok bool) {
+	return uint8(c), c&colorKind == colorIndexed
+}
+
+// RGB 返回真彩色分量，不是真彩色时 ok 为 false
+func (c Color) RGB() (r, g, b uint8, ok bool) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), c&colorKind == colorRGB
+}
+
+// MarshalJSON 索引色输出为数字，真彩色输出为 "#rrggbb"，默认颜色输出为 null
+func (c Color) MarshalJSON() ([]byte, error) {
+	if r, g, b, ok := c.RGB(); ok {
+		return json.Marshal(fmt.Sprintf("#%02x%02x%02x", r, g, b))
+	}
+	if index, ok := c.Index(); ok {
+		return json.Marshal(index)
+	}
+	return []byte("null"), nil
+}
+
+// AttrFlags 文本样式标志
+type AttrFlags uint16
+
+const (
+	AttrBold AttrFlags = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+// Attr 单元格的颜色和样式
+type Attr struct {
+	FG    Color
+	BG    Color
+	Flags AttrFlags
+}
+
+// Cell 屏幕上的一个单元格。宽字符占两个单元格，第二个单元格的 Width 为 0
+type Cell struct {
+	Ch    rune
+	Width uint8
+	Attr  Attr
+}
+
+// blankCell 返回使用指定背景色的空白单元格（擦除操作保留当前背景色）
+func blankCell(attr Attr) Cell {
+	return Cell{Ch: ' ', Width: 1, Attr: Attr{BG: attr.BG}}
+}
+
+// Line 屏幕或历史中的一行
+type Line struct {
+	Cells   []Cell
+	Wrapped bool // 该行因自动换行延续到下一行
+}
+
+// newLine 创建指定宽度的空白行
+func newLine(cols int, attr Attr) Line {
+	cells := make([]Cell, cols)
+	blank := blankCell(attr)
+	for i := range cells {
+		cells[i] = blank
+	}
+	return Line{Cells: cells}
+}
+
+// clone 复制一行
+func (l Line) clone() Line {
+	return Line{Cells: append([]Cell(nil), l.Cells...), Wrapped: l.Wrapped}
+}
+
+// Text 返回行的文本，去除末尾空白
+func (l Line) Text() string {
+	runes := make([]rune, 0, len(l.Cells))
+	for _, cell := range l.Cells {
+		if cell.Width == 0 {
+			continue
+		}
+		runes = append(runes, cell.Ch)
+	}
+	end := len(runes)
+	for end > 0 && runes[end-1] == ' ' {
+		end--
+	}
+	return string(runes[:end])
+}
+
+// runeWidth 返回字符占用的单元格数：组合字符和格式字符为 0，东亚宽字符和全角字符为 2
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x300:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// decSpecialGraphics DEC 特殊图形字符集（制表符），由 ESC ( 0 选择
+var decSpecialGraphics = map[rune]rune{
+	'`': '◆', 'a': '▒', 'b': '␉', 'c': '␌', 'd': '␍', 'e': '␊', 'f': '°', 'g': '±',
+	'h': '␤', 'i': '␋', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼', 'o': '⎺',
+	'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
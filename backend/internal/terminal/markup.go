@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// cssUnsafe 去除字体名中可能破坏样式表的字符
+var cssUnsafe = strings.NewReplacer("<", "", ">", "", "{", "", "}", "", ";", "")
+
+// svg 输出 SVG：背景按段绘制矩形，文本按段输出并用 textLength 对齐到单元格网格，
+// 保证字体缺字或宽度不同时仍与终端排版一致
+func (l *layout) svg(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	p := l.palette
+	pad := l.opts.Padding
+	baseline := (l.lineH-l.opts.FontSize)/2 + l.opts.FontSize*4/5
+
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" xml:space="preserve">`+"\n",
+		l.width, l.height, l.width, l.height)
+	if l.title != "" {
+		fmt.Fprintf(out, "<title>%s</title>\n", html.EscapeString(l.title))
+	}
+	fmt.Fprintf(out, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(p.bg))
+	fmt.Fprintf(out, `<g font-family="%s" font-size="%d">`+"\n", html.EscapeString(l.opts.FontFamily), l.opts.FontSize)
+
+	for y, runs := range l.rowRuns {
+		top := pad + y*l.lineH
+		for _, r := range runs {
+			if !r.style.defaultBG {
+				fmt.Fprintf(out, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+					pad+r.col*l.cellW, top, r.width*l.cellW, l.lineH, hexColor(r.style.bg))
+			}
+		}
+		for _, r := range runs {
+			text, width := r.text, r.width
+			if r.style.flags&(AttrUnderline|AttrStrike) == 0 {
+				// 末尾的空格不输出，避免 textLength 把文字拉伸到空白处
+				trimmed := strings.TrimRight(text, " ")
+				width -= len(text) - len(trimmed)
+				text = trimmed
+			}
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(out, `<text x="%d" y="%d" fill="%s" textLength="%d" lengthAdjust="spacingAndGlyphs"%s>%s</text>`+"\n",
+				pad+r.col*l.cellW, top+baseline, hexColor(r.style.fg), width*l.cellW,
+				svgStyle(r.style.flags), html.EscapeString(text))
+		}
+	}
+
+	out.WriteString("</g>\n</svg>\n")
+	return out.Flush()
+}
+
+// svgStyle 返回粗体、斜体、下划线和删除线对应的属性
+func svgStyle(flags AttrFlags) string {
+	var b strings.Builder
+	if flags&AttrBold != 0 {
+		b.WriteString(` font-weight="bold"`)
+	}
+	if flags&AttrItalic != 0 {
+		b.WriteString(` font-style="italic"`)
+	}
+	var decorations []string
+	if flags&AttrUnderline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if flags&AttrStrike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		fmt.Fprintf(&b, ` text-decoration="%s"`, strings.Join(decorations, " "))
+	}
+	return b.String()
+}
+
+// html 输出独立的 HTML 页面，每段文本为带内联样式的 span
+func (l *layout) html(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	p := l.palette
+
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(l.title))
+	fmt.Fprintf(out, "<style>\nbody{margin:0;background:%s}\n", hexColor(p.bg))
+	fmt.Fprintf(out, "pre{margin:0;padding:%dpx;font-family:%s;font-size:%dpx;line-height:%dpx;color:%s;background:%s}\n",
+		l.opts.Padding, cssUnsafe.Replace(l.opts.FontFamily), l.opts.FontSize, l.lineH, hexColor(p.fg), hexColor(p.bg))
+	out.WriteString("</style>\n</head>\n<body>\n<pre>")
+
+	for y, runs := range l.rowRuns {
+		if y > 0 {
+			out.WriteByte('\n')
+		}
+		// 去除行尾无背景的空白
+		end := len(runs)
+		for end > 0 && runs[end-1].style.defaultBG && strings.TrimSpace(runs[end-1].text) == "" {
+			end--
+		}
+		for _, r := range runs[:end] {
+			if css := l.htmlStyle(r.style); css != "" {
+				fmt.Fprintf(out, `<span style="%s">%s</span>`, css, html.EscapeString(r.text))
+			} else {
+				out.WriteString(html.EscapeString(r.text))
+			}
+		}
+	}
+
+	out.WriteString("</pre>\n</body>\n</html>\n")
+	return out.Flush()
+}
+
+// htmlStyle 返回与默认样式不同的部分对应的内联样式
+func (l *layout) htmlStyle(st style) string {
+	var parts []string
+	if st.fg != l.palette.fg {
+		parts = append(parts, "color:"+hexColor(st.fg))
+	}
+	if !st.defaultBG {
+		parts = append(parts, "background:"+hexColor(st.bg))
+	}
+	if st.flags&AttrBold != 0 {
+		parts = append(parts, "font-weight:bold")
+	}
+	if st.flags&AttrItalic != 0 {
+		parts = append(parts, "font-style:italic")
+	}
+	var decorations []string
+	if st.flags&AttrUnderline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if st.flags&AttrStrike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		parts = append(parts, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	return strings.Join(parts, ";")
+}
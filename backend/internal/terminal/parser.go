@@ -0,0 +1,577 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parserState 控制序列解析状态
+type parserState uint8
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateString // DCS、SOS、PM、APC，内容被忽略
+	stateStringEscape
+)
+
+// 控制序列长度限制，超出的部分被丢弃
+const (
+	maxParams    = 32
+	maxOSCLength = 4096
+)
+
+// parser VT500 风格的控制序列解析器，按 UTF-8 解码输入
+type parser struct {
+	state         parserState
+	partial       []byte // 跨分块的不完整 UTF-8 序列
+	intermediates []byte
+	private       byte // CSI 私有前缀：? > < =
+	params        []byte
+	osc           []byte
+	oscEscape     bool // OSC 中遇到 ESC，等待 \ 组成 ST
+}
+
+// feed 解析输入并作用于屏幕（调用方需持有屏幕的锁）
+func (p *parser) feed(s *Screen, data []byte) {
+	if len(p.partial) > 0 {
+		data = append(p.partial, data...)
+		p.partial = nil
+	}
+	for len(data) > 0 {
+		b := data[0]
+		if b < utf8.RuneSelf {
+			p.handle(s, rune(b))
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			p.partial = append([]byte(nil), data...)
+			return
+		}
+		r, size := utf8.DecodeRune(data)
+		p.handle(s, r)
+		data = data[size:]
+	}
+}
+
+// handle 处理一个字符
+func (p *parser) handle(s *Screen, r rune) {
+	// 字符串状态中只关心终止符
+	switch p.state {
+	case stateOSC:
+		p.handleOSC(s, r)
+		return
+	case stateString:
+		if r == 0x1b {
+			p.state = stateStringEscape
+		} else if r == 0x07 {
+			p.state = stateGround
+		}
+		return
+	case stateStringEscape:
+		if r == '\\' {
+			p.state = stateGround
+		} else {
+			p.state = stateString
+		}
+		return
+	}
+
+	// C0 控制字符在任何状态下都立即执行（ESC、CAN、SUB 除外）
+	if r < 0x20 || r == 0x7f {
+		switch r {
+		case 0x1b:
+			p.state = stateEscape
+			p.intermediates = p.intermediates[:0]
+		case 0x18, 0x1a:
+			p.state = stateGround
+		case 0x7f:
+		default:
+			s.execute(r)
+		}
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		s.print(r)
+	case stateEscape:
+		switch {
+		case r >= 0x20 && r <= 0x2f:
+			p.intermediates = append(p.intermediates, byte(r))
+			p.state = stateEscapeIntermediate
+		case r == '[':
+			p.state = stateCSI
+			p.private = 0
+			p.params = p.params[:0]
+			p.intermediates = p.intermediates[:0]
+		case r == ']':
+			p.state = stateOSC
+			p.osc = p.osc[:0]
+			p.oscEscape = false
+		case r == 'P' || r == 'X' || r == '^' || r == '_':
+			p.state = stateString
+		default:
+			p.state = stateGround
+			s.escDispatch(0, r)
+		}
+	case stateEscapeIntermediate:
+		if r >= 0x20 && r <= 0x2f {
+			p.intermediates = append(p.intermediates, byte(r))
+			return
+		}
+		p.state = stateGround
+		if len(p.intermediates) > 0 {
+			s.escDispatch(p.intermediates[0], r)
+		}
+	case stateCSI:
+		switch {
+		case r >= '0' && r <= '9' || r == ';' || r == ':':
+			if len(p.params) < maxParams*4 {
+				p.params = append(p.params, byte(r))
+			}
+		case r >= '<' && r <= '?':
+			if len(p.params) == 0 && p.private == 0 {
+				p.private = byte(r)
+			}
+		case r >= 0x20 && r <= 0x2f:
+			p.intermediates = append(p.intermediates, byte(r))
+		case r >= 0x40 && r <= 0x7e:
+			p.state = stateGround
+			var intermediate byte
+			if len(p.intermediates) > 0 {
+				intermediate = p.intermediates[0]
+			}
+			s.csiDispatch(p.private, intermediate, parseParams(string(p.params)), r)
+		default:
+			p.state = stateGround
+		}
+	}
+}
+
+// handleOSC 收集 OSC 字符串，遇到 BEL 或 ST 时执行
+func (p *parser) handleOSC(s *Screen, r rune) {
+	if p.oscEscape {
+		p.oscEscape = false
+		p.state = stateGround
+		if r == '\\' {
+			s.oscDispatch(string(p.osc))
+			return
+		}
+		// 不是 ST，按新的转义序列处理
+		p.state = stateEscape
+		p.intermediates = p.intermediates[:0]
+		p.handle(s, r)
+		return
+	}
+	switch r {
+	case 0x07:
+		p.state = stateGround
+		s.oscDispatch(string(p.osc))
+	case 0x1b:
+		p.oscEscape = true
+	default:
+		if len(p.osc) < maxOSCLength {
+			p.osc = utf8.AppendRune(p.osc, r)
+		}
+	}
+}
+
+// parseParams 解析 CSI 参数，每个参数可以带冒号分隔的子参数，省略的值为 -1
+func parseParams(raw string) [][]int {
+	if raw == "" {
+		return nil
+	}
+	fields := strings.Split(raw, ";")
+	if len(fields) > maxParams {
+		fields = fields[:maxParams]
+	}
+	params := make([][]int, len(fields))
+	for i, field := range fields {
+		for _, sub := range strings.Split(field, ":") {
+			value := -1
+			if sub != "" {
+				if n, err := strconv.Atoi(sub); err == nil {
+					value = min(n, 65535)
+				} else {
+					value = 65535
+				}
+			}
+			params[i] = append(params[i], value)
+		}
+	}
+	return params
+}
+
+// param 返回第 i 个参数，省略或为 0 时返回默认值
+func param(params [][]int, i, def int) int {
+	if i >= len(params) || params[i][0] <= 0 {
+		return def
+	}
+	return params[i][0]
+}
+
+// execute 执行 C0 控制字符
+func (s *Screen) execute(r rune) {
+	switch r {
+	case '\b':
+		if s.cursor.wrapPending {
+			s.cursor.wrapPending = false
+		} else if s.cursor.x > 0 {
+			s.cursor.x--
+		}
+	case '\t':
+		s.tab(1)
+	case '\n', '\v', '\f':
+		s.index()
+		if s.newLineMode {
+			s.cursor.x = 0
+		}
+	case '\r':
+		s.cursor.x = 0
+		s.cursor.wrapPending = false
+	case 0x0e: // SO
+		s.cursor.shift = 1
+	case 0x0f: // SI
+		s.cursor.shift = 0
+	}
+}
+
+// escDispatch 执行 ESC 序列
+func (s *Screen) escDispatch(intermediate byte, r rune) {
+	switch intermediate {
+	case '(', ')':
+		set := charsetASCII
+		if r == '0' {
+			set = charsetGraphics
+		}
+		s.cursor.charsets[intermediate-'('] = set
+		return
+	case '#':
+		if r == '8' {
+			s.alignmentTest()
+		}
+		return
+	case 0:
+	default:
+		return
+	}
+
+	switch r {
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.cursor.x = 0
+		s.index()
+	case 'H':
+		s.tabs[s.cursor.x] = true
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	}
+}
+
+// oscDispatch 执行 OSC 命令，目前只处理窗口标题
+func (s *Screen) oscDispatch(data string) {
+	command, text, ok := strings.Cut(data, ";")
+	if !ok {
+		return
+	}
+	switch command {
+	case "0", "2":
+		s.title = text
+		s.seq++
+	}
+}
+
+// csiDispatch 执行 CSI 序列
+func (s *Screen) csiDispatch(private, intermediate byte, params [][]int, final rune) {
+	if intermediate != 0 {
+		// DECSCUSR（光标形状）等带中间字符的序列不影响屏幕内容
+		return
+	}
+	if private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, p := range params {
+				s.setPrivateMode(p[0], final == 'h')
+			}
+		}
+		return
+	}
+	if private != 0 {
+		return
+	}
+
+	n := param(params, 0, 1)
+	switch final {
+	case '@':
+		s.insertCells(n)
+	case 'A':
+		s.moveCursorVertical(-n)
+	case 'B', 'e':
+		s.moveCursorVertical(n)
+	case 'C', 'a':
+		s.cursor.x = min(s.cursor.x+n, s.cols-1)
+		s.cursor.wrapPending = false
+	case 'D':
+		s.cursor.x = max(s.cursor.x-n, 0)
+		s.cursor.wrapPending = false
+	case 'E':
+		s.moveCursorVertical(n)
+		s.cursor.x = 0
+	case 'F':
+		s.moveCursorVertical(-n)
+		s.cursor.x = 0
+	case 'G', '`':
+		s.cursor.x = min(n-1, s.cols-1)
+		s.cursor.wrapPending = false
+	case 'H', 'f':
+		s.moveTo(param(params, 1, 1)-1, n-1)
+	case 'I':
+		s.tab(n)
+	case 'J':
+		s.eraseDisplay(param(params, 0, 0))
+	case 'K':
+		s.eraseLine(param(params, 0, 0))
+	case 'L':
+		s.insertLines(n)
+	case 'M':
+		s.deleteLines(n)
+	case 'P':
+		s.deleteCells(n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		if len(params) <= 1 {
+			s.scrollDown(n)
+		}
+	case 'X':
+		s.eraseCells(s.cursor.y, s.cursor.x, s.cursor.x+n)
+	case 'Z':
+		s.tab(-n)
+	case 'b':
+		if s.lastPrinted != 0 {
+			for i := 0; i < min(n, s.cols*s.rows); i++ {
+				s.print(s.lastPrinted)
+			}
+		}
+	case 'd':
+		s.moveTo(s.cursor.x, n-1)
+	case 'g':
+		switch param(params, 0, 0) {
+		case 0:
+			s.tabs[s.cursor.x] = false
+		case 3:
+			for i := range s.tabs {
+				s.tabs[i] = false
+			}
+		}
+	case 'h', 'l':
+		for _, p := range params {
+			switch p[0] {
+			case 4:
+				s.insertMode = final == 'h'
+			case 20:
+				s.newLineMode = final == 'h'
+			}
+		}
+	case 'm':
+		s.setGraphics(params)
+	case 'r':
+		s.setScrollRegion(param(params, 0, 1)-1, param(params, 1, s.rows)-1)
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+// moveCursorVertical 上下移动光标，光标在滚动区域内时不能移出滚动区域
+func (s *Screen) moveCursorVertical(n int) {
+	top, bottom := 0, s.rows-1
+	if s.cursor.y >= s.top && s.cursor.y <= s.bottom {
+		top, bottom = s.top, s.bottom
+	}
+	s.cursor.y = max(top, min(s.cursor.y+n, bottom))
+	s.cursor.wrapPending = false
+}
+
+// setPrivateMode DECSET/DECRST
+func (s *Screen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 1:
+		s.appCursor = on
+	case 6:
+		s.cursor.originMode = on
+		s.moveTo(0, 0)
+	case 7:
+		s.autoWrap = on
+	case 25:
+		s.cursorVisible = on
+		s.seq++
+	case 47, 1047:
+		s.setAlternate(on, mode == 1047)
+	case 1048:
+		if on {
+			s.saveCursor()
+		} else {
+			s.restoreCursor()
+		}
+	case 1049:
+		if on {
+			s.saveCursor()
+			s.setAlternate(true, true)
+		} else {
+			s.setAlternate(false, false)
+			s.restoreCursor()
+		}
+	}
+}
+
+// setGraphics SGR：设置颜色和样式
+func (s *Screen) setGraphics(params [][]int) {
+	attr := &s.cursor.attr
+	if len(params) == 0 {
+		*attr = Attr{}
+		return
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch code := p[0]; {
+		case code <= 0:
+			*attr = Attr{}
+		case code == 1:
+			attr.Flags |= AttrBold
+		case code == 2:
+			attr.Flags |= AttrDim
+		case code == 3:
+			attr.Flags |= AttrItalic
+		case code == 4:
+			// 4:0 关闭下划线，4:n 为各种下划线样式
+			if len(p) > 1 && p[1] == 0 {
+				attr.Flags &^= AttrUnderline
+			} else {
+				attr.Flags |= AttrUnderline
+			}
+		case code == 5 || code == 6:
+			attr.Flags |= AttrBlink
+		case code == 7:
+			attr.Flags |= AttrReverse
+		case code == 8:
+			attr.Flags |= AttrHidden
+		case code == 9:
+			attr.Flags |= AttrStrike
+		case code == 21:
+			attr.Flags |= AttrUnderline
+		case code == 22:
+			attr.Flags &^= AttrBold | AttrDim
+		case code == 23:
+			attr.Flags &^= AttrItalic
+		case code == 24:
+			attr.Flags &^= AttrUnderline
+		case code == 25:
+			attr.Flags &^= AttrBlink
+		case code == 27:
+			attr.Flags &^= AttrReverse
+		case code == 28:
+			attr.Flags &^= AttrHidden
+		case code == 29:
+			attr.Flags &^= AttrStrike
+		case code >= 30 && code <= 37:
+			attr.FG = IndexedColor(uint8(code - 30))
+		case code == 38:
+			var c Color
+			c, i = extendedColor(params, i)
+			attr.FG = c
+		case code == 39:
+			attr.FG = 0
+		case code >= 40 && code <= 47:
+			attr.BG = IndexedColor(uint8(code - 40))
+		case code == 48:
+			var c Color
+			c, i = extendedColor(params, i)
+			attr.BG = c
+		case code == 49:
+			attr.BG = 0
+		case code >= 90 && code <= 97:
+			attr.FG = IndexedColor(uint8(code - 90 + 8))
+		case code >= 100 && code <= 107:
+			attr.BG = IndexedColor(uint8(code - 100 + 8))
+		}
+	}
+}
+
+// extendedColor 解析 38/48 扩展颜色，支持 5;n、2;r;g;b 以及冒号形式 5:n、2::r:g:b、2:r:g:b。
+// 返回颜色和最后一个被使用的参数下标
+func extendedColor(params [][]int, i int) (Color, int) {
+	var values []int
+	next := i
+	if sub := params[i]; len(sub) > 1 {
+		// 冒号形式，所有值都在同一个参数中
+		values = sub[1:]
+	} else {
+		for j := i + 1; j < len(params) && j <= i+4; j++ {
+			values = append(values, params[j][0])
+		}
+	}
+	if len(values) == 0 {
+		return 0, next
+	}
+
+	clamp := func(v int) uint8 {
+		return uint8(max(0, min(v, 255)))
+	}
+	switch values[0] {
+	case 5:
+		if len(values) < 2 {
+			return 0, len(params)
+		}
+		if len(params[i]) == 1 {
+			next = i + 2
+		}
+		return IndexedColor(clamp(values[1])), next
+	case 2:
+		rgb := values[1:]
+		if len(params[i]) > 1 && len(rgb) >= 4 {
+			// 2:colorspace:r:g:b
+			rgb = rgb[1:]
+		}
+		if len(rgb) < 3 {
+			return 0, len(params)
+		}
+		if len(params[i]) == 1 {
+			next = i + 4
+		}
+		return RGBColor(clamp(rgb[0]), clamp(rgb[1]), clamp(rgb[2])), next
+	}
+	return 0, next
+}
@@ -0,0 +1,165 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	fontsOnce sync.Once
+	fonts     [4]*opentype.Font // 常规、粗体、斜体、粗斜体，下标见 fontIndex
+	fontsErr  error
+)
+
+// loadFonts 解析内置的 Go Mono 字体（只解析一次）
+func loadFonts() ([4]*opentype.Font, error) {
+	fontsOnce.Do(func() {
+		for i, data := range [][]byte{gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF} {
+			if fonts[i], fontsErr = opentype.Parse(data); fontsErr != nil {
+				return
+			}
+		}
+	})
+	return fonts, fontsErr
+}
+
+// fontIndex 返回样式对应的字体下标
+func fontIndex(flags AttrFlags) int {
+	i := 0
+	if flags&AttrBold != 0 {
+		i |= 1
+	}
+	if flags&AttrItalic != 0 {
+		i |= 2
+	}
+	return i
+}
+
+// png 输出 PNG：逐个单元格绘制背景和字形，字形按单元格左边界对齐
+func (l *layout) png(w io.Writer) error {
+	if l.width*l.height > maxImagePixels {
+		return ErrImageTooLarge
+	}
+	parsed, err := loadFonts()
+	if err != nil {
+		return err
+	}
+
+	// opentype 的 Face 不能并发使用，每次渲染单独创建
+	var faces [4]font.Face
+	defer func() {
+		for _, face := range faces {
+			if face != nil {
+				face.Close()
+			}
+		}
+	}()
+	for i, f := range parsed {
+		if faces[i], err = opentype.NewFace(f, &opentype.FaceOptions{
+			Size:    float64(l.opts.FontSize),
+			DPI:     72,
+			Hinting: font.HintingFull,
+		}); err != nil {
+			return err
+		}
+	}
+
+	metrics := faces[0].Metrics()
+	ascent, descent := metrics.Ascent.Ceil(), metrics.Descent.Ceil()
+	baseline := (l.lineH-ascent-descent)/2 + ascent
+	thickness := max(1, l.opts.FontSize/14)
+
+	p := l.palette
+	pad := l.opts.Padding
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(p.bg), image.Point{}, draw.Src)
+
+	var buf sfnt.Buffer
+	for y, runs := range l.rowRuns {
+		top := pad + y*l.lineH
+		for _, r := range runs {
+			x := pad + r.col*l.cellW
+			if !r.style.defaultBG {
+				draw.Draw(img, image.Rect(x, top, x+r.width*l.cellW, top+l.lineH), image.NewUniform(r.style.bg), image.Point{}, draw.Src)
+			}
+		}
+
+		for _, r := range runs {
+			src := image.NewUniform(r.style.fg)
+			index := fontIndex(r.style.flags)
+			col := r.col
+			for _, ch := range r.text {
+				width := max(1, runeWidth(ch))
+				x := pad + col*l.cellW
+				col += width
+				if ch == ' ' {
+					continue
+				}
+				// 内置字体不含的字符（如中文）画一个空心方框占位
+				if glyph, err := parsed[index].GlyphIndex(&buf, ch); err == nil && glyph == 0 {
+					box := image.Rect(x+1, top+baseline-ascent+1, x+width*l.cellW-1, top+baseline)
+					strokeRect(img, box, src)
+					continue
+				}
+				if dr, mask, maskp, _, ok := faces[index].Glyph(fixed.P(x, top+baseline), ch); ok {
+					draw.DrawMask(img, dr, src, image.Point{}, mask, maskp, draw.Over)
+				}
+			}
+
+			x0, x1 := pad+r.col*l.cellW, pad+(r.col+r.width)*l.cellW
+			if r.style.flags&AttrUnderline != 0 {
+				lineY := top + baseline + max(1, descent/2)
+				draw.Draw(img, image.Rect(x0, lineY, x1, lineY+thickness), src, image.Point{}, draw.Src)
+			}
+			if r.style.flags&AttrStrike != 0 {
+				lineY := top + baseline - ascent*3/10
+				draw.Draw(img, image.Rect(x0, lineY, x1, lineY+thickness), src, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// strokeRect 画一个 1 像素宽的矩形边框
+func strokeRect(img *image.RGBA, r image.Rectangle, src image.Image) {
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1),
+		image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y),
+		image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, edge, src, image.Point{}, draw.Src)
+	}
+}
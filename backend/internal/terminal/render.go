@@ -0,0 +1,319 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Format 截图格式
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatSVG  Format = "svg"
+	FormatHTML Format = "html"
+)
+
+const (
+	// MaxSnapshotRows 单次截图最多的行数
+	MaxSnapshotRows = 500
+	// maxImagePixels PNG 截图的最大像素数
+	maxImagePixels = 16 << 20
+	// MinFontSize、MaxFontSize 允许的字号范围（像素）
+	MinFontSize = 6
+	MaxFontSize = 48
+)
+
+var (
+	// ErrInvalidRange 截图的行范围无效或超出限制
+	ErrInvalidRange = errors.New("invalid row range")
+	// ErrUnknownTheme 配色不存在
+	ErrUnknownTheme = errors.New("unknown theme")
+	// ErrImageTooLarge 截图超过像素上限
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// ContentType 返回格式对应的 MIME 类型，不支持的格式返回空字符串
+func (f Format) ContentType() string {
+	switch f {
+	case FormatPNG:
+		return "image/png"
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	}
+	return ""
+}
+
+// Snapshot 截图使用的屏幕片段
+type Snapshot struct {
+	Cols   int
+	Lines  []Line
+	Cursor *Cursor // 光标位置（Y 相对片段第一行），不可见或不在片段内时为 nil
+	Title  string
+}
+
+// Snapshot 复制 from 到 to（含）行。行号与 State 相同：0 为屏幕第一行，历史行为负数
+func (s *Screen) Snapshot(from, to int) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if from > to || from < -len(s.scrollback) || to >= s.rows || to-from+1 > MaxSnapshotRows {
+		return Snapshot{}, ErrInvalidRange
+	}
+
+	snap := Snapshot{Cols: s.cols, Title: s.title, Lines: make([]Line, 0, to-from+1)}
+	for y := from; y <= to; y++ {
+		if y < 0 {
+			snap.Lines = append(snap.Lines, s.scrollback[len(s.scrollback)+y].clone())
+		} else {
+			snap.Lines = append(snap.Lines, s.grid[y].clone())
+		}
+	}
+	if s.cursorVisible && s.cursor.y >= from && s.cursor.y <= to {
+		snap.Cursor = &Cursor{X: s.cursor.x, Y: s.cursor.y - from, Visible: true}
+	}
+	return snap, nil
+}
+
+// RenderOptions 截图选项。CellWidth、LineHeight 为 0 时按字号计算
+type RenderOptions struct {
+	Theme      string
+	FontFamily string // SVG 和 HTML 使用的字体，PNG 固定使用内置的 Go Mono
+	FontSize   int    // 字号（像素）
+	CellWidth  int    // 单元格宽度（像素）
+	LineHeight int    // 行高（像素）
+	Padding    int    // 四周留白（像素）
+	Cursor     bool   // 是否绘制光标
+}
+
+// Renderer 截图渲染器，保存可用的配色和默认选项
+type Renderer struct {
+	themes   map[string]*palette
+	list     []Theme
+	defaults RenderOptions
+}
+
+// NewRenderer 创建截图渲染器，校验配色和默认选项
+func NewRenderer(themes []Theme, defaults RenderOptions) (*Renderer, error) {
+	r := &Renderer{themes: make(map[string]*palette, len(themes)), list: themes}
+	for _, theme := range themes {
+		p, err := theme.compile()
+		if err != nil {
+			return nil, err
+		}
+		r.themes[theme.Name] = p
+	}
+	if _, ok := r.themes[defaults.Theme]; !ok {
+		return nil, fmt.Errorf("default theme %q: %w", defaults.Theme, ErrUnknownTheme)
+	}
+	if defaults.FontSize < MinFontSize || defaults.FontSize > MaxFontSize {
+		return nil, fmt.Errorf("font size must be between %d and %d", MinFontSize, MaxFontSize)
+	}
+	r.defaults = defaults
+	return r, nil
+}
+
+// Themes 返回可用的配色
+func (r *Renderer) Themes() []Theme {
+	return r.list
+}
+
+// Defaults 返回默认选项
+func (r *Renderer) Defaults() RenderOptions {
+	return r.defaults
+}
+
+// Options 在默认选项的基础上替换配色和字号（为空或 0 时保持默认）。
+// 修改字号时配置的单元格宽度和行高按比例缩放
+func (r *Renderer) Options(theme string, fontSize int) (RenderOptions, error) {
+	opts := r.defaults
+	if theme != "" {
+		if _, ok := r.themes[theme]; !ok {
+			return opts, ErrUnknownTheme
+		}
+		opts.Theme = theme
+	}
+	if fontSize != 0 && fontSize != opts.FontSize {
+		if fontSize < MinFontSize || fontSize > MaxFontSize {
+			return opts, fmt.Errorf("font size must be between %d and %d", MinFontSize, MaxFontSize)
+		}
+		scale := float64(fontSize) / float64(opts.FontSize)
+		opts.CellWidth = int(math.Round(float64(opts.CellWidth) * scale))
+		opts.LineHeight = int(math.Round(float64(opts.LineHeight) * scale))
+		opts.FontSize = fontSize
+	}
+	return opts, nil
+}
+
+// Render 按格式渲染截图
+func (r *Renderer) Render(w io.Writer, format Format, snap Snapshot, opts RenderOptions) error {
+	p, ok := r.themes[opts.Theme]
+	if !ok {
+		return ErrUnknownTheme
+	}
+	l := newLayout(snap, opts, p)
+
+	switch format {
+	case FormatPNG:
+		return l.png(w)
+	case FormatSVG:
+		return l.svg(w)
+	case FormatHTML:
+		return l.html(w)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// style 单元格解析后的颜色和样式
+type style struct {
+	fg, bg    color.RGBA
+	defaultBG bool // 背景与配色背景相同，无需绘制
+	flags     AttrFlags
+}
+
+// run 一行中样式相同的一段单元格
+type run struct {
+	col, width int // 起始列和占用的列数
+	text       string
+	style      style
+}
+
+// layout 截图的排版：单元格尺寸和按样式合并的文本段
+type layout struct {
+	opts          RenderOptions
+	palette       *palette
+	cols, rows    int
+	cellW, lineH  int
+	width, height int
+	rowRuns       [][]run
+	title         string
+}
+
+// newLayout 计算单元格尺寸并把各行合并为文本段
+func newLayout(snap Snapshot, opts RenderOptions, p *palette) *layout {
+	l := &layout{
+		opts:    opts,
+		palette: p,
+		cols:    snap.Cols,
+		rows:    len(snap.Lines),
+		cellW:   opts.CellWidth,
+		lineH:   opts.LineHeight,
+		title:   snap.Title,
+	}
+	if l.cellW <= 0 {
+		l.cellW = int(math.Round(float64(opts.FontSize) * 0.6))
+	}
+	if l.lineH <= 0 {
+		l.lineH = int(math.Round(float64(opts.FontSize) * 1.25))
+	}
+	l.width = l.cols*l.cellW + 2*opts.Padding
+	l.height = l.rows*l.lineH + 2*opts.Padding
+
+	l.rowRuns = make([][]run, len(snap.Lines))
+	for y, line := range snap.Lines {
+		cursorX := -1
+		if opts.Cursor && snap.Cursor != nil && snap.Cursor.Y == y {
+			cursorX = snap.Cursor.X
+		}
+		l.rowRuns[y] = l.runs(line, cursorX)
+	}
+	return l
+}
+
+// runs 把一行单元格合并为样式相同的文本段，cursorX 为光标所在列（-1 表示无光标）
+func (l *layout) runs(line Line, cursorX int) []run {
+	var runs []run
+	var text []rune
+	var current run
+	flush := func() {
+		if current.width > 0 {
+			current.text = string(text)
+			runs = append(runs, current)
+		}
+		text = text[:0]
+	}
+
+	for x := 0; x < len(line.Cells); x++ {
+		cell := line.Cells[x]
+		if cell.Width == 0 {
+			continue
+		}
+		st := l.resolve(cell.Attr, x == cursorX)
+		if current.width == 0 || st != current.style {
+			flush()
+			current = run{col: x, style: st}
+		}
+		text = append(text, cell.Ch)
+		current.width += int(cell.Width)
+	}
+	flush()
+	return runs
+}
+
+// resolve 根据配色解析单元格的前景和背景
+func (l *layout) resolve(attr Attr, cursor bool) style {
+	p := l.palette
+	fg := l.color(attr.FG, p.fg, attr.Flags&AttrBold != 0)
+	bg := l.color(attr.BG, p.bg, false)
+	if attr.Flags&AttrReverse != 0 {
+		fg, bg = bg, fg
+	}
+	if attr.Flags&AttrDim != 0 {
+		fg = blend(fg, bg)
+	}
+	if attr.Flags&AttrHidden != 0 {
+		fg = bg
+	}
+	if cursor {
+		fg, bg = p.bg, p.cursor
+	}
+	return style{fg: fg, bg: bg, defaultBG: bg == p.bg, flags: attr.Flags}
+}
+
+// color 解析颜色，粗体的普通色显示为对应的亮色
+func (l *layout) color(c Color, def color.RGBA, bold bool) color.RGBA {
+	if index, ok := c.Index(); ok {
+		if bold && index < 8 {
+			index += 8
+		}
+		return l.palette.colors[index]
+	}
+	if r, g, b, ok := c.RGB(); ok {
+		return color.RGBA{r, g, b, 0xff}
+	}
+	return def
+}
+
+// blend 取两种颜色的中间色
+func blend(a, b color.RGBA) color.RGBA {
+	return color.RGBA{
+		uint8((uint16(a.R) + uint16(b.R)) / 2),
+		uint8((uint16(a.G) + uint16(b.G)) / 2),
+		uint8((uint16(a.B) + uint16(b.B)) / 2),
+		0xff,
+	}
+}
@@ -0,0 +1,533 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"sync"
+)
+
+// DefaultScrollback 未指定时保留的历史行数
+const DefaultScrollback = 1000
+
+// charset G0/G1 字符集
+type charset uint8
+
+const (
+	charsetASCII charset = iota
+	charsetGraphics
+)
+
+// cursor 光标位置和写入状态
+type cursor struct {
+	x, y        int
+	attr        Attr
+	wrapPending bool       // 已写到最后一列，下一个字符先换行
+	charsets    [2]charset // G0、G1
+	shift       int        // 当前使用的字符集（SI 为 G0，SO 为 G1）
+	originMode  bool       // 保存光标时一并保存
+}
+
+// Screen VT100/xterm 屏幕模型：单元格网格、属性、光标、备用屏幕和历史。
+// 由会话的原始输出驱动，所有方法并发安全
+type Screen struct {
+	mu sync.RWMutex
+
+	cols, rows int
+	primary    []Line
+	alternate  []Line
+	grid       []Line // 当前显示的屏幕（primary 或 alternate）
+	altActive  bool
+
+	scrollback    []Line // 仅主屏幕滚出的行（旧的在前）
+	maxScrollback int
+
+	cursor       cursor
+	savedPrimary cursor
+	savedAlt     cursor
+	top, bottom  int // 滚动区域（含两端）
+
+	autoWrap      bool
+	insertMode    bool
+	newLineMode   bool
+	cursorVisible bool
+	appCursor     bool
+	tabs          []bool
+	title         string
+	lastPrinted   rune
+
+	// seq 每次修改递增；rowSeq 记录每行最后一次修改时的 seq，用于增量同步。
+	// resetSeq 之前的增量无效（尺寸变化、切换屏幕等），客户端需要全量同步
+	seq      uint64
+	rowSeq   []uint64
+	resetSeq uint64
+
+	parser parser
+}
+
+// NewScreen 创建指定尺寸的空白屏幕，scrollback 为保留的历史行数
+func NewScreen(cols, rows, scrollback int) *Screen {
+	if cols < 1 {
+		cols = 1
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	if scrollback < 0 {
+		scrollback = DefaultScrollback
+	}
+	s := &Screen{
+		cols:          cols,
+		rows:          rows,
+		maxScrollback: scrollback,
+	}
+	s.reset()
+	return s
+}
+
+// reset 恢复初始状态（RIS），保留尺寸和历史
+func (s *Screen) reset() {
+	s.primary = s.blankGrid()
+	s.alternate = s.blankGrid()
+	s.grid = s.primary
+	s.altActive = false
+	s.cursor = cursor{}
+	s.savedPrimary = cursor{}
+	s.savedAlt = cursor{}
+	s.top, s.bottom = 0, s.rows-1
+	s.autoWrap = true
+	s.insertMode = false
+	s.newLineMode = false
+	s.cursorVisible = true
+	s.appCursor = false
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+	s.title = ""
+	s.rowSeq = make([]uint64, s.rows)
+	s.invalidate()
+}
+
+// blankGrid 创建空白屏幕
+func (s *Screen) blankGrid() []Line {
+	grid := make([]Line, s.rows)
+	for i := range grid {
+		grid[i] = newLine(s.cols, Attr{})
+	}
+	return grid
+}
+
+// Write 输入会话的原始输出（可以在任意字节处分块）
+func (s *Screen) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parser.feed(s, data)
+	return len(data), nil
+}
+
+// Size 返回屏幕尺寸
+func (s *Screen) Size() (cols, rows int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cols, s.rows
+}
+
+// touch 标记行已修改
+func (s *Screen) touch(y int) {
+	s.seq++
+	s.rowSeq[y] = s.seq
+}
+
+// touchRange 标记 [from, to] 行已修改
+func (s *Screen) touchRange(from, to int) {
+	s.seq++
+	for y := from; y <= to; y++ {
+		s.rowSeq[y] = s.seq
+	}
+}
+
+// invalidate 使所有增量失效，客户端下次同步时获取全量内容
+func (s *Screen) invalidate() {
+	s.touchRange(0, s.rows-1)
+	s.resetSeq = s.seq
+}
+
+// clampCursor 把光标限制在屏幕内
+func (s *Screen) clampCursor() {
+	s.cursor.x = max(0, min(s.cursor.x, s.cols-1))
+	s.cursor.y = max(0, min(s.cursor.y, s.rows-1))
+	s.cursor.wrapPending = false
+}
+
+// moveTo 移动光标，originMode 下 y 相对滚动区域且不能移出滚动区域
+func (s *Screen) moveTo(x, y int) {
+	if s.cursor.originMode {
+		y = max(s.top, min(y+s.top, s.bottom))
+	}
+	s.cursor.x, s.cursor.y = x, y
+	s.clampCursor()
+}
+
+// blank 返回使用当前背景色的空白单元格
+func (s *Screen) blank() Cell {
+	return blankCell(s.cursor.attr)
+}
+
+// fixWide 写入或擦除 x 处之前，清除被拆开的宽字符的另一半
+func (s *Screen) fixWide(line *Line, x int) {
+	if x < 0 || x >= len(line.Cells) {
+		return
+	}
+	if line.Cells[x].Width == 0 && x > 0 {
+		line.Cells[x-1] = blankCell(line.Cells[x-1].Attr)
+	}
+	if line.Cells[x].Width == 2 && x+1 < len(line.Cells) {
+		line.Cells[x+1] = blankCell(line.Cells[x+1].Attr)
+	}
+}
+
+// print 在光标处写入一个可打印字符
+func (s *Screen) print(r rune) {
+	if s.cursor.charsets[s.cursor.shift] == charsetGraphics {
+		if g, ok := decSpecialGraphics[r]; ok {
+			r = g
+		}
+	}
+	w := runeWidth(r)
+	if w == 0 {
+		// 组合字符不单独占用单元格，简化处理为忽略
+		return
+	}
+	if w > s.cols {
+		return
+	}
+
+	if s.cursor.wrapPending && s.autoWrap {
+		s.grid[s.cursor.y].Wrapped = true
+		s.cursor.x = 0
+		s.index()
+	}
+	s.cursor.wrapPending = false
+	if s.cursor.x+w > s.cols {
+		if !s.autoWrap {
+			s.cursor.x = s.cols - w
+		} else {
+			// 宽字符放不下时在行尾留空并换行
+			line := &s.grid[s.cursor.y]
+			s.fixWide(line, s.cursor.x)
+			line.Cells[s.cursor.x] = s.blank()
+			line.Wrapped = true
+			s.touch(s.cursor.y)
+			s.cursor.x = 0
+			s.index()
+		}
+	}
+
+	line := &s.grid[s.cursor.y]
+	if s.insertMode {
+		s.insertCells(w)
+	}
+	s.fixWide(line, s.cursor.x)
+	if w == 2 {
+		s.fixWide(line, s.cursor.x+1)
+	}
+	line.Cells[s.cursor.x] = Cell{Ch: r, Width: uint8(w), Attr: s.cursor.attr}
+	if w == 2 {
+		line.Cells[s.cursor.x+1] = Cell{Width: 0, Attr: s.cursor.attr}
+	}
+	s.touch(s.cursor.y)
+	s.lastPrinted = r
+
+	if s.cursor.x+w >= s.cols {
+		s.cursor.x = s.cols - 1
+		s.cursor.wrapPending = true
+	} else {
+		s.cursor.x += w
+	}
+}
+
+// index 光标下移一行，位于滚动区域底部时向上滚动
+func (s *Screen) index() {
+	s.cursor.wrapPending = false
+	if s.cursor.y == s.bottom {
+		s.scrollUp(1)
+	} else if s.cursor.y < s.rows-1 {
+		s.cursor.y++
+	}
+}
+
+// reverseIndex 光标上移一行，位于滚动区域顶部时向下滚动
+func (s *Screen) reverseIndex() {
+	s.cursor.wrapPending = false
+	if s.cursor.y == s.top {
+		s.scrollDown(1)
+	} else if s.cursor.y > 0 {
+		s.cursor.y--
+	}
+}
+
+// scrollUp 滚动区域内容上移 n 行。与 tmux 一致，只有滚动区域为整个主屏幕时滚出的行才进入历史
+func (s *Screen) scrollUp(n int) {
+	s.shiftUp(s.top, n, !s.altActive && s.top == 0 && s.bottom == s.rows-1)
+}
+
+// scrollDown 滚动区域内容下移 n 行
+func (s *Screen) scrollDown(n int) {
+	s.shiftDown(s.top, n)
+}
+
+// shiftUp [top, bottom] 行上移 n 行，底部补空白行
+func (s *Screen) shiftUp(top, n int, history bool) {
+	n = min(n, s.bottom-top+1)
+	if n <= 0 {
+		return
+	}
+	if history {
+		for i := top; i < top+n; i++ {
+			s.pushScrollback(s.grid[i])
+		}
+	}
+	copy(s.grid[top:], s.grid[top+n:s.bottom+1])
+	for y := s.bottom - n + 1; y <= s.bottom; y++ {
+		s.grid[y] = newLine(s.cols, s.cursor.attr)
+	}
+	s.touchRange(top, s.bottom)
+}
+
+// shiftDown [top, bottom] 行下移 n 行，顶部补空白行
+func (s *Screen) shiftDown(top, n int) {
+	n = min(n, s.bottom-top+1)
+	if n <= 0 {
+		return
+	}
+	copy(s.grid[top+n:s.bottom+1], s.grid[top:s.bottom+1-n])
+	for y := top; y < top+n; y++ {
+		s.grid[y] = newLine(s.cols, s.cursor.attr)
+	}
+	s.touchRange(top, s.bottom)
+}
+
+// pushScrollback 把一行加入历史，超出上限时丢弃最旧的行
+func (s *Screen) pushScrollback(line Line) {
+	if s.maxScrollback == 0 {
+		return
+	}
+	if len(s.scrollback) >= s.maxScrollback {
+		drop := len(s.scrollback) - s.maxScrollback + 1
+		// 周期性压缩，避免底层数组无限增长
+		if cap(s.scrollback) > 2*s.maxScrollback {
+			s.scrollback = append([]Line(nil), s.scrollback[drop:]...)
+		} else {
+			s.scrollback = s.scrollback[drop:]
+		}
+	}
+	s.scrollback = append(s.scrollback, line)
+}
+
+// eraseCells 擦除当前屏幕第 y 行的 [from, to) 单元格
+func (s *Screen) eraseCells(y, from, to int) {
+	line := &s.grid[y]
+	from, to = max(0, from), min(to, s.cols)
+	if from >= to {
+		return
+	}
+	s.fixWide(line, from)
+	s.fixWide(line, to-1)
+	blank := s.blank()
+	for x := from; x < to; x++ {
+		line.Cells[x] = blank
+	}
+	if to == s.cols {
+		line.Wrapped = false
+	}
+	s.touch(y)
+}
+
+// eraseLines 擦除 [from, to] 行
+func (s *Screen) eraseLines(from, to int) {
+	for y := max(0, from); y <= min(to, s.rows-1); y++ {
+		s.grid[y] = newLine(s.cols, s.cursor.attr)
+	}
+	s.touchRange(max(0, from), min(to, s.rows-1))
+}
+
+// eraseDisplay ED：0 光标到屏幕末尾，1 屏幕开头到光标，2 整个屏幕，3 清除历史
+func (s *Screen) eraseDisplay(mode int) {
+	s.cursor.wrapPending = false
+	switch mode {
+	case 0:
+		s.eraseCells(s.cursor.y, s.cursor.x, s.cols)
+		s.eraseLines(s.cursor.y+1, s.rows-1)
+	case 1:
+		s.eraseLines(0, s.cursor.y-1)
+		s.eraseCells(s.cursor.y, 0, s.cursor.x+1)
+	case 2:
+		s.eraseLines(0, s.rows-1)
+	case 3:
+		s.scrollback = nil
+		s.seq++
+	}
+}
+
+// eraseLine EL：0 光标到行尾，1 行首到光标，2 整行
+func (s *Screen) eraseLine(mode int) {
+	s.cursor.wrapPending = false
+	switch mode {
+	case 0:
+		s.eraseCells(s.cursor.y, s.cursor.x, s.cols)
+	case 1:
+		s.eraseCells(s.cursor.y, 0, s.cursor.x+1)
+	case 2:
+		s.eraseCells(s.cursor.y, 0, s.cols)
+	}
+}
+
+// insertCells ICH：在光标处插入 n 个空白单元格，右侧内容右移
+func (s *Screen) insertCells(n int) {
+	line := &s.grid[s.cursor.y]
+	x := s.cursor.x
+	n = min(n, s.cols-x)
+	s.fixWide(line, x)
+	s.fixWide(line, s.cols-n-1)
+	copy(line.Cells[x+n:], line.Cells[x:s.cols-n])
+	blank := s.blank()
+	for i := x; i < x+n; i++ {
+		line.Cells[i] = blank
+	}
+	s.touch(s.cursor.y)
+}
+
+// deleteCells DCH：删除光标处的 n 个单元格，右侧内容左移
+func (s *Screen) deleteCells(n int) {
+	line := &s.grid[s.cursor.y]
+	x := s.cursor.x
+	n = min(n, s.cols-x)
+	s.fixWide(line, x)
+	s.fixWide(line, x+n-1)
+	copy(line.Cells[x:], line.Cells[x+n:])
+	blank := s.blank()
+	for i := s.cols - n; i < s.cols; i++ {
+		line.Cells[i] = blank
+	}
+	s.touch(s.cursor.y)
+}
+
+// insertLines IL：在光标行插入 n 行（仅在滚动区域内有效）
+func (s *Screen) insertLines(n int) {
+	if s.cursor.y < s.top || s.cursor.y > s.bottom {
+		return
+	}
+	s.shiftDown(s.cursor.y, n)
+	s.cursor.x = 0
+	s.cursor.wrapPending = false
+}
+
+// deleteLines DL：删除光标行开始的 n 行（仅在滚动区域内有效）
+func (s *Screen) deleteLines(n int) {
+	if s.cursor.y < s.top || s.cursor.y > s.bottom {
+		return
+	}
+	// 删除的行不进入历史
+	s.shiftUp(s.cursor.y, n, false)
+	s.cursor.x = 0
+	s.cursor.wrapPending = false
+}
+
+// tab 移动到下一个（n 为负时上一个）制表位
+func (s *Screen) tab(n int) {
+	s.cursor.wrapPending = false
+	for ; n > 0; n-- {
+		x := s.cursor.x + 1
+		for x < s.cols-1 && !s.tabs[x] {
+			x++
+		}
+		s.cursor.x = min(x, s.cols-1)
+	}
+	for ; n < 0; n++ {
+		x := s.cursor.x - 1
+		for x > 0 && !s.tabs[x] {
+			x--
+		}
+		s.cursor.x = max(x, 0)
+	}
+}
+
+// saveCursor DECSC：保存光标位置、属性和字符集
+func (s *Screen) saveCursor() {
+	if s.altActive {
+		s.savedAlt = s.cursor
+	} else {
+		s.savedPrimary = s.cursor
+	}
+}
+
+// restoreCursor DECRC：恢复保存的光标
+func (s *Screen) restoreCursor() {
+	if s.altActive {
+		s.cursor = s.savedAlt
+	} else {
+		s.cursor = s.savedPrimary
+	}
+	s.clampCursor()
+}
+
+// setAlternate 切换备用屏幕，clear 为 true 时进入前清空备用屏幕
+func (s *Screen) setAlternate(on, clear bool) {
+	if on == s.altActive {
+		return
+	}
+	if on {
+		if clear {
+			s.alternate = s.blankGrid()
+		}
+		s.grid = s.alternate
+	} else {
+		s.grid = s.primary
+	}
+	s.altActive = on
+	s.invalidate()
+}
+
+// setScrollRegion DECSTBM：设置滚动区域并把光标移到原点
+func (s *Screen) setScrollRegion(top, bottom int) {
+	if bottom < 0 || bottom >= s.rows {
+		bottom = s.rows - 1
+	}
+	top = max(0, top)
+	if top >= bottom {
+		return
+	}
+	s.top, s.bottom = top, bottom
+	s.moveTo(0, 0)
+}
+
+// alignmentTest DECALN：用 E 填满屏幕
+func (s *Screen) alignmentTest() {
+	for y := range s.grid {
+		for x := range s.grid[y].Cells {
+			s.grid[y].Cells[x] = Cell{Ch: 'E', Width: 1}
+		}
+		s.grid[y].Wrapped = false
+	}
+	s.top, s.bottom = 0, s.rows-1
+	s.moveTo(0, 0)
+	s.touchRange(0, s.rows-1)
+}
@@ -0,0 +1,248 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxSearchResults 单次搜索最多返回的匹配数
+const MaxSearchResults = 200
+
+// Span 一段样式相同的连续文本
+type Span struct {
+	Text      string `json:"text"`
+	FG        Color  `json:"fg,omitempty"`
+	BG        Color  `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Dim       bool   `json:"dim,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	Blink     bool   `json:"blink,omitempty"`
+	Reverse   bool   `json:"reverse,omitempty"`
+	Hidden    bool   `json:"hidden,omitempty"`
+	Strike    bool   `json:"strike,omitempty"`
+}
+
+// newSpan 创建指定样式的空文本段
+func newSpan(attr Attr) Span {
+	return Span{
+		FG:        attr.FG,
+		BG:        attr.BG,
+		Bold:      attr.Flags&AttrBold != 0,
+		Dim:       attr.Flags&AttrDim != 0,
+		Italic:    attr.Flags&AttrItalic != 0,
+		Underline: attr.Flags&AttrUnderline != 0,
+		Blink:     attr.Flags&AttrBlink != 0,
+		Reverse:   attr.Flags&AttrReverse != 0,
+		Hidden:    attr.Flags&AttrHidden != 0,
+		Strike:    attr.Flags&AttrStrike != 0,
+	}
+}
+
+// Row 一行内容
+type Row struct {
+	Y       int    `json:"y"` // 相对屏幕顶部的行号，历史行为负数（-1 为最近滚出的行）
+	Spans   []Span `json:"spans"`
+	Wrapped bool   `json:"wrapped,omitempty"`
+}
+
+// newRow 把一行单元格合并为样式相同的文本段，去除末尾无样式的空白
+func newRow(y int, line Line) Row {
+	cells := line.Cells
+	end := len(cells)
+	for end > 0 && cells[end-1].Width != 0 && cells[end-1].Ch == ' ' && cells[end-1].Attr == (Attr{}) {
+		end--
+	}
+
+	row := Row{Y: y, Spans: make([]Span, 0, 1), Wrapped: line.Wrapped}
+	var text strings.Builder
+	var current Attr
+	flush := func() {
+		if text.Len() > 0 {
+			span := newSpan(current)
+			span.Text = text.String()
+			row.Spans = append(row.Spans, span)
+			text.Reset()
+		}
+	}
+	for _, cell := range cells[:end] {
+		if cell.Width == 0 {
+			continue
+		}
+		if cell.Attr != current {
+			flush()
+			current = cell.Attr
+		}
+		text.WriteRune(cell.Ch)
+	}
+	flush()
+	return row
+}
+
+// Cursor 光标状态
+type Cursor struct {
+	X       int  `json:"x"`
+	Y       int  `json:"y"`
+	Visible bool `json:"visible"`
+}
+
+// State 屏幕状态。Full 为 false 时 Rows 只包含 Since 之后修改过的行
+type State struct {
+	Cols            int    `json:"cols"`
+	Rows            int    `json:"rows"`
+	Cursor          Cursor `json:"cursor"`
+	AlternateScreen bool   `json:"alternate_screen"`
+	AppCursorKeys   bool   `json:"app_cursor_keys,omitempty"`
+	Title           string `json:"title,omitempty"`
+	Seq             uint64 `json:"seq"` // 下次增量同步时作为 since 传入
+	Full            bool   `json:"full"`
+	Lines           []Row  `json:"lines"`
+	Scrollback      []Row  `json:"scrollback,omitempty"` // 最近的历史行（旧的在前）
+	ScrollbackSize  int    `json:"scrollback_size"`
+}
+
+// State 返回屏幕状态。since 为上次同步得到的 Seq，为 0 或已失效时返回全部行；
+// scrollback 为附带的历史行数
+func (s *Screen) State(since uint64, scrollback int) State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := State{
+		Cols:            s.cols,
+		Rows:            s.rows,
+		Cursor:          Cursor{X: s.cursor.x, Y: s.cursor.y, Visible: s.cursorVisible},
+		AlternateScreen: s.altActive,
+		AppCursorKeys:   s.appCursor,
+		Title:           s.title,
+		Seq:             s.seq,
+		Full:            since == 0 || since < s.resetSeq || since > s.seq,
+		Lines:           make([]Row, 0, s.rows),
+		ScrollbackSize:  len(s.scrollback),
+	}
+	for y, line := range s.grid {
+		if state.Full || s.rowSeq[y] > since {
+			state.Lines = append(state.Lines, newRow(y, line))
+		}
+	}
+	if scrollback > 0 {
+		start := max(0, len(s.scrollback)-scrollback)
+		for i, line := range s.scrollback[start:] {
+			state.Scrollback = append(state.Scrollback, newRow(start+i-len(s.scrollback), line))
+		}
+	}
+	return state
+}
+
+// Text 返回屏幕各行的纯文本（去除行尾空白）
+func (s *Screen) Text() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lines := make([]string, len(s.grid))
+	for y, line := range s.grid {
+		lines[y] = line.Text()
+	}
+	return lines
+}
+
+// Match 搜索匹配的位置，行号规则与 Row.Y 相同
+type Match struct {
+	Y      int    `json:"y"`
+	X      int    `json:"x"`
+	Length int    `json:"length"` // 匹配文本占用的单元格数
+	Line   string `json:"line"`   // 匹配所在的逻辑行（自动换行的多行合并）
+}
+
+// Search 在历史和屏幕中搜索文本，自动换行拆开的行合并后再匹配，返回从新到旧的匹配
+func (s *Screen) Search(query string, ignoreCase bool) []Match {
+	if query == "" {
+		return nil
+	}
+	needle := []rune(query)
+	if ignoreCase {
+		needle = toLower(needle)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// 历史行在前，屏幕行在后；位置编号与 Row.Y 一致
+	all := make([]Line, 0, len(s.scrollback)+len(s.grid))
+	all = append(all, s.scrollback...)
+	all = append(all, s.grid...)
+	offset := len(s.scrollback)
+
+	type position struct{ y, x, width int }
+	var matches []Match
+	for end := len(all) - 1; end >= 0 && len(matches) < MaxSearchResults; {
+		// 向上找到逻辑行的起点
+		start := end
+		for start > 0 && all[start-1].Wrapped {
+			start--
+		}
+
+		var text []rune
+		var positions []position
+		for i := start; i <= end; i++ {
+			for x, cell := range all[i].Cells {
+				if cell.Width == 0 {
+					continue
+				}
+				text = append(text, cell.Ch)
+				positions = append(positions, position{i - offset, x, int(cell.Width)})
+			}
+		}
+		logical := strings.TrimRight(string(text), " ")
+		haystack := text
+		if ignoreCase {
+			haystack = toLower(text)
+		}
+
+		var found []Match
+		for i := 0; i+len(needle) <= len(haystack); i++ {
+			if string(haystack[i:i+len(needle)]) != string(needle) {
+				continue
+			}
+			length := 0
+			for _, p := range positions[i : i+len(needle)] {
+				length += p.width
+			}
+			found = append(found, Match{Y: positions[i].y, X: positions[i].x, Length: length, Line: logical})
+			i += len(needle) - 1
+		}
+		// 同一逻辑行中的匹配也按从新到旧（从后往前）排列
+		for i := len(found) - 1; i >= 0 && len(matches) < MaxSearchResults; i-- {
+			matches = append(matches, found[i])
+		}
+		end = start - 1
+	}
+	return matches
+}
+
+// toLower 逐个字符转为小写，保持字符数不变以便映射回单元格位置
+func toLower(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
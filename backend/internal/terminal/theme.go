@@ -0,0 +1,164 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"strconv"
+)
+
+// Theme 渲染截图使用的配色：前景、背景、光标和 16 色调色板（#rrggbb）
+type Theme struct {
+	Name       string     `json:"name"`
+	Foreground string     `json:"foreground"`
+	Background string     `json:"background"`
+	Cursor     string     `json:"cursor"`
+	Palette    [16]string `json:"palette"` // 0-7 为普通色，8-15 为亮色
+}
+
+// BuiltinThemes 内置配色
+var BuiltinThemes = []Theme{
+	{
+		Name:       "dark",
+		Foreground: "#d4d4d4",
+		Background: "#1e1e1e",
+		Cursor:     "#aeafad",
+		Palette: [16]string{
+			"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+			"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+		},
+	},
+	{
+		Name:       "light",
+		Foreground: "#333333",
+		Background: "#ffffff",
+		Cursor:     "#000000",
+		Palette: [16]string{
+			"#000000", "#cd3131", "#00bc00", "#949800", "#0451a5", "#bc05bc", "#0598bc", "#555555",
+			"#666666", "#cd3131", "#14ce14", "#b5ba00", "#0451a5", "#bc05bc", "#0598bc", "#a5a5a5",
+		},
+	},
+	{
+		Name:       "solarized-dark",
+		Foreground: "#839496",
+		Background: "#002b36",
+		Cursor:     "#93a1a1",
+		Palette: [16]string{
+			"#073642", "#dc322f", "#859900", "#b58900", "#268bd2", "#d33682", "#2aa198", "#eee8d5",
+			"#002b36", "#cb4b16", "#586e75", "#657b83", "#839496", "#6c71c4", "#93a1a1", "#fdf6e3",
+		},
+	},
+}
+
+// LoadThemes 加载配色：自定义配色文件（JSON 数组）中的配色与内置配色同名时覆盖内置配色。
+// 文件不存在时只使用内置配色
+func LoadThemes(path string) ([]Theme, error) {
+	var custom []Theme
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &custom); err != nil {
+				return nil, fmt.Errorf("invalid themes file %s: %w", path, err)
+			}
+		}
+	}
+
+	themes := append([]Theme{}, custom...)
+	overridden := make(map[string]bool, len(custom))
+	for _, theme := range custom {
+		overridden[theme.Name] = true
+	}
+	for _, theme := range BuiltinThemes {
+		if !overridden[theme.Name] {
+			themes = append(themes, theme)
+		}
+	}
+	return themes, nil
+}
+
+// palette 解析后的配色
+type palette struct {
+	fg, bg, cursor color.RGBA
+	colors         [256]color.RGBA
+}
+
+// compile 校验并解析配色，16 色之外的 256 色按 xterm 的色阶计算
+func (t Theme) compile() (*palette, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("theme requires a name")
+	}
+	p := &palette{}
+	parse := func(field, value string, target *color.RGBA) error {
+		c, err := parseHexColor(value)
+		if err != nil {
+			return fmt.Errorf("theme %s: invalid %s: %w", t.Name, field, err)
+		}
+		*target = c
+		return nil
+	}
+	if err := parse("foreground", t.Foreground, &p.fg); err != nil {
+		return nil, err
+	}
+	if err := parse("background", t.Background, &p.bg); err != nil {
+		return nil, err
+	}
+	if err := parse("cursor", t.Cursor, &p.cursor); err != nil {
+		return nil, err
+	}
+	for i, value := range t.Palette {
+		if err := parse(fmt.Sprintf("palette[%d]", i), value, &p.colors[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	levels := [6]uint8{0, 95, 135, 175, 215, 255}
+	for i := 16; i < 232; i++ {
+		n := i - 16
+		p.colors[i] = color.RGBA{levels[n/36], levels[n/6%6], levels[n%6], 0xff}
+	}
+	for i := 232; i < 256; i++ {
+		v := uint8(8 + 10*(i-232))
+		p.colors[i] = color.RGBA{v, v, v, 0xff}
+	}
+	return p, nil
+}
+
+// parseHexColor 解析 #rrggbb
+func parseHexColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("expected #rrggbb, got %q", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("expected #rrggbb, got %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
+// hexColor 格式化为 #rrggbb
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,321 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package terminal
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+)
+
+const (
+	// trackerSyncInterval 检查 pane 尺寸、活动 pane 和空闲模型的间隔
+	trackerSyncInterval = 2 * time.Second
+	// modelIdleTimeout 模型多久无人使用后释放
+	modelIdleTimeout = 10 * time.Minute
+)
+
+// model 一个会话的屏幕模型，跟踪会话当前窗口的活动 pane
+type model struct {
+	pane      tmux.PaneState // 创建模型时 pane 的状态
+	sessionID string         // 创建模型时会话的 ID，同名的新会话不复用旧模型
+	screen    *Screen
+	cancel    func()
+	lastUsed  time.Time
+}
+
+// Tracker 为会话维护共享的屏幕模型：首次使用时用 capture-pane 初始化，
+// 之后由会话的增量输出驱动，所有查看者共用同一个模型；空闲一段时间后释放。
+// pane 尺寸或活动 pane 变化时重新初始化
+type Tracker struct {
+	manager    *tmux.Manager
+	scrollback int
+
+	models map[string]*model // 会话名 -> 模型
+	mu     sync.Mutex
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewTracker 创建屏幕模型管理器，scrollback 为每个模型保留的历史行数
+func NewTracker(manager *tmux.Manager, scrollback int) *Tracker {
+	return &Tracker{
+		manager:    manager,
+		scrollback: scrollback,
+		models:     make(map[string]*model),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start 启动定期同步，并在会话重命名、删除或退出时释放其模型
+func (t *Tracker) Start() {
+	go func() {
+		ticker := time.NewTicker(trackerSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.sync()
+			}
+		}
+	}()
+
+	t.manager.AddSessionHook(t.sessionChanged)
+}
+
+// sessionChanged 会话钩子：会话重命名、删除或退出时释放其模型。
+// 释放时会取消输出订阅，不能在 Manager 持有锁时执行，因此放到协程中
+func (t *Tracker) sessionChanged(eventType events.Type, name, oldName string) {
+	if eventType == events.SessionRenamed {
+		name = oldName
+	}
+	go t.release(name)
+}
+
+// Stop 停止同步并释放所有模型
+func (t *Tracker) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for name, m := range t.models {
+			m.cancel()
+			delete(t.models, name)
+		}
+	})
+}
+
+// Screen 返回会话的屏幕模型，不存在时创建
+func (t *Tracker) Screen(session *tmux.Session) (*Screen, error) {
+	t.mu.Lock()
+	if m, ok := t.models[session.Name]; ok && m.sessionID == session.ID {
+		m.lastUsed = time.Now()
+		t.mu.Unlock()
+		return m.screen, nil
+	}
+	t.mu.Unlock()
+
+	pane, err := t.manager.PaneState("=" + session.Name + ":")
+	if err != nil {
+		return nil, err
+	}
+	m, err := t.open(session.Name, pane)
+	if err != nil {
+		return nil, err
+	}
+	m.sessionID = session.ID
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if existing, ok := t.models[session.Name]; ok {
+		if existing.sessionID == session.ID {
+			// 并发创建时使用先创建的模型
+			m.cancel()
+			existing.lastUsed = time.Now()
+			return existing.screen, nil
+		}
+		// 同名的旧会话留下的模型
+		existing.cancel()
+	}
+	t.models[session.Name] = m
+	return m.screen, nil
+}
+
+// release 释放会话的模型
+func (t *Tracker) release(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if m, ok := t.models[name]; ok {
+		m.cancel()
+		delete(t.models, name)
+	}
+}
+
+// open 订阅会话输出并用 pane 当前内容初始化模型。
+// 先订阅再截取，截取前已收到的输出已经包含在截取的内容中，被丢弃
+func (t *Tracker) open(session string, pane tmux.PaneState) (*model, error) {
+	ch, cancel := t.manager.SubscribeOutput(session, 256)
+	for drained := false; !drained; {
+		select {
+		case <-ch:
+		default:
+			drained = true
+		}
+	}
+
+	screen, err := t.seed(pane)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		for chunk := range ch {
+			if chunk.Pane == pane.ID {
+				screen.Write(chunk.Data)
+			}
+		}
+	}()
+	return &model{pane: pane, screen: screen, cancel: cancel, lastUsed: time.Now()}, nil
+}
+
+// seed 根据 capture-pane 的结果构造屏幕：历史、主屏幕（处于备用屏幕时）、可见区域，
+// 最后恢复光标位置和终端模式
+func (t *Tracker) seed(pane tmux.PaneState) (*Screen, error) {
+	screen := NewScreen(pane.Width, pane.Height, t.scrollback)
+
+	var history []string
+	if pane.HistorySize > 0 && t.scrollback > 0 {
+		var err error
+		if history, err = t.manager.CapturePaneHistory(pane.ID, min(pane.HistorySize, t.scrollback)); err != nil {
+			return nil, err
+		}
+	}
+	var saved []string
+	if pane.AlternateScreen {
+		var err error
+		if saved, err = t.manager.CapturePaneScreen(pane.ID, true); err != nil {
+			return nil, err
+		}
+	}
+	visible, err := t.manager.CapturePaneScreen(pane.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	// 截取之后再读取光标，与可见区域的内容尽量一致
+	state, err := t.manager.PaneState(pane.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	screen.mu.Lock()
+	defer screen.mu.Unlock()
+
+	for _, line := range history {
+		screen.pushScrollback(parseLine(line, screen.cols))
+	}
+	if pane.AlternateScreen {
+		screen.paint(saved)
+		screen.cursor = cursor{x: state.AltSavedX, y: state.AltSavedY}
+		screen.clampCursor()
+		screen.saveCursor()
+		screen.setAlternate(true, true)
+	}
+	screen.paint(visible)
+
+	screen.cursor = cursor{x: state.CursorX, y: state.CursorY, originMode: state.OriginMode}
+	screen.clampCursor()
+	screen.cursorVisible = state.CursorVisible
+	screen.insertMode = state.InsertMode
+	screen.appCursor = state.AppCursorKeys
+	screen.autoWrap = state.AutoWrap
+	if state.ScrollTop < state.ScrollBottom && state.ScrollBottom < screen.rows {
+		screen.top, screen.bottom = state.ScrollTop, state.ScrollBottom
+	}
+	screen.title = state.Title
+	screen.invalidate()
+	return screen, nil
+}
+
+// paint 从第一行开始逐行写入截取的内容（调用方需持有屏幕的锁）
+func (s *Screen) paint(lines []string) {
+	for y, line := range lines {
+		if y >= s.rows {
+			break
+		}
+		s.cursor = cursor{y: y}
+		s.parser = parser{}
+		s.parser.feed(s, []byte(line))
+	}
+	s.cursor = cursor{}
+	s.parser = parser{}
+}
+
+// parseLine 把一行带控制序列的文本解析为单元格
+func parseLine(text string, cols int) Line {
+	screen := NewScreen(cols, 1, 0)
+	screen.parser.feed(screen, []byte(text))
+	return screen.grid[0]
+}
+
+// sync 释放空闲的模型和已关闭的 pane 的模型，pane 尺寸或活动 pane 变化时重新初始化
+func (t *Tracker) sync() {
+	t.mu.Lock()
+	empty := len(t.models) == 0
+	t.mu.Unlock()
+	if empty {
+		return
+	}
+
+	panes, err := t.manager.ListPanes()
+	if err != nil {
+		// tmux 服务不可用时等待对账恢复
+		return
+	}
+	active := make(map[string]tmux.PaneState)
+	for _, pane := range panes {
+		if pane.Active {
+			active[pane.Session] = pane
+		}
+	}
+
+	stale := make(map[string]tmux.PaneState)
+	t.mu.Lock()
+	now := time.Now()
+	for name, m := range t.models {
+		pane, ok := active[name]
+		if !ok || now.Sub(m.lastUsed) > modelIdleTimeout {
+			m.cancel()
+			delete(t.models, name)
+			continue
+		}
+		if pane.ID != m.pane.ID || pane.Width != m.pane.Width || pane.Height != m.pane.Height {
+			stale[name] = pane
+		}
+	}
+	t.mu.Unlock()
+
+	for name, pane := range stale {
+		m, err := t.open(name, pane)
+		if err != nil {
+			log.Printf("[Terminal] Failed to reload screen of session %s: %v", name, err)
+			t.release(name)
+			continue
+		}
+		t.mu.Lock()
+		if old, ok := t.models[name]; ok {
+			m.lastUsed = old.lastUsed
+			m.sessionID = old.sessionID
+			old.cancel()
+			t.models[name] = m
+		} else {
+			m.cancel()
+		}
+		t.mu.Unlock()
+	}
+}
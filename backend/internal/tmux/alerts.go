@@ -0,0 +1,471 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+)
+
+// AlertKind 提醒类型，对应 tmux 的 monitor-bell / monitor-activity / monitor-silence
+type AlertKind string
+
+const (
+	AlertBell     AlertKind = "bell"
+	AlertActivity AlertKind = "activity"
+	AlertSilence  AlertKind = "silence"
+)
+
+// MaxAlertsPerSession 每个会话保留的未读提醒上限，超出时丢弃最旧的提醒
+const MaxAlertsPerSession = 100
+
+// alertPollInterval 读取 tmux 提醒日志的间隔
+const alertPollInterval = time.Second
+
+// Alert 会话的未读提醒。同一窗口的同类提醒合并为一条并累计次数
+type Alert struct {
+	ID         string    `json:"id"`
+	Session    string    `json:"session"`
+	Kind       AlertKind `json:"kind"`
+	Window     int       `json:"window"`
+	WindowName string    `json:"window_name,omitempty"`
+	Count      int       `json:"count"`
+	FirstAt    time.Time `json:"first_at"`
+	LastAt     time.Time `json:"last_at"`
+}
+
+// AlertOptions 会话窗口启用的 tmux 监控选项
+type AlertOptions struct {
+	Bell     bool          // monitor-bell
+	Activity bool          // monitor-activity
+	Silence  time.Duration // monitor-silence，0 表示禁用
+}
+
+// enabled 是否启用了任意一种监控
+func (o AlertOptions) enabled() bool {
+	return o.Bell || o.Activity || o.Silence > 0
+}
+
+// windowOptions 返回设置窗口监控选项的 tmux 命令（不带目标时作用于当前窗口）
+func (o AlertOptions) windowOptions(target string) [][]string {
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+	withTarget := func(args ...string) []string {
+		if target == "" {
+			return append([]string{"set-option", "-w"}, args...)
+		}
+		return append([]string{"set-option", "-w", "-t", target}, args...)
+	}
+	return [][]string{
+		withTarget("monitor-bell", onOff(o.Bell)),
+		withTarget("monitor-activity", onOff(o.Activity)),
+		withTarget("monitor-silence", strconv.Itoa(int(o.Silence/time.Second))),
+	}
+}
+
+// alertsFile 未读提醒的持久化文件
+func (p *Persistence) alertsFile() string {
+	return filepath.Join(p.dataDir, "alerts.json")
+}
+
+// alertLogFile tmux 钩子追加提醒记录的日志文件
+func (p *Persistence) alertLogFile() string {
+	path := filepath.Join(p.dataDir, "alerts.log")
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// LoadAlerts 加载持久化的未读提醒
+func (p *Persistence) LoadAlerts() (map[string][]*Alert, error) {
+	data, err := os.ReadFile(p.alertsFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]*Alert{}, nil
+		}
+		return nil, err
+	}
+
+	alerts := make(map[string][]*Alert)
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// SaveAlerts 保存未读提醒
+func (p *Persistence) SaveAlerts(alerts map[string][]*Alert) error {
+	data, err := json.MarshalIndent(alerts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.alertsFile(), data, 0600)
+}
+
+// joinTmuxCommands 用 ";" 连接多条 tmux 命令，以便一次调用执行
+func joinTmuxCommands(commands [][]string) []string {
+	var args []string
+	for i, command := range commands {
+		if i > 0 {
+			args = append(args, ";")
+		}
+		args = append(args, command...)
+	}
+	return args
+}
+
+// tmuxQuote 将字符串用 tmux 命令语法的双引号包裹
+func tmuxQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// alertOptions 返回当前的监控选项
+func (m *Manager) alertOptions() AlertOptions {
+	m.alertsMu.Lock()
+	defer m.alertsMu.Unlock()
+	return m.alertOpts
+}
+
+// enableAlerts 为会话的所有窗口开启监控选项，并设置钩子将提醒写入日志文件。
+// 未启动提醒监控时不做任何操作
+func (m *Manager) enableAlerts(name string) {
+	opts := m.alertOptions()
+	if !opts.enabled() {
+		return
+	}
+
+	target := "=" + name + ":"
+	// 钩子通过 run-shell 把 "窗口序号 钩子名 会话名" 追加到日志文件
+	record := "run-shell -b " + tmuxQuote(fmt.Sprintf(
+		"echo #{window_index} #{hook} #{q:session_name} >> %s", shellQuote(m.persistence.alertLogFile())))
+
+	var newWindow []string
+	for _, option := range opts.windowOptions("") {
+		newWindow = append(newWindow, strings.Join(option, " "))
+	}
+
+	commands := [][]string{
+		// 会话没有客户端连接时，tmux 只对 "any" 动作触发当前窗口的提醒
+		{"set-option", "-t", target, "bell-action", "any"},
+		{"set-option", "-t", target, "activity-action", "any"},
+		{"set-option", "-t", target, "silence-action", "any"},
+		{"set-hook", "-t", target, "alert-bell", record},
+		{"set-hook", "-t", target, "alert-activity", record},
+		{"set-hook", "-t", target, "alert-silence", record},
+		// 新建的窗口同样开启监控
+		{"set-hook", "-t", target, "after-new-window", strings.Join(newWindow, " ; ")},
+	}
+	windows, err := listWindowIndexes(name)
+	if err != nil {
+		log.Printf("[Tmux] Failed to list windows of %s: %v", name, err)
+	}
+	for _, index := range windows {
+		commands = append(commands, opts.windowOptions(fmt.Sprintf("=%s:%d", name, index))...)
+	}
+
+	if output, err := exec.Command("tmux", joinTmuxCommands(commands)...).CombinedOutput(); err != nil {
+		log.Printf("[Tmux] Failed to enable alerts for %s: %v (%s)", name, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// listWindowIndexes 列出会话的窗口序号
+func listWindowIndexes(name string) ([]int, error) {
+	output, err := exec.Command("tmux", "list-windows", "-t", "="+name, "-F", "#{window_index}").Output()
+	if err != nil {
+		return nil, err
+	}
+	var indexes []int
+	for _, line := range splitLines(string(output)) {
+		if index, err := strconv.Atoi(line); err == nil {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes, nil
+}
+
+// StartAlertMonitor 为所有会话开启 tmux 监控选项并在后台收集提醒，未启用任何监控时不启动
+func (m *Manager) StartAlertMonitor(opts AlertOptions) {
+	if !opts.enabled() {
+		return
+	}
+
+	persisted, err := m.persistence.LoadAlerts()
+	if err != nil {
+		log.Printf("[Tmux] Failed to load alerts: %v", err)
+	}
+
+	// 丢弃已不存在的会话的提醒
+	for name := range persisted {
+		if _, err := m.GetSession(name); err != nil {
+			delete(persisted, name)
+		}
+	}
+
+	m.alertsMu.Lock()
+	m.alertOpts = opts
+	for name, alerts := range persisted {
+		m.alerts[name] = alerts
+	}
+	m.alertsMu.Unlock()
+
+	for _, session := range m.ListSessions() {
+		m.enableAlerts(session.Name)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(alertPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.drainAlertLog()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	log.Printf("[Tmux] Alert monitor enabled (bell: %v, activity: %v, silence: %s)",
+		opts.Bell, opts.Activity, opts.Silence)
+}
+
+// drainAlertLog 读取并清空 tmux 钩子写入的提醒日志
+func (m *Manager) drainAlertLog() {
+	logFile := m.persistence.alertLogFile()
+	pending := logFile + ".pending"
+
+	// 先改名再读取，钩子随后的写入会创建新的日志文件
+	if err := os.Rename(logFile, pending); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Tmux] Failed to rotate alert log: %v", err)
+		return
+	}
+	data, err := os.ReadFile(pending)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Tmux] Failed to read alert log: %v", err)
+		}
+		return
+	}
+	os.Remove(pending)
+
+	for _, line := range splitLines(string(data)) {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		window, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		kind := AlertKind(strings.TrimPrefix(fields[1], "alert-"))
+		switch kind {
+		case AlertBell, AlertActivity, AlertSilence:
+			m.recordAlert(fields[2], kind, window)
+		}
+	}
+}
+
+// recordAlert 记录一条提醒并发布事件，与未读的同窗口同类提醒合并
+func (m *Manager) recordAlert(name string, kind AlertKind, window int) {
+	session, err := m.GetSession(name)
+	if err != nil {
+		return
+	}
+
+	windowName := ""
+	output, err := exec.Command("tmux", "display-message", "-p", "-t",
+		fmt.Sprintf("=%s:%d", name, window), "#{window_name}").Output()
+	if err == nil {
+		windowName = strings.TrimSpace(string(output))
+	}
+
+	now := time.Now()
+	m.alertsMu.Lock()
+	var alert *Alert
+	for _, a := range m.alerts[name] {
+		if a.Kind == kind && a.Window == window {
+			alert = a
+			break
+		}
+	}
+	if alert != nil {
+		alert.Count++
+		alert.LastAt = now
+		alert.WindowName = windowName
+	} else {
+		alert = &Alert{
+			ID:         fmt.Sprintf("alert_%d", now.UnixNano()),
+			Session:    name,
+			Kind:       kind,
+			Window:     window,
+			WindowName: windowName,
+			Count:      1,
+			FirstAt:    now,
+			LastAt:     now,
+		}
+		alerts := append(m.alerts[name], alert)
+		if len(alerts) > MaxAlertsPerSession {
+			alerts = alerts[len(alerts)-MaxAlertsPerSession:]
+		}
+		m.alerts[name] = alerts
+	}
+	recorded := *alert
+	m.saveAlertsLocked()
+	m.alertsMu.Unlock()
+
+	m.emit(events.SessionAlert, session, recorded)
+}
+
+// saveAlertsLocked 持久化未读提醒（调用方需持有 alertsMu）
+func (m *Manager) saveAlertsLocked() {
+	if err := m.persistence.SaveAlerts(m.alerts); err != nil {
+		log.Printf("[Tmux] Failed to persist alerts: %v", err)
+	}
+}
+
+// Alerts 返回会话的未读提醒，按首次出现时间排序
+func (m *Manager) Alerts(name string) []Alert {
+	m.alertsMu.Lock()
+	defer m.alertsMu.Unlock()
+
+	alerts := make([]Alert, 0, len(m.alerts[name]))
+	for _, a := range m.alerts[name] {
+		alerts = append(alerts, *a)
+	}
+	return alerts
+}
+
+// UnreadAlertCount 返回会话的未读提醒次数
+func (m *Manager) UnreadAlertCount(name string) int {
+	m.alertsMu.Lock()
+	defer m.alertsMu.Unlock()
+
+	count := 0
+	for _, a := range m.alerts[name] {
+		count += a.Count
+	}
+	return count
+}
+
+// AcknowledgeAlerts 确认会话的提醒，ids 为空表示全部确认，返回被确认的提醒
+func (m *Manager) AcknowledgeAlerts(name string, ids []string) ([]Alert, error) {
+	session, err := m.GetSession(name)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	m.alertsMu.Lock()
+	var acked []Alert
+	var remaining []*Alert
+	for _, a := range m.alerts[name] {
+		if len(ids) == 0 || selected[a.ID] {
+			acked = append(acked, *a)
+		} else {
+			remaining = append(remaining, a)
+		}
+	}
+	if len(acked) > 0 {
+		if len(remaining) == 0 {
+			delete(m.alerts, name)
+		} else {
+			m.alerts[name] = remaining
+		}
+		m.saveAlertsLocked()
+	}
+	m.alertsMu.Unlock()
+
+	if len(acked) == 0 {
+		return acked, nil
+	}
+
+	for _, a := range acked {
+		if a.Kind != AlertBell {
+			m.rearmAlerts(name)
+			break
+		}
+	}
+
+	ackedIDs := make([]string, 0, len(acked))
+	for _, a := range acked {
+		ackedIDs = append(ackedIDs, a.ID)
+	}
+	m.emit(events.AlertsAcked, session, map[string]interface{}{"ids": ackedIDs})
+
+	return acked, nil
+}
+
+// rearmAlerts 清除会话窗口上的 tmux 提醒标记以便再次触发提醒。没有客户端连接时，
+// tmux 的活动/静默提醒触发一次后会一直保留标记直到窗口被选中。
+// kill-session -C 只清除标记，不切换窗口也不结束会话；未确认的同窗口提醒再次触发时会合并计数
+func (m *Manager) rearmAlerts(name string) {
+	if output, err := exec.Command("tmux", "kill-session", "-C", "-t", "="+name).CombinedOutput(); err != nil {
+		log.Printf("[Tmux] Failed to re-arm alerts for %s: %v (%s)", name, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// renameAlerts 会话重命名后迁移其未读提醒
+func (m *Manager) renameAlerts(oldName, newName string) {
+	m.alertsMu.Lock()
+	defer m.alertsMu.Unlock()
+
+	alerts, ok := m.alerts[oldName]
+	if !ok {
+		return
+	}
+	for _, a := range alerts {
+		a.Session = newName
+	}
+	delete(m.alerts, oldName)
+	m.alerts[newName] = alerts
+	m.saveAlertsLocked()
+}
+
+// dropAlerts 删除会话的所有未读提醒
+func (m *Manager) dropAlerts(name string) {
+	m.alertsMu.Lock()
+	defer m.alertsMu.Unlock()
+
+	if _, ok := m.alerts[name]; !ok {
+		return
+	}
+	delete(m.alerts, name)
+	m.saveAlertsLocked()
+}
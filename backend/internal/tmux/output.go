@@ -0,0 +1,251 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// outputPollInterval 检查 pane 变化并接入输出管道的间隔
+const outputPollInterval = 2 * time.Second
+
+// OutputChunk 一个 pane 的原始输出片段（包含终端控制序列）
+type OutputChunk struct {
+	Session string
+	Pane    string // tmux pane ID，如 %3
+	Data    []byte
+}
+
+// outputSubscriber 输出订阅者
+type outputSubscriber struct {
+	session string // 为空表示订阅所有会话
+	ch      chan OutputChunk
+}
+
+// panePipe 通过 tmux pipe-pane 接入的 pane 输出管道
+type panePipe struct {
+	id      string
+	session string
+	fifo    string
+	file    *os.File
+}
+
+// outputStreams 增量输出流：按需用 pipe-pane 把 pane 输出写入命名管道，
+// 读取后分发给订阅者，避免反复全量 capture-pane
+type outputStreams struct {
+	mu          sync.Mutex
+	subscribers map[int]*outputSubscriber
+	nextID      int
+	pipes       map[string]*panePipe // pane ID -> 管道
+	running     bool
+}
+
+// SubscribeOutput 订阅会话的增量输出，session 为空表示所有会话。
+// 返回时会话的 pane 已接入输出管道；订阅者处理缓慢时丢弃输出片段；返回的函数用于取消订阅
+func (m *Manager) SubscribeOutput(session string, buffer int) (<-chan OutputChunk, func()) {
+	streams := &m.output
+	ch := make(chan OutputChunk, buffer)
+
+	streams.mu.Lock()
+	id := streams.nextID
+	streams.nextID++
+	streams.subscribers[id] = &outputSubscriber{session: session, ch: ch}
+	start := !streams.running
+	streams.running = true
+	streams.mu.Unlock()
+
+	m.syncOutputPipes()
+	if start {
+		m.wg.Add(1)
+		go m.runOutputStreams()
+	}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			streams.mu.Lock()
+			delete(streams.subscribers, id)
+			close(ch)
+			streams.mu.Unlock()
+		})
+	}
+	return ch, cancel
+}
+
+// runOutputStreams 定期为订阅的会话接入新 pane、移除已关闭的 pane
+func (m *Manager) runOutputStreams() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(outputPollInterval)
+	defer ticker.Stop()
+	for {
+		m.syncOutputPipes()
+		select {
+		case <-ticker.C:
+		case <-m.done:
+			m.output.mu.Lock()
+			for id, pipe := range m.output.pipes {
+				m.stopPipe(pipe)
+				delete(m.output.pipes, id)
+			}
+			m.output.mu.Unlock()
+			return
+		}
+	}
+}
+
+// syncOutputPipes 使输出管道与订阅者关注的会话及其当前的 pane 保持一致
+func (m *Manager) syncOutputPipes() {
+	streams := &m.output
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	all := false
+	wanted := make(map[string]bool)
+	for _, sub := range streams.subscribers {
+		if sub.session == "" {
+			all = true
+		}
+		wanted[sub.session] = true
+	}
+
+	panes := make(map[string]string) // pane ID -> 会话名
+	if len(wanted) > 0 {
+		output, err := exec.Command("tmux", "list-panes", "-a", "-F", "#{pane_id} #{session_name}").Output()
+		if err != nil {
+			// tmux 服务不可用，等待对账恢复
+			return
+		}
+		for _, line := range splitLines(string(output)) {
+			if id, session, ok := strings.Cut(line, " "); ok {
+				panes[id] = session
+			}
+		}
+	}
+
+	isWanted := func(session string) bool {
+		if all {
+			_, err := m.GetSession(session)
+			return err == nil
+		}
+		return wanted[session]
+	}
+
+	for id, pipe := range streams.pipes {
+		session, exists := panes[id]
+		if !exists || !isWanted(session) {
+			m.stopPipe(pipe)
+			delete(streams.pipes, id)
+			continue
+		}
+		// 会话可能已被重命名
+		pipe.session = session
+	}
+
+	for id, session := range panes {
+		if _, piped := streams.pipes[id]; piped || !isWanted(session) {
+			continue
+		}
+		pipe, err := m.startPipe(id, session)
+		if err != nil {
+			log.Printf("[Tmux] Failed to stream output of pane %s (%s): %v", id, session, err)
+			continue
+		}
+		streams.pipes[id] = pipe
+	}
+}
+
+// startPipe 为 pane 创建命名管道并用 pipe-pane 接入其输出。
+// 会替换 pane 上已有的 pipe-pane（包括上次运行遗留的管道）
+func (m *Manager) startPipe(id, session string) (*panePipe, error) {
+	dir := filepath.Join(m.persistence.dataDir, "pipes")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fifo := filepath.Join(dir, strings.TrimPrefix(id, "%")+".fifo")
+	os.Remove(fifo)
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		return nil, err
+	}
+
+	// 以读写方式打开，写端 (cat) 退出时读端不会收到 EOF
+	file, err := os.OpenFile(fifo, os.O_RDWR, 0)
+	if err != nil {
+		os.Remove(fifo)
+		return nil, err
+	}
+
+	if err := exec.Command("tmux", "pipe-pane", "-O", "-t", id, "exec cat > "+shellQuote(fifo)).Run(); err != nil {
+		file.Close()
+		os.Remove(fifo)
+		return nil, err
+	}
+
+	pipe := &panePipe{id: id, session: session, fifo: fifo, file: file}
+	go m.readPipe(pipe)
+	return pipe, nil
+}
+
+// stopPipe 关闭 pane 的 pipe-pane 和命名管道（调用方需持有 output.mu）
+func (m *Manager) stopPipe(pipe *panePipe) {
+	exec.Command("tmux", "pipe-pane", "-t", pipe.id).Run()
+	pipe.file.Close()
+	os.Remove(pipe.fifo)
+}
+
+// readPipe 读取命名管道并分发给订阅者，管道关闭后退出
+func (m *Manager) readPipe(pipe *panePipe) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := pipe.file.Read(buf)
+		if n > 0 {
+			m.dispatchOutput(pipe, bytes.Clone(buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// dispatchOutput 把输出片段发送给关注该会话的订阅者
+func (m *Manager) dispatchOutput(pipe *panePipe, data []byte) {
+	streams := &m.output
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	chunk := OutputChunk{Session: pipe.session, Pane: pipe.id, Data: data}
+	for _, sub := range streams.subscribers {
+		if sub.session != "" && sub.session != chunk.Session {
+			continue
+		}
+		select {
+		case sub.ch <- chunk:
+		default:
+		}
+	}
+}
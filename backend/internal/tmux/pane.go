@@ -0,0 +1,142 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// paneFormat 查询 pane 状态的格式。tmux 会把输出中的制表符替换为下划线，
+// 因此字段以空格分隔（会话名不含空格），可能含空格的标题放在最后
+const paneFormat = "#{pane_id} #{session_name} #{window_active}#{pane_active} #{pane_width} #{pane_height} " +
+	"#{cursor_x} #{cursor_y} #{cursor_flag} #{alternate_on} #{insert_flag} #{keypad_cursor_flag} " +
+	"#{wrap_flag} #{origin_flag} #{scroll_region_upper} #{scroll_region_lower} #{alternate_saved_x} #{alternate_saved_y} #{history_size} #{pane_title}"
+
+// PaneState pane 的尺寸、光标和终端模式
+type PaneState struct {
+	ID              string // tmux pane ID，如 %3
+	Session         string
+	Active          bool // 是否为会话当前窗口的活动 pane
+	Width           int
+	Height          int
+	CursorX         int
+	CursorY         int
+	CursorVisible   bool
+	AlternateScreen bool
+	InsertMode      bool
+	AppCursorKeys   bool
+	AutoWrap        bool
+	OriginMode      bool
+	ScrollTop       int
+	ScrollBottom    int
+	AltSavedX       int // 进入备用屏幕前保存的光标位置
+	AltSavedY       int
+	HistorySize     int
+	Title           string
+}
+
+// parsePaneState 解析 paneFormat 输出的一行
+func parsePaneState(line string) (PaneState, error) {
+	fields := strings.SplitN(line, " ", 19)
+	if len(fields) != 19 {
+		return PaneState{}, fmt.Errorf("unexpected pane state: %q", line)
+	}
+	ints := make([]int, 0, 9)
+	for _, i := range []int{3, 4, 5, 6, 13, 14, 15, 16, 17} {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return PaneState{}, fmt.Errorf("unexpected pane state: %q", line)
+		}
+		ints = append(ints, n)
+	}
+	return PaneState{
+		ID:              fields[0],
+		Session:         fields[1],
+		Active:          fields[2] == "11",
+		Width:           ints[0],
+		Height:          ints[1],
+		CursorX:         ints[2],
+		CursorY:         ints[3],
+		CursorVisible:   fields[7] == "1",
+		AlternateScreen: fields[8] == "1",
+		InsertMode:      fields[9] == "1",
+		AppCursorKeys:   fields[10] == "1",
+		AutoWrap:        fields[11] == "1",
+		OriginMode:      fields[12] == "1",
+		ScrollTop:       ints[4],
+		ScrollBottom:    ints[5],
+		AltSavedX:       ints[6],
+		AltSavedY:       ints[7],
+		HistorySize:     ints[8],
+		Title:           fields[18],
+	}, nil
+}
+
+// PaneState 返回 pane 的状态，target 为 pane ID 或会话名（表示会话当前窗口的活动 pane）
+func (m *Manager) PaneState(target string) (PaneState, error) {
+	output, err := exec.Command("tmux", "display-message", "-p", "-t", target, paneFormat).Output()
+	if err != nil {
+		return PaneState{}, fmt.Errorf("failed to get pane state: %w", err)
+	}
+	return parsePaneState(strings.TrimRight(string(output), "\n"))
+}
+
+// ListPanes 返回所有会话的所有 pane 的状态
+func (m *Manager) ListPanes() ([]PaneState, error) {
+	output, err := exec.Command("tmux", "list-panes", "-a", "-F", paneFormat).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list panes: %w", err)
+	}
+	var panes []PaneState
+	for _, line := range splitLines(string(output)) {
+		// 跳过无法解析的行（如在外部创建、名称含空格的会话）
+		if pane, err := parsePaneState(line); err == nil {
+			panes = append(panes, pane)
+		}
+	}
+	return panes, nil
+}
+
+// CapturePaneHistory 返回 pane 最近 lines 行历史（不含可见区域），保留颜色等控制序列
+func (m *Manager) CapturePaneHistory(paneID string, lines int) ([]string, error) {
+	output, err := exec.Command("tmux", "capture-pane", "-p", "-e", "-t", paneID,
+		"-S", fmt.Sprintf("-%d", lines), "-E", "-1").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture history: %w", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
+
+// CapturePaneScreen 返回 pane 可见区域的每一行，保留颜色等控制序列。
+// saved 为 true 时返回 pane 处于备用屏幕时被保存的主屏幕
+func (m *Manager) CapturePaneScreen(paneID string, saved bool) ([]string, error) {
+	args := []string{"capture-pane", "-p", "-e", "-N", "-t", paneID}
+	if saved {
+		args = append(args, "-a")
+	}
+	output, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screen: %w", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
@@ -27,11 +27,34 @@ import (
 	"time"
 )
 
+// SessionInfo 会话的描述性信息（显示名称、描述、标签、置顶）
+type SessionInfo struct {
+	DisplayName string            `json:"display_name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Pinned      bool              `json:"pinned,omitempty"`
+}
+
+// clone 返回 SessionInfo 的深拷贝
+func (i SessionInfo) clone() SessionInfo {
+	if i.Labels != nil {
+		labels := make(map[string]string, len(i.Labels))
+		for k, v := range i.Labels {
+			labels[k] = v
+		}
+		i.Labels = labels
+	}
+	return i
+}
+
 // SessionMetadata 会话元数据，用于持久化存储
 type SessionMetadata struct {
-	Name      string    `json:"name"`
-	WorkDir   string    `json:"work_dir"`
-	CreatedAt time.Time `json:"created_at"`
+	Name           string    `json:"name"`
+	WorkDir        string    `json:"work_dir"`
+	CreatedAt      time.Time `json:"created_at"`
+	OwnerID        string    `json:"owner_id,omitempty"`
+	StartupCommand string    `json:"startup_command,omitempty"` // 会话创建和恢复后自动执行的命令
+	SessionInfo
 }
 
 // Persistence 会话持久化管理器
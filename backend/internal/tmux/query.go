@@ -0,0 +1,135 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"sort"
+	"strings"
+)
+
+// 支持的排序字段
+const (
+	SortByName        = "name"
+	SortByDisplayName = "display_name"
+	SortByCreatedAt   = "created_at"
+)
+
+// ListOptions 会话列表的过滤、搜索与排序选项
+type ListOptions struct {
+	OwnerID string            // 仅返回该用户拥有的会话，为空表示不限制
+	Labels  map[string]string // 需要全部匹配的标签，值为空表示只要求存在该键
+	Query   string            // 在名称、显示名称、描述和标签中进行不区分大小写的搜索
+	SortBy  string            // name、display_name 或 created_at，默认 name
+	Desc    bool              // 是否降序
+}
+
+// QuerySessions 按选项过滤并排序会话，置顶会话始终排在最前
+func (m *Manager) QuerySessions(opts ListOptions) []*Session {
+	all := m.ListSessions()
+
+	query := strings.ToLower(strings.TrimSpace(opts.Query))
+
+	type entry struct {
+		session *Session
+		info    SessionInfo
+	}
+	entries := make([]entry, 0, len(all))
+	for _, s := range all {
+		if opts.OwnerID != "" && s.OwnerID != opts.OwnerID {
+			continue
+		}
+		info := s.Info()
+		if !matchLabels(info.Labels, opts.Labels) {
+			continue
+		}
+		if query != "" && !matchQuery(s, info, query) {
+			continue
+		}
+		entries = append(entries, entry{session: s, info: info})
+	}
+
+	less := func(a, b entry) bool {
+		switch opts.SortBy {
+		case SortByDisplayName:
+			an, bn := strings.ToLower(displayNameOf(a.session, a.info)), strings.ToLower(displayNameOf(b.session, b.info))
+			if an != bn {
+				return an < bn
+			}
+		case SortByCreatedAt:
+			if !a.session.CreatedAt.Equal(b.session.CreatedAt) {
+				return a.session.CreatedAt.Before(b.session.CreatedAt)
+			}
+		}
+		return a.session.Name < b.session.Name
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.info.Pinned != b.info.Pinned {
+			return a.info.Pinned
+		}
+		if opts.Desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+
+	result := make([]*Session, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.session)
+	}
+	return result
+}
+
+// matchLabels 检查会话标签是否满足所有过滤条件
+func matchLabels(labels, filter map[string]string) bool {
+	for key, want := range filter {
+		got, ok := labels[key]
+		if !ok {
+			return false
+		}
+		if want != "" && got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// matchQuery 检查会话是否包含搜索文本（query 已转为小写）
+func matchQuery(s *Session, info SessionInfo, query string) bool {
+	fields := []string{s.Name, info.DisplayName, info.Description}
+	for key, value := range info.Labels {
+		fields = append(fields, key, value)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayNameOf 返回显示名称，未设置时回退到会话名称
+func displayNameOf(s *Session, info SessionInfo) string {
+	if info.DisplayName != "" {
+		return info.DisplayName
+	}
+	return s.Name
+}
@@ -0,0 +1,217 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"bytes"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+)
+
+// ReconcileResult 一次对账的结果
+type ReconcileResult struct {
+	ServerRestarted bool     `json:"server_restarted"`
+	Exited          []string `json:"exited"`     // tmux 中已不存在、已移除的会话
+	Discovered      []string `json:"discovered"` // tmux 中新出现、已纳入管理的会话
+	Restored        []string `json:"restored"`   // tmux 服务重启后恢复的会话
+}
+
+// listTmuxSessions 列出 tmux 中的会话，serverUp 为 false 表示 tmux 服务未运行
+func listTmuxSessions() (names map[string]bool, serverUp bool, err error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		msg := stderr.String()
+		if strings.Contains(msg, "no server running") || strings.Contains(msg, "error connecting to") {
+			return map[string]bool{}, false, nil
+		}
+		return nil, false, err
+	}
+
+	names = make(map[string]bool)
+	for _, name := range splitLines(string(output)) {
+		names[name] = true
+	}
+	return names, true, nil
+}
+
+// Reconcile 将 Manager 的状态与 tmux 服务的真实状态对齐：
+// 移除已退出的会话、纳入外部创建的会话；tmux 服务消失时重启并恢复持久化的会话
+func (m *Manager) Reconcile() ReconcileResult {
+	var result ReconcileResult
+
+	// 在锁内读取 tmux 状态，避免与 CreateSession/DeleteSession 交错导致误判
+	m.mu.Lock()
+	names, serverUp, err := listTmuxSessions()
+	if err != nil {
+		m.mu.Unlock()
+		log.Printf("[Tmux] Reconcile: failed to list sessions: %v", err)
+		return result
+	}
+
+	if !serverUp {
+		known := len(m.sessions)
+		m.mu.Unlock()
+		if known == 0 {
+			// 没有会话时 tmux 服务本来就不会运行
+			return result
+		}
+		return m.restartServer()
+	}
+
+	var exited []*Session
+	for name, session := range m.sessions {
+		if !names[name] {
+			exited = append(exited, session)
+			delete(m.sessions, name)
+		}
+	}
+	var discovered []*Session
+	for name := range names {
+		if _, exists := m.sessions[name]; !exists {
+			session := &Session{
+				ID:        generateSessionID(),
+				Name:      name,
+				CreatedAt: time.Now(),
+			}
+			m.sessions[name] = session
+			discovered = append(discovered, session)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, session := range exited {
+		log.Printf("[Tmux] Reconcile: session %s no longer exists in tmux, removing", session.Name)
+		if err := m.persistence.RemoveSession(session.Name); err != nil {
+			log.Printf("[Tmux] Failed to remove persisted session %s: %v", session.Name, err)
+		}
+		if err := m.persistence.RemoveSnapshot(session.Name); err != nil {
+			log.Printf("[Tmux] Failed to remove snapshot of session %s: %v", session.Name, err)
+		}
+		m.dropAlerts(session.Name)
+		m.emit(events.SessionExited, session, nil)
+		result.Exited = append(result.Exited, session.Name)
+	}
+
+	for _, session := range discovered {
+		log.Printf("[Tmux] Reconcile: discovered external tmux session %s", session.Name)
+		if err := m.persistence.AddSession(session.metadata()); err != nil {
+			log.Printf("[Tmux] Failed to persist session %s: %v", session.Name, err)
+		}
+		m.enableAlerts(session.Name)
+		m.emit(events.SessionCreated, session, map[string]interface{}{"external": true})
+		result.Discovered = append(result.Discovered, session.Name)
+	}
+
+	return result
+}
+
+// restartServer 在 tmux 服务消失后重新启动并恢复所有受管理的会话
+func (m *Manager) restartServer() ReconcileResult {
+	result := ReconcileResult{ServerRestarted: true}
+	log.Printf("[Tmux] Reconcile: tmux server is gone, restarting and restoring sessions")
+
+	persisted, err := m.persistence.LoadSessions()
+	if err != nil {
+		log.Printf("[Tmux] Failed to load persisted sessions: %v", err)
+	}
+	metaByName := make(map[string]SessionMetadata, len(persisted))
+	for _, meta := range persisted {
+		metaByName[meta.Name] = meta
+	}
+
+	// 保留现有的 Session 对象，只重建 tmux 端，已连接的处理器仍按名称访问会话
+	sessions := m.ListSessions()
+	var failed []*Session
+	for _, session := range sessions {
+		meta, ok := metaByName[session.Name]
+		if !ok {
+			meta = session.metadata()
+		}
+		if err := m.recreateSession(meta); err != nil {
+			log.Printf("[Tmux] Failed to restore session %s: %v", session.Name, err)
+			failed = append(failed, session)
+			continue
+		}
+		m.emit(events.SessionRestored, session, nil)
+		result.Restored = append(result.Restored, session.Name)
+	}
+
+	// 无法恢复的会话视为已退出
+	if len(failed) > 0 {
+		m.mu.Lock()
+		for _, session := range failed {
+			delete(m.sessions, session.Name)
+		}
+		m.mu.Unlock()
+		for _, session := range failed {
+			if err := m.persistence.RemoveSession(session.Name); err != nil {
+				log.Printf("[Tmux] Failed to remove persisted session %s: %v", session.Name, err)
+			}
+			m.dropAlerts(session.Name)
+			m.emit(events.SessionExited, session, nil)
+			result.Exited = append(result.Exited, session.Name)
+		}
+	}
+
+	// 事件面向所有用户，只带数量；各会话的名称由带所有者的 SessionRestored/SessionExited 事件单独通知
+	if bus := m.eventBus(); bus != nil {
+		bus.Publish(events.Event{
+			Type: events.ServerRestarted,
+			Data: map[string]int{
+				"restored": len(result.Restored),
+				"exited":   len(result.Exited),
+			},
+		})
+	}
+
+	log.Printf("[Tmux] Reconcile: tmux server restarted, %d session(s) restored, %d lost",
+		len(result.Restored), len(result.Exited))
+	return result
+}
+
+// StartReconciler 启动后台对账循环，interval <= 0 时不启动
+func (m *Manager) StartReconciler(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Reconcile()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	log.Printf("[Tmux] Session reconciler enabled (interval: %s)", interval)
+}
@@ -28,11 +28,14 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
 )
 
 var (
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSessionExists   = errors.New("session already exists")
+	ErrQuotaExceeded   = errors.New("session quota exceeded")
 )
 
 // Session 表示一个 tmux 会话
@@ -41,21 +44,69 @@ type Session struct {
 	Name      string
 	WorkDir   string
 	CreatedAt time.Time
+	OwnerID   string // 创建者用户 ID，为空表示无主会话（仅管理员可见）
+	info      SessionInfo
+	startup   string // 启动命令
 	mu        sync.RWMutex
 }
 
+// StartupCommand 返回会话的启动命令
+func (s *Session) StartupCommand() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.startup
+}
+
+// Info 返回会话描述信息的副本
+func (s *Session) Info() SessionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.info.clone()
+}
+
+// metadata 生成用于持久化的会话元数据
+func (s *Session) metadata() SessionMetadata {
+	return SessionMetadata{
+		Name:           s.Name,
+		WorkDir:        s.WorkDir,
+		CreatedAt:      s.CreatedAt,
+		OwnerID:        s.OwnerID,
+		StartupCommand: s.StartupCommand(),
+		SessionInfo:    s.Info(),
+	}
+}
+
 // Manager 管理所有 tmux 会话
 type Manager struct {
-	sessions    map[string]*Session
-	mu          sync.RWMutex
-	persistence *Persistence
+	sessions      map[string]*Session
+	mu            sync.RWMutex
+	persistence   *Persistence
+	events        *events.Bus
+	hooks         []SessionHook
+	hooksMu       sync.RWMutex        // 保护 events 和 hooks；emit 可能在持有 mu 时调用，不能使用 mu
+	maxPerOwner   int                 // 每个用户最多会话数，0 表示不限制
+	snapshotLines int                 // 快照保存的历史行数
+	alerts        map[string][]*Alert // 会话名 -> 未读提醒
+	alertOpts     AlertOptions
+	alertsMu      sync.Mutex
+	output        outputStreams // pane 增量输出流
+	done          chan struct{}
+	closeOnce     sync.Once
+	wg            sync.WaitGroup
 }
 
 // NewManager 创建新的会话管理器
 func NewManager(dataDir string) *Manager {
 	m := &Manager{
-		sessions:    make(map[string]*Session),
-		persistence: NewPersistence(dataDir),
+		sessions:      make(map[string]*Session),
+		persistence:   NewPersistence(dataDir),
+		snapshotLines: DefaultSnapshotScrollback,
+		alerts:        make(map[string][]*Alert),
+		output: outputStreams{
+			subscribers: make(map[int]*outputSubscriber),
+			pipes:       make(map[string]*panePipe),
+		},
+		done: make(chan struct{}),
 	}
 	// 启动时加载现有会话
 	m.loadExistingSessions()
@@ -66,6 +117,60 @@ func NewManager(dataDir string) *Manager {
 	return m
 }
 
+// SetEventBus 设置事件总线，会话生命周期变化将发布到该总线
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	m.events = bus
+}
+
+// eventBus 返回事件总线，未设置时为 nil
+func (m *Manager) eventBus() *events.Bus {
+	m.hooksMu.RLock()
+	defer m.hooksMu.RUnlock()
+	return m.events
+}
+
+// SessionHook 会话重命名、删除或退出时同步调用的钩子，oldName 只在重命名时有值。
+// 调用时可能持有 Manager 的锁，钩子中不能调用 Manager 的方法
+type SessionHook func(eventType events.Type, name, oldName string)
+
+// AddSessionHook 注册会话钩子。事件总线在订阅方处理缓慢时会丢弃事件，
+// 按会话名保存的数据（历史、任务、规则等）需要通过钩子清理，避免同名的新会话读到旧数据
+func (m *Manager) AddSessionHook(hook SessionHook) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// emit 先调用会话钩子再发布会话事件（调用方可以持有 m.mu）
+func (m *Manager) emit(eventType events.Type, session *Session, data interface{}) {
+	switch eventType {
+	case events.SessionRenamed, events.SessionDeleted, events.SessionExited:
+		oldName := ""
+		if names, ok := data.(map[string]string); ok {
+			oldName = names["old_name"]
+		}
+		m.hooksMu.RLock()
+		hooks := m.hooks
+		m.hooksMu.RUnlock()
+		for _, hook := range hooks {
+			hook(eventType, session.Name, oldName)
+		}
+	}
+
+	bus := m.eventBus()
+	if bus == nil {
+		return
+	}
+	bus.Publish(events.Event{
+		Type:    eventType,
+		Session: session.Name,
+		Owner:   session.OwnerID,
+		Data:    data,
+	})
+}
+
 // loadExistingSessions 加载已存在的 tmux 会话
 func (m *Manager) loadExistingSessions() {
 	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}")
@@ -121,11 +226,7 @@ func (m *Manager) syncExistingSessionsToPersistence() {
 			continue
 		}
 
-		validSessions = append(validSessions, SessionMetadata{
-			Name:      name,
-			WorkDir:   session.WorkDir,
-			CreatedAt: session.CreatedAt,
-		})
+		validSessions = append(validSessions, session.metadata())
 
 		if !persistedMap[name] {
 			// 该会话未被持久化，记录日志
@@ -158,34 +259,123 @@ func (m *Manager) restoreSessions() {
 			// 会话已存在，更新其 WorkDir 信息
 			session.WorkDir = meta.WorkDir
 			session.CreatedAt = meta.CreatedAt
+			session.OwnerID = meta.OwnerID
+			session.startup = meta.StartupCommand
+			session.info = meta.SessionInfo.clone()
 			log.Printf("[Tmux] Updated existing session %s with persisted metadata (work_dir: %s)", meta.Name, meta.WorkDir)
 			continue
 		}
 
-		// 尝试重新创建 tmux 会话
+		session, err := m.restoreSession(meta)
+		if err != nil {
+			log.Printf("[Tmux] Failed to restore session %s: %v", meta.Name, err)
+			continue
+		}
+		m.sessions[meta.Name] = session
+	}
+}
+
+// restoreSession 按持久化元数据重新创建 tmux 会话并返回对应的 Session
+func (m *Manager) restoreSession(meta SessionMetadata) (*Session, error) {
+	if err := m.recreateSession(meta); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ID:        generateSessionID(),
+		Name:      meta.Name,
+		WorkDir:   meta.WorkDir,
+		CreatedAt: meta.CreatedAt,
+		OwnerID:   meta.OwnerID,
+		startup:   meta.StartupCommand,
+		info:      meta.SessionInfo.clone(),
+	}, nil
+}
+
+// recreateSession 重新创建 tmux 会话：优先按快照恢复布局和历史，否则创建空会话，
+// 最后执行配置的启动命令
+func (m *Manager) recreateSession(meta SessionMetadata) error {
+	restored := false
+	snap, err := m.persistence.LoadSnapshot(meta.Name)
+	if err != nil {
+		log.Printf("[Tmux] Failed to load snapshot of %s: %v", meta.Name, err)
+	}
+	if snap != nil {
+		if err := m.persistence.restoreSnapshot(snap, meta.WorkDir); err != nil {
+			log.Printf("[Tmux] Failed to restore snapshot of %s, falling back to empty session: %v", meta.Name, err)
+			exec.Command("tmux", "kill-session", "-t", meta.Name).Run()
+		} else {
+			restored = true
+			log.Printf("[Tmux] Restored session %s from snapshot taken at %s (%d window(s))",
+				meta.Name, snap.CapturedAt.Format(time.RFC3339), len(snap.Windows))
+		}
+	}
+
+	if !restored {
 		args := []string{"new-session", "-d", "-s", meta.Name}
 		if meta.WorkDir != "" {
 			args = append(args, "-c", meta.WorkDir)
 		}
+		if err := exec.Command("tmux", args...).Run(); err != nil {
+			return err
+		}
+		log.Printf("[Tmux] Restored session: %s (work_dir: %s)", meta.Name, meta.WorkDir)
+	}
 
-		cmd := exec.Command("tmux", args...)
-		if err := cmd.Run(); err != nil {
-			log.Printf("[Tmux] Failed to restore session %s: %v", meta.Name, err)
-			continue
+	m.enableAlerts(meta.Name)
+
+	if meta.StartupCommand != "" {
+		session := &Session{Name: meta.Name}
+		if err := session.SendCommand(meta.StartupCommand); err != nil {
+			log.Printf("[Tmux] Failed to run startup command for %s: %v", meta.Name, err)
 		}
+	}
 
-		log.Printf("[Tmux] Restored session: %s (work_dir: %s)", meta.Name, meta.WorkDir)
-		m.sessions[meta.Name] = &Session{
-			ID:        generateSessionID(),
-			Name:      meta.Name,
-			WorkDir:   meta.WorkDir,
-			CreatedAt: meta.CreatedAt,
+	return nil
+}
+
+// SetMaxSessionsPerUser 设置每个用户最多可拥有的会话数，0 表示不限制
+func (m *Manager) SetMaxSessionsPerUser(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxPerOwner = max
+}
+
+// MaxSessionsPerUser 返回每个用户的会话配额
+func (m *Manager) MaxSessionsPerUser() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maxPerOwner
+}
+
+// CountSessionsByOwner 统计指定用户拥有的会话数
+func (m *Manager) CountSessionsByOwner(ownerID string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.countByOwnerLocked(ownerID)
+}
+
+// countByOwnerLocked 统计指定用户拥有的会话数（调用方需持有锁）
+func (m *Manager) countByOwnerLocked(ownerID string) int {
+	count := 0
+	for _, s := range m.sessions {
+		if s.OwnerID == ownerID {
+			count++
 		}
 	}
+	return count
+}
+
+// CreateOptions 创建会话的选项
+type CreateOptions struct {
+	WorkDir        string
+	OwnerID        string // 创建者用户 ID
+	StartupCommand string // 创建及恢复后自动执行的命令
+	Info           SessionInfo
 }
 
 // CreateSession 创建新的 tmux 会话
-func (m *Manager) CreateSession(name, workDir string) (*Session, error) {
+func (m *Manager) CreateSession(name string, opts CreateOptions) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -193,10 +383,14 @@ func (m *Manager) CreateSession(name, workDir string) (*Session, error) {
 		return nil, ErrSessionExists
 	}
 
+	if m.maxPerOwner > 0 && m.countByOwnerLocked(opts.OwnerID) >= m.maxPerOwner {
+		return nil, ErrQuotaExceeded
+	}
+
 	// 使用 tmux 创建新会话
 	args := []string{"new-session", "-d", "-s", name}
-	if workDir != "" {
-		args = append(args, "-c", workDir)
+	if opts.WorkDir != "" {
+		args = append(args, "-c", opts.WorkDir)
 	}
 
 	cmd := exec.Command("tmux", args...)
@@ -207,21 +401,29 @@ func (m *Manager) CreateSession(name, workDir string) (*Session, error) {
 	session := &Session{
 		ID:        generateSessionID(),
 		Name:      name,
-		WorkDir:   workDir,
+		WorkDir:   opts.WorkDir,
 		CreatedAt: time.Now(),
+		OwnerID:   opts.OwnerID,
+		startup:   opts.StartupCommand,
+		info:      opts.Info.clone(),
 	}
 
 	m.sessions[name] = session
+	m.enableAlerts(name)
+
+	if opts.StartupCommand != "" {
+		if err := session.SendCommand(opts.StartupCommand); err != nil {
+			log.Printf("[Tmux] Failed to run startup command for %s: %v", name, err)
+		}
+	}
 
 	// 持久化会话元数据
-	if err := m.persistence.AddSession(SessionMetadata{
-		Name:      name,
-		WorkDir:   workDir,
-		CreatedAt: session.CreatedAt,
-	}); err != nil {
+	if err := m.persistence.AddSession(session.metadata()); err != nil {
 		log.Printf("[Tmux] Failed to persist session %s: %v", name, err)
 	}
 
+	m.emit(events.SessionCreated, session, nil)
+
 	return session, nil
 }
 
@@ -237,6 +439,16 @@ func (m *Manager) GetSession(name string) (*Session, error) {
 	return session, nil
 }
 
+// GetAccessibleSession 获取用户可访问的会话。不属于该用户的会话与不存在的会话一样
+// 返回 ErrSessionNotFound，避免泄露其他用户的会话名称
+func (m *Manager) GetAccessibleSession(name, userID string, isAdmin bool) (*Session, error) {
+	session, err := m.GetSession(name)
+	if err != nil || !session.AccessibleBy(userID, isAdmin) {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
 // ListSessions 列出所有会话
 func (m *Manager) ListSessions() []*Session {
 	m.mu.RLock()
@@ -249,12 +461,129 @@ func (m *Manager) ListSessions() []*Session {
 	return sessions
 }
 
+// SessionInfoUpdate 会话描述信息的部分更新，nil 字段保持不变
+type SessionInfoUpdate struct {
+	DisplayName    *string
+	Description    *string
+	Labels         map[string]*string // 值为 nil 表示删除该标签
+	Pinned         *bool
+	StartupCommand *string // 空字符串表示清除启动命令
+
+	// Validate 校验合并后的描述信息，返回错误时不做任何修改
+	Validate func(info SessionInfo) error
+}
+
+// UpdateSessionInfo 在会话锁内合并、校验并应用更新，然后持久化
+func (m *Manager) UpdateSessionInfo(name string, update SessionInfoUpdate) (*Session, error) {
+	session, err := m.GetSession(name)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	info := session.info.clone()
+	if update.DisplayName != nil {
+		info.DisplayName = *update.DisplayName
+	}
+	if update.Description != nil {
+		info.Description = *update.Description
+	}
+	if update.Pinned != nil {
+		info.Pinned = *update.Pinned
+	}
+	for key, value := range update.Labels {
+		if value == nil {
+			delete(info.Labels, key)
+			continue
+		}
+		if info.Labels == nil {
+			info.Labels = make(map[string]string)
+		}
+		info.Labels[key] = *value
+	}
+	if len(info.Labels) == 0 {
+		info.Labels = nil
+	}
+	if update.Validate != nil {
+		if err := update.Validate(info); err != nil {
+			session.mu.Unlock()
+			return nil, err
+		}
+	}
+	session.info = info
+	if update.StartupCommand != nil {
+		session.startup = *update.StartupCommand
+	}
+	session.mu.Unlock()
+
+	if err := m.persistence.AddSession(session.metadata()); err != nil {
+		log.Printf("[Tmux] Failed to persist session %s: %v", name, err)
+	}
+
+	return session, nil
+}
+
+// RenameSession 重命名会话。重命名后返回新的 Session 对象，持有旧对象的调用方
+// 应重新获取会话
+func (m *Manager) RenameSession(oldName, newName string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, exists := m.sessions[oldName]
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	if oldName == newName {
+		return old, nil
+	}
+	if _, exists := m.sessions[newName]; exists {
+		return nil, ErrSessionExists
+	}
+
+	// 精确匹配会话名称，避免 tmux 的前缀匹配
+	cmd := exec.Command("tmux", "rename-session", "-t", "="+oldName, newName)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to rename session: %w", err)
+	}
+
+	old.mu.RLock()
+	session := &Session{
+		ID:        old.ID,
+		Name:      newName,
+		WorkDir:   old.WorkDir,
+		CreatedAt: old.CreatedAt,
+		OwnerID:   old.OwnerID,
+		info:      old.info.clone(),
+		startup:   old.startup,
+	}
+	old.mu.RUnlock()
+
+	delete(m.sessions, oldName)
+	m.sessions[newName] = session
+
+	if err := m.persistence.RemoveSession(oldName); err != nil {
+		log.Printf("[Tmux] Failed to remove persisted session %s: %v", oldName, err)
+	}
+	if err := m.persistence.AddSession(session.metadata()); err != nil {
+		log.Printf("[Tmux] Failed to persist session %s: %v", newName, err)
+	}
+	if err := m.persistence.RenameSnapshot(oldName, newName); err != nil {
+		log.Printf("[Tmux] Failed to rename snapshot of session %s: %v", oldName, err)
+	}
+	m.renameAlerts(oldName, newName)
+
+	m.emit(events.SessionRenamed, session, map[string]string{"old_name": oldName})
+
+	return session, nil
+}
+
 // DeleteSession 删除指定会话
 func (m *Manager) DeleteSession(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.sessions[name]; !exists {
+	session, exists := m.sessions[name]
+	if !exists {
 		return ErrSessionNotFound
 	}
 
@@ -269,6 +598,12 @@ func (m *Manager) DeleteSession(name string) error {
 	if err := m.persistence.RemoveSession(name); err != nil {
 		log.Printf("[Tmux] Failed to remove persisted session %s: %v", name, err)
 	}
+	if err := m.persistence.RemoveSnapshot(name); err != nil {
+		log.Printf("[Tmux] Failed to remove snapshot of session %s: %v", name, err)
+	}
+	m.dropAlerts(name)
+
+	m.emit(events.SessionDeleted, session, nil)
 
 	return nil
 }
@@ -288,6 +623,49 @@ func (s *Session) CaptureOutput() (string, error) {
 	return string(output), nil
 }
 
+// CaptureScreen 捕获当前 pane 可见区域的纯文本（不含控制序列和历史）
+func (s *Session) CaptureScreen() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cmd := exec.Command("tmux", "capture-pane", "-t", s.Name, "-p")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture screen: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// TailLines 返回最近 lineCount 行输出的纯文本（含可见区域，去除末尾空行）
+func (s *Session) TailLines(lineCount int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cmd := exec.Command("tmux", "capture-pane", "-t", s.Name, "-p", "-J", "-S", fmt.Sprintf("-%d", lineCount))
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture output: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(output), " \n"), "\n")
+	if len(lines) > lineCount {
+		lines = lines[len(lines)-lineCount:]
+	}
+	return lines, nil
+}
+
+// CurrentCommand 返回当前 pane 正在运行的程序名
+func (s *Session) CurrentCommand() (string, error) {
+	cmd := exec.Command("tmux", "display-message", "-p", "-t", s.Name, "#{pane_current_command}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
 // SendKeys 发送按键到会话
 func (s *Session) SendKeys(keys string) error {
 	s.mu.Lock()
@@ -385,6 +763,11 @@ func (s *Session) SendCommand(cmd string) error {
 	return nil
 }
 
+// AccessibleBy 判断用户是否可以访问该会话（管理员可访问所有会话）
+func (s *Session) AccessibleBy(userID string, isAdmin bool) bool {
+	return isAdmin || (s.OwnerID != "" && s.OwnerID == userID)
+}
+
 // IsActive 检查会话是否仍然活跃
 func (s *Session) IsActive() bool {
 	cmd := exec.Command("tmux", "has-session", "-t", s.Name)
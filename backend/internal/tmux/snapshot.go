@@ -0,0 +1,392 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package tmux
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSnapshotScrollback 快照默认保存的历史行数
+const DefaultSnapshotScrollback = 1000
+
+// PaneSnapshot pane 快照
+type PaneSnapshot struct {
+	Index          int    `json:"index"`
+	CurrentPath    string `json:"current_path"`
+	CurrentCommand string `json:"current_command"`
+	Active         bool   `json:"active"`
+	ScrollbackFile string `json:"scrollback_file"` // 相对于快照目录的文件名
+}
+
+// WindowSnapshot 窗口快照
+type WindowSnapshot struct {
+	Index  int            `json:"index"`
+	Name   string         `json:"name"`
+	Layout string         `json:"layout"`
+	Active bool           `json:"active"`
+	Panes  []PaneSnapshot `json:"panes"`
+}
+
+// Snapshot 会话快照：窗口/pane 布局、每个 pane 的当前目录和历史输出
+type Snapshot struct {
+	Session    string           `json:"session"`
+	CapturedAt time.Time        `json:"captured_at"`
+	Windows    []WindowSnapshot `json:"windows"`
+}
+
+// SnapshotSession 立即为指定会话生成快照
+func (m *Manager) SnapshotSession(name string) (*Snapshot, error) {
+	if _, err := m.GetSession(name); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	lines := m.snapshotLines
+	m.mu.RUnlock()
+
+	return m.persistence.captureSnapshot(name, lines)
+}
+
+// SnapshotAll 为所有受管理的会话生成快照，返回成功的数量
+func (m *Manager) SnapshotAll() int {
+	count := 0
+	for _, session := range m.ListSessions() {
+		if !session.IsActive() {
+			continue
+		}
+		if _, err := m.SnapshotSession(session.Name); err != nil {
+			log.Printf("[Tmux] Failed to snapshot session %s: %v", session.Name, err)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// GetSnapshot 读取会话最近一次的快照，不存在时返回 nil
+func (m *Manager) GetSnapshot(name string) (*Snapshot, error) {
+	if _, err := m.GetSession(name); err != nil {
+		return nil, err
+	}
+	return m.persistence.LoadSnapshot(name)
+}
+
+// StartSnapshotter 启动定期快照，interval <= 0 时只设置历史行数不启动定时任务
+func (m *Manager) StartSnapshotter(interval time.Duration, scrollbackLines int) {
+	if scrollbackLines > 0 {
+		m.mu.Lock()
+		m.snapshotLines = scrollbackLines
+		m.mu.Unlock()
+	}
+	if interval <= 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if count := m.SnapshotAll(); count > 0 {
+					log.Printf("[Tmux] Saved snapshots of %d session(s)", count)
+				}
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	log.Printf("[Tmux] Periodic snapshots enabled (interval: %s)", interval)
+}
+
+// Close 停止后台任务
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+	m.wg.Wait()
+}
+
+// snapshotDir 返回会话快照目录
+func (p *Persistence) snapshotDir(name string) string {
+	return filepath.Join(p.dataDir, "snapshots", name)
+}
+
+// LoadSnapshot 读取会话快照，不存在时返回 nil
+func (p *Persistence) LoadSnapshot(name string) (*Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(p.snapshotDir(name), "snapshot.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// RenameSnapshot 会话重命名时移动快照目录
+func (p *Persistence) RenameSnapshot(oldName, newName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snap, err := p.LoadSnapshot(oldName)
+	if err != nil || snap == nil {
+		return err
+	}
+	snap.Session = newName
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(p.snapshotDir(oldName), "snapshot.json"), data, 0600); err != nil {
+		return err
+	}
+
+	os.RemoveAll(p.snapshotDir(newName))
+	return os.Rename(p.snapshotDir(oldName), p.snapshotDir(newName))
+}
+
+// RemoveSnapshot 删除会话快照
+func (p *Persistence) RemoveSnapshot(name string) error {
+	return os.RemoveAll(p.snapshotDir(name))
+}
+
+// captureSnapshot 从 tmux 读取会话布局并把每个 pane 的历史写入快照目录
+func (p *Persistence) captureSnapshot(name string, scrollback int) (*Snapshot, error) {
+	// tmux 会把格式输出中的制表符替换为下划线，字段以空格分隔，可能含空格的字段放在最后
+	windowsOut, err := exec.Command("tmux", "list-windows", "-t", name, "-F",
+		"#{window_index} #{window_active} #{window_layout} #{window_name}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list windows: %w", err)
+	}
+	panesOut, err := exec.Command("tmux", "list-panes", "-s", "-t", name, "-F",
+		"#{window_index} #{pane_index} #{pane_active} #{pane_current_command} #{pane_current_path}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list panes: %w", err)
+	}
+
+	snap := &Snapshot{Session: name, CapturedAt: time.Now()}
+	windowPos := make(map[int]int)
+	for _, line := range splitLines(string(windowsOut)) {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		index, _ := strconv.Atoi(fields[0])
+		windowPos[index] = len(snap.Windows)
+		snap.Windows = append(snap.Windows, WindowSnapshot{
+			Index:  index,
+			Active: fields[1] == "1",
+			Layout: fields[2],
+			Name:   fields[3],
+		})
+	}
+
+	// 先写入临时目录，完成后再替换旧快照，避免中途失败留下不完整的快照
+	dir := p.snapshotDir(name)
+	tmpDir := dir + ".tmp"
+	os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, line := range splitLines(string(panesOut)) {
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		windowIndex, _ := strconv.Atoi(fields[0])
+		paneIndex, _ := strconv.Atoi(fields[1])
+		pos, ok := windowPos[windowIndex]
+		if !ok {
+			continue
+		}
+
+		pane := PaneSnapshot{
+			Index:          paneIndex,
+			Active:         fields[2] == "1",
+			CurrentCommand: fields[3],
+			CurrentPath:    fields[4],
+		}
+
+		target := fmt.Sprintf("%s:%d.%d", name, windowIndex, paneIndex)
+		output, err := exec.Command("tmux", "capture-pane", "-t", target, "-p", "-e", "-S", fmt.Sprintf("-%d", scrollback)).Output()
+		if err == nil {
+			pane.ScrollbackFile = fmt.Sprintf("pane-%d-%d.txt", windowIndex, paneIndex)
+			content := strings.TrimRight(string(output), "\n")
+			if err := os.WriteFile(filepath.Join(tmpDir, pane.ScrollbackFile), []byte(content+"\n"), 0600); err != nil {
+				return nil, err
+			}
+		}
+
+		snap.Windows[pos].Panes = append(snap.Windows[pos].Panes, pane)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "snapshot.json"), data, 0600); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// restoreSnapshot 按快照重建 tmux 会话：窗口、pane、当前目录、布局和历史输出。
+// 新窗口的序号取决于 base-index 等选项，不一定与快照一致，因此按创建时返回的窗口和 pane ID 定位
+func (p *Persistence) restoreSnapshot(snap *Snapshot, fallbackDir string) error {
+	hasPanes := false
+	for _, window := range snap.Windows {
+		if len(window.Panes) > 0 {
+			hasPanes = true
+			break
+		}
+	}
+	if !hasPanes {
+		return fmt.Errorf("snapshot of %s has no panes", snap.Session)
+	}
+
+	dir := p.snapshotDir(snap.Session)
+	name := snap.Session
+	created := false
+	activeWindow := ""
+
+	for _, window := range snap.Windows {
+		if len(window.Panes) == 0 {
+			continue
+		}
+		windowID := ""
+		activePane := ""
+
+		for _, pane := range window.Panes {
+			workDir := pane.CurrentPath
+			if _, err := os.Stat(workDir); err != nil {
+				workDir = fallbackDir
+			}
+
+			var args []string
+			switch {
+			case !created:
+				args = []string{"new-session", "-d", "-P", "-F", "#{window_id} #{pane_id}", "-s", name, "-n", window.Name}
+			case windowID == "":
+				// 目标以冒号结尾，表示在会话中下一个空闲序号处创建窗口
+				args = []string{"new-window", "-d", "-P", "-F", "#{window_id} #{pane_id}", "-t", name + ":", "-n", window.Name}
+			default:
+				args = []string{"split-window", "-d", "-P", "-F", "#{window_id} #{pane_id}", "-t", windowID}
+			}
+			if workDir != "" {
+				args = append(args, "-c", workDir)
+			}
+			if pane.ScrollbackFile != "" {
+				// 先输出保存的历史，再启动用户的 shell
+				file := filepath.Join(dir, filepath.Base(pane.ScrollbackFile))
+				args = append(args, fmt.Sprintf("cat %s 2>/dev/null; exec \"${SHELL:-/bin/sh}\" -l", shellQuote(file)))
+			}
+
+			output, err := exec.Command("tmux", args...).Output()
+			if err != nil {
+				if !created {
+					return fmt.Errorf("failed to create session: %w", err)
+				}
+				if windowID == "" {
+					// 窗口创建失败时跳过其余 pane，避免拆分到其他窗口
+					break
+				}
+				continue
+			}
+			ids := strings.Fields(string(output))
+			if len(ids) != 2 {
+				return fmt.Errorf("unexpected tmux output: %q", output)
+			}
+			created = true
+
+			// split-window 可能因尺寸不足失败，布局在全部 pane 创建后统一应用
+			if windowID != "" {
+				exec.Command("tmux", "select-layout", "-t", windowID, "tiled").Run()
+			}
+			windowID = ids[0]
+			if pane.Active {
+				activePane = ids[1]
+			}
+		}
+
+		if windowID == "" {
+			continue
+		}
+		if window.Layout != "" {
+			exec.Command("tmux", "select-layout", "-t", windowID, window.Layout).Run()
+		}
+		if activePane != "" {
+			exec.Command("tmux", "select-pane", "-t", activePane).Run()
+		}
+		if window.Active {
+			activeWindow = windowID
+		}
+	}
+
+	if activeWindow != "" {
+		exec.Command("tmux", "select-window", "-t", activeWindow).Run()
+	}
+
+	return nil
+}
+
+// splitLines 按行拆分并去掉空行
+func splitLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// shellQuote 使用单引号转义 shell 参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
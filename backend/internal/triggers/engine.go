@@ -0,0 +1,387 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package triggers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+	"github.com/xiaoliu10/remote-code/internal/tmux"
+	"github.com/xiaoliu10/remote-code/internal/users"
+)
+
+const (
+	// maxLineLength 未换行的输出最多保留的字节数，避免长时间无换行的输出占用内存
+	maxLineLength = 4096
+	// rateWindow 频率限制的统计窗口
+	rateWindow = time.Minute
+	// webhookTimeout 调用 webhook 的超时时间
+	webhookTimeout = 10 * time.Second
+)
+
+// ansiPattern 匹配终端控制序列（CSI、OSC、DCS 等）
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[PX^_][^\x1b]*\x1b\\|\x1b[()][0-9A-Za-z]|\x1b[@-Z\\-_=>]`)
+
+// Firing 一次规则触发
+type Firing struct {
+	RuleID   string     `json:"rule_id"`
+	RuleName string     `json:"rule_name"`
+	Action   ActionType `json:"action"`
+	Session  string     `json:"session"`
+	Line     string     `json:"line"`              // 匹配的输出行（已去除控制序列）
+	Message  string     `json:"message,omitempty"` // notify 动作的通知内容
+	Time     time.Time  `json:"time"`
+}
+
+// Status 规则的运行状态（不持久化）
+type Status struct {
+	FireCount       int        `json:"fire_count"`
+	SuppressedCount int        `json:"suppressed_count"` // 因防抖或频率限制被忽略的匹配次数
+	LastFiredAt     *time.Time `json:"last_fired_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// ruleState 规则的防抖与频率限制状态
+type ruleState struct {
+	Status
+	recent []time.Time // 统计窗口内的触发时间
+}
+
+// paneBuffer 单个 pane 的行缓冲
+type paneBuffer struct {
+	partial   []byte // 尚未换行的输出
+	evaluated string // 已匹配过的未换行内容，换行后不再重复匹配
+}
+
+// Engine 规则引擎：增量读取会话输出，逐行匹配规则并执行动作
+type Engine struct {
+	store   *Store
+	manager *tmux.Manager
+	bus     *events.Bus
+	users   *users.Store
+	client  *http.Client
+
+	mu        sync.Mutex
+	states    map[string]*ruleState  // 规则 ID -> 状态
+	panes     map[string]*paneBuffer // pane ID -> 行缓冲
+	cancelOut func()
+}
+
+// NewEngine 创建规则引擎
+func NewEngine(store *Store, manager *tmux.Manager, bus *events.Bus, userStore *users.Store) *Engine {
+	return &Engine{
+		store:   store,
+		manager: manager,
+		bus:     bus,
+		users:   userStore,
+		client:  &http.Client{Timeout: webhookTimeout},
+		states:  make(map[string]*ruleState),
+		panes:   make(map[string]*paneBuffer),
+	}
+}
+
+// Store 返回规则存储
+func (e *Engine) Store() *Store {
+	return e.store
+}
+
+// Start 启动引擎，并跟随会话的重命名、删除和退出维护绑定的规则
+func (e *Engine) Start() {
+	e.Refresh()
+	e.manager.AddSessionHook(e.sessionChanged)
+}
+
+// sessionChanged 会话钩子：跟随会话的重命名、删除和退出维护绑定的规则
+func (e *Engine) sessionChanged(eventType events.Type, name, oldName string) {
+	var err error
+	switch eventType {
+	case events.SessionRenamed:
+		err = e.store.RenameSession(oldName, name)
+	case events.SessionDeleted, events.SessionExited:
+		err = e.store.RemoveSession(name)
+	}
+	if err != nil {
+		log.Printf("[Triggers] Failed to update rules of session %s: %v", name, err)
+	}
+	// Refresh 会订阅会话输出，钩子可能在 Manager 持有锁时调用，放到协程中执行
+	go e.Refresh()
+}
+
+// Stop 停止引擎
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cancelOut != nil {
+		e.cancelOut()
+		e.cancelOut = nil
+	}
+}
+
+// Refresh 在规则变化后调用：存在启用的规则时订阅会话输出，否则取消订阅
+func (e *Engine) Refresh() {
+	enabled := e.store.hasEnabled()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case enabled && e.cancelOut == nil:
+		ch, cancel := e.manager.SubscribeOutput("", 256)
+		e.cancelOut = cancel
+		go func() {
+			for chunk := range ch {
+				e.handleChunk(chunk)
+			}
+		}()
+		log.Printf("[Triggers] Watching session output")
+	case !enabled && e.cancelOut != nil:
+		e.cancelOut()
+		e.cancelOut = nil
+		e.panes = make(map[string]*paneBuffer)
+		log.Printf("[Triggers] No enabled rules, stopped watching session output")
+	}
+
+	// 清理已删除规则的状态
+	for id := range e.states {
+		if _, err := e.store.Get(id); err != nil {
+			delete(e.states, id)
+		}
+	}
+}
+
+// Status 返回规则的运行状态
+func (e *Engine) Status(id string) Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if state, ok := e.states[id]; ok {
+		return state.Status
+	}
+	return Status{}
+}
+
+// cleanLine 去除控制序列，并按回车符只保留最后一次覆盖写入的内容
+func cleanLine(raw []byte) string {
+	line := ansiPattern.ReplaceAllString(string(raw), "")
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// handleChunk 把输出片段拆分成行并逐行匹配
+func (e *Engine) handleChunk(chunk tmux.OutputChunk) {
+	e.mu.Lock()
+	buf, ok := e.panes[chunk.Pane]
+	if !ok {
+		buf = &paneBuffer{}
+		e.panes[chunk.Pane] = buf
+	}
+
+	data := append(buf.partial, chunk.Data...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := cleanLine(data[:i])
+		data = data[i+1:]
+		if buf.evaluated != "" && line == buf.evaluated {
+			buf.evaluated = ""
+			continue
+		}
+		buf.evaluated = ""
+		lines = append(lines, line)
+	}
+	if len(data) > maxLineLength {
+		data = data[len(data)-maxLineLength:]
+	}
+	buf.partial = bytes.Clone(data)
+
+	// 未换行的内容（如等待确认的提示符）也参与匹配
+	if tail := cleanLine(data); strings.TrimSpace(tail) != "" && tail != buf.evaluated {
+		buf.evaluated = tail
+		lines = append(lines, tail)
+	}
+	e.mu.Unlock()
+
+	for _, line := range lines {
+		e.evaluate(chunk.Session, line)
+	}
+}
+
+// evaluate 用对会话生效的规则匹配一行输出
+func (e *Engine) evaluate(session, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	for _, rule := range e.store.matching(session) {
+		if !rule.re.MatchString(line) {
+			continue
+		}
+		if !e.allow(rule) {
+			continue
+		}
+		go e.execute(*rule, session, line)
+	}
+}
+
+// allow 检查防抖和频率限制，允许触发时记录本次触发
+func (e *Engine) allow(rule *Rule) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.states[rule.ID]
+	if !ok {
+		state = &ruleState{}
+		e.states[rule.ID] = state
+	}
+
+	now := time.Now()
+	if rule.DebounceSeconds > 0 && state.LastFiredAt != nil &&
+		now.Sub(*state.LastFiredAt) < time.Duration(rule.DebounceSeconds)*time.Second {
+		state.SuppressedCount++
+		return false
+	}
+
+	recent := state.recent[:0]
+	for _, t := range state.recent {
+		if now.Sub(t) < rateWindow {
+			recent = append(recent, t)
+		}
+	}
+	state.recent = recent
+	if rule.RateLimit > 0 && len(state.recent) >= rule.RateLimit {
+		state.SuppressedCount++
+		return false
+	}
+
+	state.recent = append(state.recent, now)
+	state.FireCount++
+	state.LastFiredAt = &now
+	return true
+}
+
+// execute 执行规则的动作并发布触发事件
+func (e *Engine) execute(rule Rule, sessionName, line string) {
+	session, err := e.manager.GetSession(sessionName)
+	if err != nil {
+		return
+	}
+	// 规则所有者在执行时检查：账号被停用、删除，或失去会话的访问权限后规则不再生效
+	owner, err := e.users.Get(rule.OwnerID)
+	if err != nil || !owner.Enabled || !session.AccessibleBy(owner.ID, owner.IsAdmin()) {
+		return
+	}
+
+	firing := Firing{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		Action:   rule.Action.Type,
+		Session:  sessionName,
+		Line:     line,
+		Time:     time.Now(),
+	}
+
+	switch rule.Action.Type {
+	case ActionNotify:
+		firing.Message = rule.Action.Message
+		if firing.Message == "" {
+			firing.Message = line
+		}
+	case ActionSendKeys:
+		if rule.Action.Enter {
+			err = session.SendCommand(rule.Action.Keys)
+		} else {
+			err = session.SendKeys(rule.Action.Keys)
+		}
+	case ActionWebhook:
+		err = e.postWebhook(rule.Action.URL, firing)
+	case ActionTag:
+		value := rule.Action.LabelValue
+		_, err = e.manager.UpdateSessionInfo(sessionName, tmux.SessionInfoUpdate{
+			Labels: map[string]*string{rule.Action.LabelKey: &value},
+		})
+	}
+
+	e.mu.Lock()
+	if state, ok := e.states[rule.ID]; ok {
+		state.LastError = ""
+		if err != nil {
+			state.LastError = err.Error()
+		}
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		log.Printf("[Triggers] Rule %s (%s) failed on session %s: %v", rule.ID, rule.Action.Type, sessionName, err)
+		return
+	}
+	log.Printf("[Triggers] Rule %s (%s) fired on session %s", rule.ID, rule.Action.Type, sessionName)
+
+	e.bus.Publish(events.Event{
+		Type:    events.TriggerFired,
+		Session: sessionName,
+		Owner:   session.OwnerID,
+		Data:    firing,
+	})
+}
+
+// postWebhook 以 JSON 形式把触发信息 POST 到回调地址
+func (e *Engine) postWebhook(url string, firing Firing) error {
+	body, err := json.Marshal(firing)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "remote-code-triggers")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package triggers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ActionType 规则匹配后执行的动作类型
+type ActionType string
+
+const (
+	ActionNotify   ActionType = "notify"    // 推送通知给会话所有者
+	ActionSendKeys ActionType = "send_keys" // 向会话发送按键
+	ActionWebhook  ActionType = "webhook"   // 调用 HTTP 回调
+	ActionTag      ActionType = "tag"       // 给会话打标签
+)
+
+// 规则字段限制
+const (
+	MaxNameLength    = 64
+	MaxPatternLength = 512
+	MaxKeysLength    = 1024
+	MaxMessageLength = 1024
+)
+
+// 触发频率限制：未指定时使用默认值，send_keys 和 webhook 动作不允许关闭限制
+const (
+	DefaultDebounceSeconds = 5
+	DefaultRateLimit       = 10
+)
+
+var (
+	ErrRuleNotFound = errors.New("trigger rule not found")
+)
+
+// Action 规则匹配后执行的动作，按 Type 使用对应字段
+type Action struct {
+	Type       ActionType `json:"type"`
+	Message    string     `json:"message,omitempty"`     // notify：通知内容，为空时使用匹配的行
+	Keys       string     `json:"keys,omitempty"`        // send_keys：发送的按键
+	Enter      bool       `json:"enter,omitempty"`       // send_keys：发送后回车
+	URL        string     `json:"url,omitempty"`         // webhook：回调地址
+	LabelKey   string     `json:"label_key,omitempty"`   // tag：标签键
+	LabelValue string     `json:"label_value,omitempty"` // tag：标签值
+}
+
+// Rule 输出匹配规则：会话新输出的某一行匹配正则时执行动作
+type Rule struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Session         string    `json:"session,omitempty"` // 为空表示全局规则，作用于所有会话
+	Pattern         string    `json:"pattern"`
+	Action          Action    `json:"action"`
+	DebounceSeconds int       `json:"debounce_seconds"` // 两次触发的最小间隔，0 表示不限制（send_keys、webhook 不允许）
+	RateLimit       int       `json:"rate_limit"`       // 每分钟最多触发次数，0 表示不限制（send_keys、webhook 不允许）
+	Enabled         bool      `json:"enabled"`
+	OwnerID         string    `json:"owner_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	re *regexp.Regexp
+}
+
+// Validate 校验规则并编译正则
+func (r *Rule) Validate() error {
+	if r.Name == "" || len(r.Name) > MaxNameLength {
+		return fmt.Errorf("name must be 1-%d characters", MaxNameLength)
+	}
+	if r.Pattern == "" || len(r.Pattern) > MaxPatternLength {
+		return fmt.Errorf("pattern must be 1-%d characters", MaxPatternLength)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	if r.DebounceSeconds < 0 || r.RateLimit < 0 {
+		return errors.New("debounce_seconds and rate_limit must not be negative")
+	}
+	// 会向会话输入或访问外部地址的动作必须限频，避免输出与动作互相触发形成循环
+	if r.Action.Type == ActionSendKeys || r.Action.Type == ActionWebhook {
+		if r.DebounceSeconds < 1 || r.RateLimit < 1 {
+			return fmt.Errorf("%s action requires debounce_seconds >= 1 and rate_limit >= 1", r.Action.Type)
+		}
+	}
+
+	switch r.Action.Type {
+	case ActionNotify:
+		if len(r.Action.Message) > MaxMessageLength {
+			return fmt.Errorf("message must be at most %d characters", MaxMessageLength)
+		}
+	case ActionSendKeys:
+		if r.Action.Keys == "" || len(r.Action.Keys) > MaxKeysLength {
+			return fmt.Errorf("keys must be 1-%d characters", MaxKeysLength)
+		}
+	case ActionWebhook:
+		u, err := url.Parse(r.Action.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook url must be an absolute http or https URL")
+		}
+	case ActionTag:
+		if r.Action.LabelKey == "" {
+			return errors.New("label_key is required for tag action")
+		}
+	default:
+		return fmt.Errorf("unknown action type: %q", r.Action.Type)
+	}
+
+	r.re = re
+	return nil
+}
+
+// Store 规则存储，持久化到数据目录的 triggers.json
+type Store struct {
+	path  string
+	rules map[string]*Rule
+	mu    sync.RWMutex
+}
+
+// NewStore 创建规则存储并加载已保存的规则
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path:  filepath.Join(dataDir, "triggers.json"),
+		rules: make(map[string]*Rule),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		// 早期版本允许 send_keys 和 webhook 规则不限频，加载时补上默认限制
+		if rule.Action.Type == ActionSendKeys || rule.Action.Type == ActionWebhook {
+			if rule.DebounceSeconds == 0 {
+				rule.DebounceSeconds = DefaultDebounceSeconds
+			}
+			if rule.RateLimit == 0 {
+				rule.RateLimit = DefaultRateLimit
+			}
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid trigger rule %s: %w", rule.ID, err)
+		}
+		s.rules[rule.ID] = rule
+	}
+	return s, nil
+}
+
+// saveLocked 将所有规则写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	rules := s.listLocked()
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按创建时间返回所有规则（调用方需持有锁）
+func (s *Store) listLocked() []*Rule {
+	rules := make([]*Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules
+}
+
+// List 返回所有规则的副本
+func (s *Store) List() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(s.rules))
+	for _, rule := range s.listLocked() {
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// Get 获取指定规则
+func (s *Store) Get(id string) (Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	return *rule, nil
+}
+
+// Put 校验并保存规则，ID 为空时创建新规则
+func (s *Store) Put(rule Rule) (Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if rule.ID == "" {
+		rule.ID = fmt.Sprintf("trg_%d", now.UnixNano())
+		rule.CreatedAt = now
+	} else {
+		existing, ok := s.rules[rule.ID]
+		if !ok {
+			return Rule{}, ErrRuleNotFound
+		}
+		rule.CreatedAt = existing.CreatedAt
+		rule.OwnerID = existing.OwnerID
+	}
+	rule.UpdatedAt = now
+
+	s.rules[rule.ID] = &rule
+	if err := s.saveLocked(); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// Delete 删除规则
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(s.rules, id)
+	return s.saveLocked()
+}
+
+// RenameSession 会话重命名后更新绑定该会话的规则
+func (s *Store) RenameSession(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for id, rule := range s.rules {
+		if rule.Session == oldName {
+			// 复制后替换，引擎可能正在读取旧规则
+			updated := *rule
+			updated.Session = newName
+			s.rules[id] = &updated
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// RemoveSession 删除绑定到已不存在的会话的规则
+func (s *Store) RemoveSession(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for id, rule := range s.rules {
+		if rule.Session == name {
+			delete(s.rules, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// matching 返回对指定会话生效的已启用规则
+func (s *Store) matching(session string) []*Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rules []*Rule
+	for _, rule := range s.rules {
+		if rule.Enabled && (rule.Session == "" || rule.Session == session) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// hasEnabled 是否存在启用的规则
+func (s *Store) hasEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if rule.Enabled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,457 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xiaoliu10/remote-code/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户字段限制
+const (
+	MaxDisplayNameLength = 64
+	MinPasswordLength    = 8
+	MaxPasswordLength    = 72 // bcrypt 只使用前 72 字节
+)
+
+// BootstrapAdminID 首次启动时由 ADMIN_PASSWORD 创建的管理员 ID，与多用户之前的 JWT 用户 ID 一致，已有会话的所有者不变
+const BootstrapAdminID = "admin"
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLastAdmin          = errors.New("at least one enabled administrator is required")
+)
+
+// loginSaveDelay 登录时间延迟写入的间隔
+const loginSaveDelay = 30 * time.Second
+
+// usernameRegex 用户名只允许字母、数字、下划线、点和短横线
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// dummyHash 用户不存在时也做一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("remote-code"), bcrypt.DefaultCost)
+
+// User 用户账号
+type User struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	DisplayName  string     `json:"display_name"`
+	Role         string     `json:"role"`
+	PasswordHash string     `json:"password_hash,omitempty"` // bcrypt 哈希，不在 API 中返回
+	Enabled      bool       `json:"enabled"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	TokenVersion int        `json:"token_version,omitempty"` // 修改密码时递增，使之前签发的令牌失效
+}
+
+// IsAdmin 是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.Role == auth.RoleAdmin
+}
+
+// Validate 校验用户字段
+func (u *User) Validate() error {
+	if !usernameRegex.MatchString(u.Username) {
+		return errors.New("username must be 3-32 characters: letters, digits, _ . -")
+	}
+	if utf8.RuneCountInString(u.DisplayName) > MaxDisplayNameLength {
+		return fmt.Errorf("display name must be at most %d characters", MaxDisplayNameLength)
+	}
+	if u.Role != auth.RoleAdmin && u.Role != auth.RoleUser {
+		return fmt.Errorf("unknown role: %q", u.Role)
+	}
+	return nil
+}
+
+// ValidatePassword 校验密码长度
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return fmt.Errorf("password must be %d-%d bytes", MinPasswordLength, MaxPasswordLength)
+	}
+	return nil
+}
+
+// hashPassword 校验并计算密码的 bcrypt 哈希
+func hashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Store 用户存储，持久化到数据目录的 users.json
+type Store struct {
+	path      string
+	users     map[string]*User
+	saveTimer *time.Timer // 待写入的登录时间
+	mu        sync.RWMutex
+}
+
+// NewStore 创建用户存储并加载已保存的用户
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path:  filepath.Join(dataDir, "users.json"),
+		users: make(map[string]*User),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var users []*User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if err := user.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid user %s: %w", user.ID, err)
+		}
+		s.users[user.ID] = user
+	}
+	return s, nil
+}
+
+// Bootstrap 没有任何用户时，用 adminPassword 创建管理员账号 admin。之后修改 ADMIN_PASSWORD 不再生效
+func (s *Store) Bootstrap(adminPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.users) > 0 {
+		return nil
+	}
+
+	// 沿用旧版本的 ADMIN_PASSWORD，不套用新密码的长度要求
+	if adminPassword == "" {
+		return errors.New("ADMIN_PASSWORD is required to create the administrator account")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("ADMIN_PASSWORD: %w", err)
+	}
+	now := time.Now()
+	s.users[BootstrapAdminID] = &User{
+		ID:           BootstrapAdminID,
+		Username:     "admin",
+		DisplayName:  "Administrator",
+		Role:         auth.RoleAdmin,
+		PasswordHash: string(hash),
+		Enabled:      true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, BootstrapAdminID)
+		return err
+	}
+	log.Printf("[Users] Created administrator account \"admin\" from ADMIN_PASSWORD")
+	return nil
+}
+
+// saveLocked 将所有用户写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按用户名返回所有用户（调用方需持有锁）
+func (s *Store) listLocked() []*User {
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// findLocked 按用户名查找用户，不区分大小写（调用方需持有锁）
+func (s *Store) findLocked(username string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// adminsLocked 统计启用的管理员数量（调用方需持有锁）
+func (s *Store) adminsLocked() int {
+	count := 0
+	for _, user := range s.users {
+		if user.Enabled && user.IsAdmin() {
+			count++
+		}
+	}
+	return count
+}
+
+// List 返回所有用户的副本
+func (s *Store) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.listLocked() {
+		users = append(users, *user)
+	}
+	return users
+}
+
+// Get 获取指定用户
+func (s *Store) Get(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// Authenticate 校验用户名和密码，成功时记录登录时间。停用的账号无法登录
+//
+// bcrypt 比较不持有锁，避免大量登录请求阻塞其他请求的用户查询
+func (s *Store) Authenticate(username, password string) (User, error) {
+	s.mu.RLock()
+	var user User
+	found := s.findLocked(username)
+	if found != nil {
+		user = *found
+	}
+	s.mu.RUnlock()
+
+	if found == nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil || !user.Enabled {
+		return User{}, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 比较期间账号可能被停用或删除
+	current, ok := s.users[user.ID]
+	if !ok || !current.Enabled {
+		return User{}, ErrInvalidCredentials
+	}
+	now := time.Now()
+	current.LastLoginAt = &now
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(loginSaveDelay, s.saveLogins)
+	}
+	return *current, nil
+}
+
+// saveLogins 延迟写入登录时间，合并一段时间内的多次登录
+func (s *Store) saveLogins() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveTimer = nil
+	if err := s.saveLocked(); err != nil {
+		log.Printf("[Users] Failed to save login time: %v", err)
+	}
+}
+
+// Flush 立即写入尚未保存的登录时间，服务停止前调用
+func (s *Store) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer == nil || !s.saveTimer.Stop() {
+		return
+	}
+	s.saveTimer = nil
+	if err := s.saveLocked(); err != nil {
+		log.Printf("[Users] Failed to save login time: %v", err)
+	}
+}
+
+// Create 创建用户
+func (s *Store) Create(user User, password string) (User, error) {
+	if err := user.Validate(); err != nil {
+		return User{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findLocked(user.Username) != nil {
+		return User{}, ErrUsernameTaken
+	}
+
+	now := time.Now()
+	user.ID = fmt.Sprintf("usr_%d", now.UnixNano())
+	user.PasswordHash = hash
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.LastLoginAt = nil
+	s.users[user.ID] = &user
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, user.ID)
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Update 修改用户名、显示名称、角色和启用状态，password 不为空时同时修改密码
+func (s *Store) Update(id string, update User, password string) (User, error) {
+	if err := update.Validate(); err != nil {
+		return User{}, err
+	}
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return User{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if other := s.findLocked(update.Username); other != nil && other.ID != id {
+		return User{}, ErrUsernameTaken
+	}
+	// 停用或降级最后一个管理员会导致无人能管理账号
+	if user.Enabled && user.IsAdmin() && (!update.Enabled || !update.IsAdmin()) && s.adminsLocked() == 1 {
+		return User{}, ErrLastAdmin
+	}
+
+	previous := *user
+	user.Username = update.Username
+	user.DisplayName = update.DisplayName
+	user.Role = update.Role
+	user.Enabled = update.Enabled
+	if hash != "" {
+		user.PasswordHash = hash
+		user.TokenVersion++
+	}
+	user.UpdatedAt = time.Now()
+	if err := s.saveLocked(); err != nil {
+		*user = previous
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// ChangePassword 校验当前密码后修改密码，返回更新后的用户。
+// 与 Authenticate 一样在锁外执行 bcrypt，之前签发的令牌随之失效
+func (s *Store) ChangePassword(id, current, password string) (User, error) {
+	s.mu.RLock()
+	var oldHash string
+	found, ok := s.users[id]
+	if ok {
+		oldHash = found.PasswordHash
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(oldHash), []byte(current)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	// 校验期间密码已被修改，校验的当前密码已不再有效
+	if user.PasswordHash != oldHash {
+		return User{}, ErrInvalidCredentials
+	}
+
+	previous := *user
+	user.PasswordHash = hash
+	user.TokenVersion++
+	user.UpdatedAt = time.Now()
+	if err := s.saveLocked(); err != nil {
+		*user = previous
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// Delete 删除用户
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.Enabled && user.IsAdmin() && s.adminsLocked() == 1 {
+		return ErrLastAdmin
+	}
+	delete(s.users, id)
+	if err := s.saveLocked(); err != nil {
+		s.users[id] = user
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+)
+
+const (
+	// TestEvent 测试投递使用的事件类型
+	TestEvent events.Type = "webhook.test"
+
+	// 请求头
+	HeaderEvent     = "X-Remote-Code-Event"
+	HeaderDelivery  = "X-Remote-Code-Delivery"
+	HeaderTimestamp = "X-Remote-Code-Timestamp"
+	HeaderSignature = "X-Remote-Code-Signature"
+
+	// queueSize 待投递队列长度
+	queueSize = 256
+	// workers 并发投递的数量
+	workers = 4
+	// maxRetryDelay 重试间隔上限
+	maxRetryDelay = 10 * time.Minute
+	// maxResponseBody 记录的响应内容最大字节数
+	maxResponseBody = 512
+)
+
+// Options 投递参数
+type Options struct {
+	MaxAttempts int           // 最多尝试次数（含首次），用尽后写入死信日志
+	RetryBase   time.Duration // 首次重试间隔，之后每次翻倍
+	Timeout     time.Duration // 单次请求超时
+	HistorySize int           // 每个端点保留的投递记录数
+}
+
+// DeliveryStatus 投递状态
+type DeliveryStatus string
+
+const (
+	StatusPending   DeliveryStatus = "pending"
+	StatusRetrying  DeliveryStatus = "retrying"
+	StatusSucceeded DeliveryStatus = "succeeded"
+	StatusFailed    DeliveryStatus = "failed" // 重试次数用尽，已写入死信日志
+)
+
+// Payload POST 到端点的 JSON 内容
+type Payload struct {
+	ID      string      `json:"id"` // 投递 ID，重试时保持不变，可用于去重
+	Event   events.Type `json:"event"`
+	Seq     uint64      `json:"seq,omitempty"` // 事件序列号
+	Session string      `json:"session,omitempty"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Delivery 一次事件投递及其重试记录
+type Delivery struct {
+	ID            string         `json:"id"`
+	EndpointID    string         `json:"endpoint_id"`
+	Event         events.Type    `json:"event"`
+	Status        DeliveryStatus `json:"status"`
+	Attempts      int            `json:"attempts"`
+	StatusCode    int            `json:"status_code,omitempty"` // 最近一次请求的响应状态码
+	Error         string         `json:"error,omitempty"`       // 最近一次请求的错误
+	Response      string         `json:"response,omitempty"`    // 最近一次响应内容（截断）
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty"`
+
+	body []byte
+}
+
+// DeadLetter 重试次数用尽的投递，追加写入死信日志
+type DeadLetter struct {
+	Delivery
+	URL     string          `json:"url"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Dispatcher 订阅事件总线，把事件投递到匹配的端点，失败时按指数退避重试
+type Dispatcher struct {
+	store          *Store
+	bus            *events.Bus
+	client         *http.Client
+	opts           Options
+	deadLetterPath string
+
+	queue   chan *Delivery
+	nextID  atomic.Uint64
+	history map[string][]*Delivery // endpointID -> 投递记录（旧的在前）
+	timers  map[string]*time.Timer // deliveryID -> 重试定时器
+	mu      sync.Mutex
+	deadMu  sync.Mutex
+
+	cancel  func()
+	stop    chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher 创建 webhook 投递器
+func NewDispatcher(store *Store, bus *events.Bus, dataDir string, opts Options) *Dispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = 50
+	}
+	return &Dispatcher{
+		store:          store,
+		bus:            bus,
+		client:         &http.Client{Timeout: opts.Timeout},
+		opts:           opts,
+		deadLetterPath: filepath.Join(dataDir, "webhook_dead_letters.log"),
+		queue:          make(chan *Delivery, queueSize),
+		history:        make(map[string][]*Delivery),
+		timers:         make(map[string]*time.Timer),
+		stop:           make(chan struct{}),
+	}
+}
+
+// Store 返回端点存储
+func (d *Dispatcher) Store() *Store {
+	return d.store
+}
+
+// Start 开始订阅事件并投递
+func (d *Dispatcher) Start() {
+	ch, cancel := d.bus.Subscribe(queueSize)
+	d.cancel = cancel
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for event := range ch {
+			d.dispatch(event)
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case delivery := <-d.queue:
+					d.attempt(delivery)
+				case <-d.stop:
+					return
+				}
+			}
+		}()
+	}
+	log.Printf("[Webhook] Dispatcher started (max attempts %d, retry base %v)", d.opts.MaxAttempts, d.opts.RetryBase)
+}
+
+// Stop 停止投递，仍在等待重试的投递写入死信日志
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	var abandoned []Delivery
+	for _, history := range d.history {
+		for _, delivery := range history {
+			timer, ok := d.timers[delivery.ID]
+			if !ok || !timer.Stop() {
+				continue
+			}
+			delivery.Status = StatusFailed
+			delivery.NextAttemptAt = nil
+			abandoned = append(abandoned, *delivery)
+		}
+	}
+	d.timers = make(map[string]*time.Timer)
+	d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+	close(d.stop)
+	d.wg.Wait()
+
+	for _, delivery := range abandoned {
+		d.writeDeadLetter(delivery)
+	}
+}
+
+// dispatch 为事件创建到各匹配端点的投递
+func (d *Dispatcher) dispatch(event events.Event) {
+	for _, endpoint := range d.store.matching(event.Type) {
+		delivery, err := d.newDelivery(endpoint.ID, Payload{
+			Event:   event.Type,
+			Seq:     event.Seq,
+			Session: event.Session,
+			Time:    event.Time,
+			Data:    event.Data,
+		})
+		if err != nil {
+			log.Printf("[Webhook] Failed to encode %s event for %s: %v", event.Type, endpoint.ID, err)
+			continue
+		}
+		d.enqueue(delivery)
+	}
+}
+
+// newDelivery 创建投递记录并加入端点的历史
+func (d *Dispatcher) newDelivery(endpointID string, payload Payload) (*Delivery, error) {
+	payload.ID = fmt.Sprintf("dlv_%d_%d", time.Now().UnixNano(), d.nextID.Add(1))
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery := &Delivery{
+		ID:         payload.ID,
+		EndpointID: endpointID,
+		Event:      payload.Event,
+		Status:     StatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		body:       body,
+	}
+
+	d.mu.Lock()
+	history := append(d.history[endpointID], delivery)
+	if len(history) > d.opts.HistorySize {
+		history = history[len(history)-d.opts.HistorySize:]
+	}
+	d.history[endpointID] = history
+	d.mu.Unlock()
+
+	return delivery, nil
+}
+
+// enqueue 把投递放入队列，队列已满时按失败处理进入重试
+func (d *Dispatcher) enqueue(delivery *Delivery) {
+	select {
+	case d.queue <- delivery:
+	case <-d.stop:
+	default:
+		d.finish(delivery, 0, "", fmt.Errorf("delivery queue is full"))
+	}
+}
+
+// attempt 执行一次投递
+func (d *Dispatcher) attempt(delivery *Delivery) {
+	endpoint, err := d.store.Get(delivery.EndpointID)
+	if err != nil {
+		d.mu.Lock()
+		delivery.Status = StatusFailed
+		delivery.Error = "endpoint was deleted"
+		delivery.NextAttemptAt = nil
+		delivery.UpdatedAt = time.Now()
+		d.mu.Unlock()
+		return
+	}
+
+	statusCode, response, err := d.post(endpoint, delivery)
+	d.finish(delivery, statusCode, response, err)
+}
+
+// post 发送签名后的请求，非 2xx 响应视为失败
+func (d *Dispatcher) post(endpoint Endpoint, delivery *Delivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "remote-code-webhook")
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, delivery.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// Sign 计算签名：对 "时间戳.请求体" 做 HMAC-SHA256，格式为 sha256=<hex>
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// finish 记录投递结果，失败时安排重试或写入死信日志
+func (d *Dispatcher) finish(delivery *Delivery, statusCode int, response string, err error) {
+	d.mu.Lock()
+	now := time.Now()
+	delivery.Attempts++
+	delivery.StatusCode = statusCode
+	delivery.Response = response
+	delivery.UpdatedAt = now
+	delivery.NextAttemptAt = nil
+	delete(d.timers, delivery.ID)
+
+	if err == nil {
+		delivery.Status = StatusSucceeded
+		delivery.Error = ""
+		d.mu.Unlock()
+		return
+	}
+	delivery.Error = err.Error()
+
+	if delivery.Attempts >= d.opts.MaxAttempts || d.stopped {
+		delivery.Status = StatusFailed
+		dead := *delivery
+		d.mu.Unlock()
+
+		log.Printf("[Webhook] Delivery %s to %s failed after %d attempt(s): %v", delivery.ID, delivery.EndpointID, dead.Attempts, err)
+		d.writeDeadLetter(dead)
+		return
+	}
+
+	delay := d.opts.RetryBase << (delivery.Attempts - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	next := now.Add(delay)
+	delivery.Status = StatusRetrying
+	delivery.NextAttemptAt = &next
+	d.timers[delivery.ID] = time.AfterFunc(delay, func() {
+		d.enqueue(delivery)
+	})
+	d.mu.Unlock()
+
+	log.Printf("[Webhook] Delivery %s to %s failed (attempt %d), retrying in %v: %v", delivery.ID, delivery.EndpointID, delivery.Attempts, delay, err)
+}
+
+// writeDeadLetter 把重试次数用尽的投递追加写入死信日志
+func (d *Dispatcher) writeDeadLetter(delivery Delivery) {
+	entry := DeadLetter{
+		Delivery: delivery,
+		Payload:  delivery.body,
+	}
+	if endpoint, err := d.store.Get(delivery.EndpointID); err == nil {
+		entry.URL = endpoint.URL
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[Webhook] Failed to encode dead letter %s: %v", delivery.ID, err)
+		return
+	}
+
+	d.deadMu.Lock()
+	defer d.deadMu.Unlock()
+
+	f, err := os.OpenFile(d.deadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("[Webhook] Failed to open dead letter log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("[Webhook] Failed to write dead letter %s: %v", delivery.ID, err)
+	}
+}
+
+// DeadLetters 返回死信日志中最近的 limit 条记录（新的在前），endpointID 不为空时只返回该端点的记录
+func (d *Dispatcher) DeadLetters(endpointID string, limit int) ([]DeadLetter, error) {
+	d.deadMu.Lock()
+	defer d.deadMu.Unlock()
+
+	letters := make([]DeadLetter, 0)
+	f, err := os.Open(d.deadLetterPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return letters, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			continue
+		}
+		if endpointID != "" && letter.EndpointID != endpointID {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// 新的在前
+	for i, j := 0, len(letters)-1; i < j; i, j = i+1, j-1 {
+		letters[i], letters[j] = letters[j], letters[i]
+	}
+	if limit > 0 && len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return letters, nil
+}
+
+// Deliveries 返回端点最近的投递记录（新的在前）
+func (d *Dispatcher) Deliveries(endpointID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	history := d.history[endpointID]
+	deliveries := make([]Delivery, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *history[i])
+	}
+	return deliveries
+}
+
+// Forget 删除端点的投递记录并取消其待重试的投递
+func (d *Dispatcher) Forget(endpointID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, delivery := range d.history[endpointID] {
+		if timer, ok := d.timers[delivery.ID]; ok {
+			timer.Stop()
+			delete(d.timers, delivery.ID)
+		}
+	}
+	delete(d.history, endpointID)
+}
+
+// Test 向端点发送一次测试事件并同步返回首次投递的结果，失败时与普通投递一样进入重试
+func (d *Dispatcher) Test(endpointID string) (Delivery, error) {
+	if _, err := d.store.Get(endpointID); err != nil {
+		return Delivery{}, err
+	}
+
+	delivery, err := d.newDelivery(endpointID, Payload{
+		Event: TestEvent,
+		Time:  time.Now(),
+		Data: map[string]string{
+			"message": "This is a test delivery from Remote Code",
+		},
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+	d.attempt(delivery)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return *delivery, nil
+}
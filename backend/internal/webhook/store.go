@@ -0,0 +1,275 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaoliu10/remote-code/internal/events"
+)
+
+// 端点字段限制
+const (
+	MaxNameLength   = 64
+	MaxSecretLength = 256
+	MaxEventFilters = 32
+)
+
+var (
+	ErrEndpointNotFound = errors.New("webhook endpoint not found")
+)
+
+// Endpoint 出站 webhook 端点：匹配的事件以签名 JSON 的形式 POST 到 URL
+type Endpoint struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // HMAC-SHA256 签名密钥
+	Events    []string  `json:"events"`           // 事件过滤，为空表示所有事件，支持 session.* 通配
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate 校验端点配置
+func (e *Endpoint) Validate() error {
+	if e.Name == "" || len(e.Name) > MaxNameLength {
+		return fmt.Errorf("name must be 1-%d characters", MaxNameLength)
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(e.Secret) > MaxSecretLength {
+		return fmt.Errorf("secret must be at most %d characters", MaxSecretLength)
+	}
+	if len(e.Events) > MaxEventFilters {
+		return fmt.Errorf("at most %d event filters are allowed", MaxEventFilters)
+	}
+	for _, filter := range e.Events {
+		if !validFilter(filter) {
+			return fmt.Errorf("unknown event type: %q", filter)
+		}
+	}
+	return nil
+}
+
+// validFilter 判断事件过滤条件是否为已知事件类型或能匹配已知类型的通配
+func validFilter(filter string) bool {
+	for _, t := range events.AllTypes {
+		if filterMatches(filter, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMatches 判断单个过滤条件是否匹配事件类型：完全相同、"*" 或 "session.*" 形式的前缀通配
+func filterMatches(filter string, t events.Type) bool {
+	if filter == "*" || filter == string(t) {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(filter, "*"); ok && strings.HasSuffix(prefix, ".") {
+		return strings.HasPrefix(string(t), prefix)
+	}
+	return false
+}
+
+// Matches 判断端点是否订阅了该类型的事件
+func (e *Endpoint) Matches(t events.Type) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, filter := range e.Events {
+		if filterMatches(filter, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateSecret 生成随机签名密钥
+func generateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Store 端点存储，持久化到数据目录的 webhooks.json
+type Store struct {
+	path      string
+	endpoints map[string]*Endpoint
+	mu        sync.RWMutex
+}
+
+// NewStore 创建端点存储并加载已保存的端点
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{
+		path:      filepath.Join(dataDir, "webhooks.json"),
+		endpoints: make(map[string]*Endpoint),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var endpoints []*Endpoint
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook endpoint %s: %w", endpoint.ID, err)
+		}
+		s.endpoints[endpoint.ID] = endpoint
+	}
+	return s, nil
+}
+
+// saveLocked 将所有端点写入文件（调用方需持有锁）
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// listLocked 按创建时间返回所有端点（调用方需持有锁）
+func (s *Store) listLocked() []*Endpoint {
+	endpoints := make([]*Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints
+}
+
+// List 返回所有端点的副本
+func (s *Store) List() []Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoints := make([]Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.listLocked() {
+		endpoints = append(endpoints, *endpoint)
+	}
+	return endpoints
+}
+
+// Get 获取指定端点
+func (s *Store) Get(id string) (Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return Endpoint{}, ErrEndpointNotFound
+	}
+	return *endpoint, nil
+}
+
+// Put 校验并保存端点，ID 为空时创建新端点。
+// 新端点未指定密钥时自动生成，更新时未指定密钥则保留原密钥
+func (s *Store) Put(endpoint Endpoint) (Endpoint, error) {
+	if err := endpoint.Validate(); err != nil {
+		return Endpoint{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if endpoint.ID == "" {
+		endpoint.ID = fmt.Sprintf("whk_%d", now.UnixNano())
+		endpoint.CreatedAt = now
+		if endpoint.Secret == "" {
+			secret, err := generateSecret()
+			if err != nil {
+				return Endpoint{}, err
+			}
+			endpoint.Secret = secret
+		}
+	} else {
+		existing, ok := s.endpoints[endpoint.ID]
+		if !ok {
+			return Endpoint{}, ErrEndpointNotFound
+		}
+		endpoint.CreatedAt = existing.CreatedAt
+		if endpoint.Secret == "" {
+			endpoint.Secret = existing.Secret
+		}
+	}
+	endpoint.UpdatedAt = now
+
+	s.endpoints[endpoint.ID] = &endpoint
+	if err := s.saveLocked(); err != nil {
+		return Endpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// Delete 删除端点
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrEndpointNotFound
+	}
+	delete(s.endpoints, id)
+	return s.saveLocked()
+}
+
+// matching 返回订阅了该类型事件的已启用端点
+func (s *Store) matching(t events.Type) []Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var endpoints []Endpoint
+	for _, endpoint := range s.listLocked() {
+		if endpoint.Enabled && endpoint.Matches(t) {
+			endpoints = append(endpoints, *endpoint)
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,73 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import "strings"
+
+// maxPatchCandidates 计算输出增量时最多尝试的对齐位置
+const maxPatchCandidates = 64
+
+// OutputPatch v2 协议的输出消息：新内容为上次内容按行拆分后的
+// lines[Drop:Drop+Keep] 加上 Lines，再以换行符连接。Keep 为 0 时 Lines 即完整内容
+type OutputPatch struct {
+	Drop      int      `json:"drop"`
+	Keep      int      `json:"keep"`
+	Lines     []string `json:"lines"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// FullOutput v1 客户端收到的完整输出
+type FullOutput struct {
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// NewOutputPatch 计算从 previous 到 current 的输出增量。
+// 终端输出通常是在末尾追加或整体上滚，因此寻找 current 的开头在 previous 中的位置，
+// 保留最长的公共部分
+func NewOutputPatch(previous, current string) OutputPatch {
+	cur := strings.Split(current, "\n")
+	best := OutputPatch{Lines: cur}
+	if previous == "" {
+		return best
+	}
+
+	prev := strings.Split(previous, "\n")
+	candidates := 0
+	for drop := 0; drop < len(prev) && candidates < maxPatchCandidates; drop++ {
+		if prev[drop] != cur[0] {
+			continue
+		}
+		candidates++
+
+		keep := 0
+		for keep < len(cur) && drop+keep < len(prev) && prev[drop+keep] == cur[keep] {
+			keep++
+		}
+		if keep > best.Keep {
+			best = OutputPatch{Drop: drop, Keep: keep, Lines: cur[keep:]}
+		}
+		// 上次内容的剩余部分已全部保留，更靠后的位置不会保留更多
+		if drop+keep == len(prev) {
+			break
+		}
+	}
+	return best
+}
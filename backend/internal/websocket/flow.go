@@ -0,0 +1,164 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// clientStats 客户端的流控统计，受分片的锁保护
+type clientStats struct {
+	connectedAt time.Time
+	pausedSince time.Time // 输出暂停的起始时间，零值表示未暂停
+	sent        uint64
+	dropped     uint64
+	coalesced   uint64
+	maxQueued   int
+}
+
+// ClientStats 单个客户端的流控指标
+type ClientStats struct {
+	Session     string    `json:"session"`
+	UserID      string    `json:"user_id"`
+	Protocol    string    `json:"protocol"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Seq         uint64    `json:"seq"`        // 会话最新的消息序号
+	Queued      int       `json:"queued"`     // 发送队列中尚未写出的消息数
+	QueueSize   int       `json:"queue_size"` // 发送队列容量
+	MaxQueued   int       `json:"max_queued"` // 发送队列的最大积压
+	Sent        uint64    `json:"sent"`       // 放入发送队列的消息数
+	Dropped     uint64    `json:"dropped"`    // 发送队列已满而丢弃的消息数
+	Coalesced   uint64    `json:"coalesced"`  // 输出暂停期间合并的输出次数
+	Paused      bool      `json:"paused"`     // 客户端消费过慢，输出已暂停
+	LagMs       int64     `json:"lag_ms"`     // 输出暂停的时长（毫秒）
+}
+
+// Stats Hub 的流控指标
+type Stats struct {
+	Clients   []ClientStats `json:"clients"`
+	Paused    int           `json:"paused"`    // 输出暂停的客户端数
+	Dropped   uint64        `json:"dropped"`   // 累计丢弃的消息数
+	Coalesced uint64        `json:"coalesced"` // 累计合并的输出次数
+}
+
+// outputHighWater 发送队列积压到一半时暂停输出
+func outputHighWater(client *Client) int {
+	return cap(client.Send) / 2
+}
+
+// outputLowWater 暂停后积压降到四分之一以下才恢复输出，避免频繁切换
+func outputLowWater(client *Client) int {
+	return cap(client.Send) / 4
+}
+
+// PauseOutput 检查是否应暂停向客户端推送输出。客户端消费过慢时暂停捕获输出，
+// 恢复后推送一次从上次输出到最新输出的变化，期间的输出被合并
+func (h *Hub) PauseOutput(client *Client) bool {
+	s := h.shard(client.SessionID, false)
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client == client && s.paused(client)
+}
+
+// paused 更新并返回客户端的暂停状态，暂停时计入一次合并。调用方需持有 s.mu
+func (s *shard) paused(client *Client) bool {
+	queued := len(client.Send)
+	stats := &client.stats
+
+	if stats.pausedSince.IsZero() {
+		if queued < outputHighWater(client) {
+			return false
+		}
+		stats.pausedSince = time.Now()
+		log.Printf("[Hub] Output paused: session=%s queued=%d", client.SessionID, queued)
+	} else if queued <= outputLowWater(client) {
+		log.Printf("[Hub] Output resumed: session=%s after %v, coalesced=%d", client.SessionID, time.Since(stats.pausedSince).Round(time.Millisecond), stats.coalesced)
+		stats.pausedSince = time.Time{}
+		return false
+	}
+
+	stats.coalesced++
+	atomic.AddUint64(&s.hub.coalesced, 1)
+	return true
+}
+
+// Stats 返回客户端的流控指标。userID 为空时返回所有客户端和 Hub 的累计值，
+// 否则只返回该用户的客户端，累计值为这些客户端之和
+func (h *Hub) Stats(userID string) Stats {
+	stats := Stats{Clients: make([]ClientStats, 0)}
+	if userID == "" {
+		stats.Dropped = atomic.LoadUint64(&h.dropped)
+		stats.Coalesced = atomic.LoadUint64(&h.coalesced)
+	}
+	for _, s := range h.snapshot() {
+		item, ok := s.stats(userID)
+		if !ok {
+			continue
+		}
+		if item.Paused {
+			stats.Paused++
+		}
+		if userID != "" {
+			stats.Dropped += item.Dropped
+			stats.Coalesced += item.Coalesced
+		}
+		stats.Clients = append(stats.Clients, item)
+	}
+
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].Session < stats.Clients[j].Session
+	})
+	return stats
+}
+
+// stats 返回分片当前连接的流控指标，没有连接或连接不属于 userID 时返回 false
+func (s *shard) stats(userID string) (ClientStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := s.client
+	if client == nil || (userID != "" && client.UserID != userID) {
+		return ClientStats{}, false
+	}
+	item := ClientStats{
+		Session:     s.session,
+		UserID:      client.UserID,
+		Protocol:    client.Protocol.Subprotocol(),
+		ConnectedAt: client.stats.connectedAt,
+		Seq:         s.backlog.seq,
+		Queued:      len(client.Send),
+		QueueSize:   cap(client.Send),
+		MaxQueued:   client.stats.maxQueued,
+		Sent:        client.stats.sent,
+		Dropped:     client.stats.dropped,
+		Coalesced:   client.stats.coalesced,
+		Paused:      !client.stats.pausedSince.IsZero(),
+	}
+	if item.Paused {
+		item.LagMs = time.Since(client.stats.pausedSince).Milliseconds()
+	}
+	return item, true
+}
@@ -22,7 +22,6 @@ package websocket
 import (
 	"encoding/json"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 
@@ -38,18 +37,27 @@ const (
 
 // Message WebSocket 消息类型
 type Message struct {
-	Type    string      `json:"type"`    // output, command, status, error
+	Type    string      `json:"type"` // output, command, status, error
 	Data    interface{} `json:"data"`
 	Session string      `json:"session,omitempty"`
+	ID      string      `json:"id,omitempty"`   // 回复的客户端请求 ID（ack、error、pong）
+	Code    ErrorCode   `json:"code,omitempty"` // 错误码（error）
+	Seq     uint64      `json:"seq,omitempty"`  // 会话内单调递增的序号，出现间隔说明有消息被丢弃
 }
 
-// Client WebSocket 客户端连接
+// Client WebSocket 客户端连接。Conn 为 nil 表示非 WebSocket 客户端（SSE/长轮询），
+// 由对应的处理器从 Send 读取消息
 type Client struct {
 	Hub       *Hub
 	Conn      *websocket.Conn
 	Send      chan []byte
 	SessionID string
 	UserID    string
+	IsAdmin   bool     // 管理员可以收到所有会话的提醒
+	Protocol  Protocol // 协商的协议版本，零值按 v1 处理
+	LastSeq   uint64   // 重连的客户端收到的最后一条消息序号，0 表示新连接
+	synced    bool     // 已收到完整输出，之后只推送变化，受分片的锁保护
+	stats     clientStats
 	closed    bool
 	closeMu   sync.Mutex
 }
@@ -66,139 +74,236 @@ func (c *Client) SafeClose() {
 	close(c.Send)
 }
 
-// Hub WebSocket 连接池管理器
+// encode 按客户端的协议版本编码消息
+func (c *Client) encode(message Message) ([]byte, error) {
+	if c.Protocol == 0 {
+		return ProtocolJSON.Encode(message)
+	}
+	return c.Protocol.Encode(message)
+}
+
+// CloseConn 关闭底层连接（非 WebSocket 客户端无连接可关闭）
+func (c *Client) CloseConn() {
+	if c.Conn != nil {
+		c.Conn.Close()
+	}
+}
+
+// Hub WebSocket 连接管理器。连接按会话分片，每个分片有独立的锁和分发协程，
+// 一个会话的慢客户端或大量消息不会阻塞其他会话
 type Hub struct {
-	clients    map[string]*Client // sessionID -> Client
-	userClients map[string]map[string]*Client // userID -> sessionID -> Client
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan Message
-	mu         sync.RWMutex
+	mu      sync.RWMutex
+	shards  map[string]*shard // sessionID -> 分片
+	stopped bool
+
+	resumeFrames int
+	resumeTTL    time.Duration
+
+	wg       sync.WaitGroup // 分片的分发协程
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// 流控累计值，原子访问
+	dropped   uint64
+	coalesced uint64
 }
 
-// NewHub 创建新的 Hub
-func NewHub() *Hub {
+// NewHub 创建新的 Hub，每个会话为断线重连保留 resumeFrames 条消息，
+// 会话没有连接 resumeTTL 后丢弃
+func NewHub(resumeFrames int, resumeTTL time.Duration) *Hub {
 	return &Hub{
-		clients:     make(map[string]*Client),
-		userClients: make(map[string]map[string]*Client),
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		broadcast:   make(chan Message),
+		shards:       make(map[string]*shard),
+		resumeFrames: resumeFrames,
+		resumeTTL:    resumeTTL,
+		done:         make(chan struct{}),
 	}
 }
 
-// Run 运行 Hub 主循环
+// Run 定期清理没有连接的会话分片，直到 Stop 被调用
 func (h *Hub) Run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case client := <-h.register:
-			h.registerClient(client)
-
-		case client := <-h.unregister:
-			h.unregisterClient(client)
-
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+		case <-ticker.C:
+			h.pruneShards()
+		case <-h.done:
+			return
 		}
 	}
 }
 
-// registerClient 注册新客户端
-func (h *Hub) registerClient(client *Client) {
+// Stop 关闭所有连接并等待分发协程退出，之后注册的连接会被立即关闭
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		h.mu.Lock()
+		h.stopped = true
+		shards := h.shards
+		h.shards = make(map[string]*shard)
+		h.mu.Unlock()
+
+		for _, s := range shards {
+			s.close()
+		}
+		h.wg.Wait()
+		close(h.done)
+		log.Printf("[Hub] Stopped, closed %d session(s)", len(shards))
+	})
+}
+
+// shard 返回会话的分片，create 为 true 时不存在则创建。Hub 已停止时返回 nil
+func (h *Hub) shard(sessionID string, create bool) *shard {
+	h.mu.RLock()
+	s, ok := h.shards[sessionID]
+	h.mu.RUnlock()
+	if ok || !create {
+		return s
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
-
-	// 如果同一会话已有连接，发送踢出消息给旧连接
-	if existing, exists := h.clients[client.SessionID]; exists {
-		// 发送踢出消息
-		kickMsg := Message{
-			Type: "kicked",
-			Data: "Your connection has been replaced by a new connection from another device",
-		}
-		if data, err := json.Marshal(kickMsg); err == nil {
-			select {
-			case existing.Send <- data:
-			default:
-			}
-		}
-		// 给旧连接一点时间接收消息
-		time.Sleep(100 * time.Millisecond)
-		existing.Conn.Close()
-		existing.SafeClose()
+	if h.stopped {
+		return nil
 	}
+	if s, ok := h.shards[sessionID]; ok {
+		return s
+	}
+	s = newShard(h, sessionID)
+	h.shards[sessionID] = s
+	h.wg.Add(1)
+	go s.run()
+	return s
+}
 
-	h.clients[client.SessionID] = client
+// snapshot 返回当前所有分片
+func (h *Hub) snapshot() []*shard {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	// 按用户索引
-	if h.userClients[client.UserID] == nil {
-		h.userClients[client.UserID] = make(map[string]*Client)
+	shards := make([]*shard, 0, len(h.shards))
+	for _, s := range h.shards {
+		shards = append(shards, s)
 	}
-	h.userClients[client.UserID][client.SessionID] = client
-
-	log.Printf("[Hub] Client registered: session=%s user=%s", client.SessionID, client.UserID)
+	return shards
 }
 
-// unregisterClient 注销客户端
-func (h *Hub) unregisterClient(client *Client) {
+// pruneShards 关闭没有连接超过 resumeTTL 的分片，同时丢弃其重连缓冲区
+func (h *Hub) pruneShards() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if _, ok := h.clients[client.SessionID]; ok {
-		delete(h.clients, client.SessionID)
-		client.SafeClose()
-		client.Conn.Close()
+	for sessionID, s := range h.shards {
+		if s.closeIfIdle(h.resumeTTL) {
+			delete(h.shards, sessionID)
+		}
 	}
+}
 
-	if userMap, ok := h.userClients[client.UserID]; ok {
-		delete(userMap, client.SessionID)
-		if len(userMap) == 0 {
-			delete(h.userClients, client.UserID)
+// Register 注册客户端。同一会话已有连接时旧连接收到 kicked 消息后被关闭
+func (h *Hub) Register(client *Client) {
+	for {
+		s := h.shard(client.SessionID, true)
+		if s == nil {
+			// Hub 已停止
+			client.SafeClose()
+			client.CloseConn()
+			return
+		}
+		// 分片恰好被清理时重新创建
+		if s.add(client) {
+			return
 		}
 	}
-
-	log.Printf("[Hub] Client unregistered: session=%s user=%s", client.SessionID, client.UserID)
 }
 
-// broadcastMessage 广播消息
-func (h *Hub) broadcastMessage(message Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	// 序列化消息
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("[Hub] Failed to marshal message: %v", err)
-		return
+// Unregister 注销客户端，被踢出的旧连接注销时不会影响新连接
+func (h *Hub) Unregister(client *Client) {
+	if s := h.shard(client.SessionID, false); s != nil {
+		s.remove(client)
 	}
+}
 
-	// 发送给目标会话的客户端
-	if client, ok := h.clients[message.Session]; ok {
-		select {
-		case client.Send <- data:
-		default:
-			log.Printf("[Hub] Send channel full for session=%s", message.Session)
-		}
+// SendToSession 发送消息到指定会话，由会话的分发协程异步发送，不会阻塞调用方
+func (h *Hub) SendToSession(sessionID string, msgType string, data interface{}) {
+	if s := h.shard(sessionID, false); s != nil {
+		s.enqueue(envelope{message: Message{
+			Type:    msgType,
+			Data:    data,
+			Session: sessionID,
+		}})
 	}
 }
 
-// SendToSession 发送消息到指定会话
-func (h *Hub) SendToSession(sessionID string, msgType string, data interface{}) {
-	h.broadcast <- Message{
+// SendToUser 发送消息给指定用户的所有连接以及管理员的连接，
+// 用于推送与当前查看的会话无关的通知（如其他会话的提醒）
+func (h *Hub) SendToUser(userID string, msgType string, sessionID string, data interface{}) {
+	message := Message{
 		Type:    msgType,
 		Data:    data,
 		Session: sessionID,
 	}
+	// 每个会话的序号独立，由各分片分别序列化
+	for _, s := range h.snapshot() {
+		s.enqueue(envelope{message: message, toUser: true, userID: userID})
+	}
+}
+
+// Reply 直接发送消息给指定客户端，客户端已注销时忽略
+func (h *Hub) Reply(client *Client, message Message) {
+	if s := h.shard(client.SessionID, false); s != nil {
+		s.reply(client, message)
+	}
+}
+
+// Ack 确认客户端请求 id 已处理，id 为空时不回复
+func (h *Hub) Ack(client *Client, id string, data interface{}) {
+	if id == "" {
+		return
+	}
+	h.Reply(client, Message{Type: TypeAck, ID: id, Data: data})
+}
+
+// SendError 向客户端回复错误，id 为触发错误的请求 ID，可以为空
+func (h *Hub) SendError(client *Client, id string, code ErrorCode, text string) {
+	h.Reply(client, Message{Type: TypeError, ID: id, Code: code, Data: text})
+}
+
+// PublishOutput 推送会话的最新输出：未同步的客户端收到完整输出，之后只在输出变化时
+// 推送补丁（v1 客户端仍收到完整输出）。客户端已注销时忽略
+func (h *Hub) PublishOutput(client *Client, text string) {
+	if s := h.shard(client.SessionID, false); s != nil {
+		s.publish(client, text)
+	}
+}
+
+// ResetSession 丢弃会话的重连缓冲区，会话被删除或重命名后旧的序号不再有效
+func (h *Hub) ResetSession(sessionID string) {
+	if s := h.shard(sessionID, false); s != nil {
+		s.reset()
+	}
+}
+
+// DisconnectUser 踢出用户的所有连接，用于账号被停用、删除或角色变化后
+func (h *Hub) DisconnectUser(userID, reason string) int {
+	count := 0
+	for _, s := range h.snapshot() {
+		if s.kick(userID, reason) {
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("[Hub] Disconnected %d connection(s) of user %s", count, userID)
+	}
+	return count
 }
 
 // GetUserSessions 获取用户的所有活跃会话
 func (h *Hub) GetUserSessions(userID string) []string {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
 	sessions := make([]string, 0)
-	if userMap, ok := h.userClients[userID]; ok {
-		for sessionID := range userMap {
-			sessions = append(sessions, sessionID)
+	for _, s := range h.snapshot() {
+		if client := s.current(); client != nil && client.UserID == userID {
+			sessions = append(sessions, s.session)
 		}
 	}
 	return sessions
@@ -206,16 +311,14 @@ func (h *Hub) GetUserSessions(userID string) []string {
 
 // IsSessionActive 检查会话是否有活跃的 WebSocket 连接
 func (h *Hub) IsSessionActive(sessionID string) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, ok := h.clients[sessionID]
-	return ok
+	s := h.shard(sessionID, false)
+	return s != nil && s.current() != nil
 }
 
 // ReadPump 从 WebSocket 连接读取消息
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.unregister <- c
+		c.Hub.Unregister(c)
 		c.Conn.Close()
 	}()
 
@@ -227,7 +330,7 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		frameType, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("[WS] Unexpected close: %v", err)
@@ -237,7 +340,7 @@ func (c *Client) ReadPump() {
 
 		// 处理接收到的消息
 		var msg Message
-		if err := json.Unmarshal(message, &msg); err == nil {
+		if data, err := ToJSON(frameType, message); err == nil && json.Unmarshal(data, &msg) == nil {
 			c.handleMessage(msg)
 		}
 	}
@@ -260,7 +363,13 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			// 协商了 permessage-deflate 时只压缩较大的消息
+			c.Conn.EnableWriteCompression(len(message) >= compressionThreshold)
+			frameType := websocket.TextMessage
+			if c.Protocol != 0 {
+				frameType = c.Protocol.FrameType()
+			}
+			if err := c.Conn.WriteMessage(frameType, message); err != nil {
 				log.Printf("[WS] Write error: %v", err)
 				return
 			}
@@ -283,26 +392,7 @@ func (c *Client) handleMessage(msg Message) {
 			log.Printf("[WS] Command received: %s", cmd)
 			// 这里可以触发命令执行逻辑
 		}
-	case "ping":
-		c.Hub.SendToSession(c.SessionID, "pong", nil)
+	case TypePing:
+		c.Hub.Reply(c, Message{Type: TypePong, ID: msg.ID})
 	}
 }
-
-// Upgrader WebSocket 升级器
-var Upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 生产环境应设置严格的 Origin 检查
-	},
-}
-
-// Register 注册客户端（导出方法）
-func (h *Hub) Register(client *Client) {
-	h.register <- client
-}
-
-// Unregister 注销客户端（导出方法）
-func (h *Hub) Unregister(client *Client) {
-	h.unregister <- client
-}
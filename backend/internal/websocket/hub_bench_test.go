@@ -0,0 +1,191 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchHub 基准测试用的 Hub：每个会话一个无连接客户端，由后台协程读取发送队列
+type benchHub struct {
+	hub       *Hub
+	clients   []*Client
+	slow      []*Client
+	received  int64
+	consumers sync.WaitGroup
+}
+
+// newBenchHub 创建 sessions 个会话，slow 个客户端不读取发送队列以模拟慢客户端
+func newBenchHub(b *testing.B, sessions, slow int, userID func(i int) string) *benchHub {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	bh := &benchHub{hub: NewHub(256, time.Minute)}
+	for i := 0; i < sessions; i++ {
+		client := &Client{
+			Hub:       bh.hub,
+			Send:      make(chan []byte, 256),
+			SessionID: fmt.Sprintf("bench-%d", i),
+			UserID:    userID(i),
+			Protocol:  ProtocolMsgpack,
+		}
+		bh.hub.Register(client)
+		<-client.Send // hello
+		bh.clients = append(bh.clients, client)
+		if i < slow {
+			bh.slow = append(bh.slow, client)
+			continue
+		}
+		bh.consumers.Add(1)
+		go func() {
+			defer bh.consumers.Done()
+			for range client.Send {
+				atomic.AddInt64(&bh.received, 1)
+			}
+		}()
+	}
+	return bh
+}
+
+// settled 返回已送达、丢弃和积压在慢客户端队列中的消息数
+func (bh *benchHub) settled() int64 {
+	n := atomic.LoadInt64(&bh.received) + int64(atomic.LoadUint64(&bh.hub.dropped))
+	for _, client := range bh.slow {
+		n += int64(len(client.Send))
+	}
+	return n
+}
+
+// wait 等待 n 条消息被送达、丢弃或积压在慢客户端，然后停止 Hub
+func (bh *benchHub) wait(b *testing.B, n int64) {
+	deadline := time.Now().Add(10 * time.Second)
+	for bh.settled() < n && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Microsecond)
+	}
+	b.StopTimer()
+	// 发送方从不阻塞，超出分发能力的消息被丢弃，报告实际送达的吞吐量
+	if n > 0 {
+		received := atomic.LoadInt64(&bh.received)
+		b.ReportMetric(float64(received)/b.Elapsed().Seconds(), "delivered/s")
+		b.ReportMetric(float64(atomic.LoadUint64(&bh.hub.dropped))/float64(n), "dropped/msg")
+	}
+	bh.hub.Stop()
+	bh.consumers.Wait()
+}
+
+func sameUser(int) string { return "bench" }
+
+func userPerSession(i int) string { return fmt.Sprintf("user-%d", i) }
+
+// BenchmarkSendToSession 多个协程并发向数百个会话发送消息，其中一个会话的客户端不读取
+func BenchmarkSendToSession(b *testing.B) {
+	for _, sessions := range []int{100, 500, 1000} {
+		b.Run(fmt.Sprintf("sessions=%d", sessions), func(b *testing.B) {
+			bh := newBenchHub(b, sessions, 1, userPerSession)
+			var next uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddUint64(&next, 1) % uint64(sessions)
+					bh.hub.SendToSession(bh.clients[i].SessionID, TypeStatus, "Command sent")
+				}
+			})
+			// 慢客户端的消息最多占满其发送队列，其余被丢弃
+			bh.wait(b, int64(b.N))
+		})
+	}
+}
+
+// BenchmarkPublishOutput 数百个会话并发推送输出补丁
+func BenchmarkPublishOutput(b *testing.B) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("line %d: %s", i, strings.Repeat("x", 60)))
+	}
+	outputs := []string{
+		strings.Join(lines, "\n"),
+		strings.Join(append(lines[1:], "prompt $ make test"), "\n"),
+	}
+
+	for _, sessions := range []int{100, 500} {
+		b.Run(fmt.Sprintf("sessions=%d", sessions), func(b *testing.B) {
+			bh := newBenchHub(b, sessions, 0, userPerSession)
+			var next uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := atomic.AddUint64(&next, 1)
+					client := bh.clients[n%uint64(sessions)]
+					bh.hub.PublishOutput(client, outputs[(n/uint64(sessions))%2])
+				}
+			})
+			bh.wait(b, 0)
+		})
+	}
+}
+
+// BenchmarkSendToUser 一条通知扇出到同一用户的数百个连接
+func BenchmarkSendToUser(b *testing.B) {
+	for _, viewers := range []int{100, 500} {
+		b.Run(fmt.Sprintf("viewers=%d", viewers), func(b *testing.B) {
+			bh := newBenchHub(b, viewers, 0, sameUser)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bh.hub.SendToUser("bench", TypeAlert, "bench-0", map[string]string{"kind": "bell"})
+			}
+			bh.wait(b, int64(b.N)*int64(viewers))
+		})
+	}
+}
+
+// BenchmarkRegister 数百个会话上并发替换连接，旧连接被踢出
+func BenchmarkRegister(b *testing.B) {
+	for _, sessions := range []int{100, 500} {
+		b.Run(fmt.Sprintf("sessions=%d", sessions), func(b *testing.B) {
+			bh := newBenchHub(b, sessions, 0, userPerSession)
+			var next uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddUint64(&next, 1) % uint64(sessions)
+					client := &Client{
+						Hub:       bh.hub,
+						Send:      make(chan []byte, 4),
+						SessionID: bh.clients[i].SessionID,
+						UserID:    bh.clients[i].UserID,
+					}
+					bh.hub.Register(client)
+					bh.hub.Unregister(client)
+				}
+			})
+			bh.wait(b, 0)
+		})
+	}
+}
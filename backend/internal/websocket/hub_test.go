@@ -0,0 +1,82 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// TestDisconnectUserThenPublish 踢出用户后继续推送输出和消息不应写入已关闭的发送队列
+func TestDisconnectUserThenPublish(t *testing.T) {
+	log.SetOutput(io.Discard)
+	hub := NewHub(256, time.Minute)
+	defer hub.Stop()
+
+	client := &Client{
+		Hub:       hub,
+		Send:      make(chan []byte, 256),
+		SessionID: "kick",
+		UserID:    "alice",
+		Protocol:  ProtocolJSON,
+	}
+	hub.Register(client)
+
+	if n := hub.DisconnectUser("alice", "account disabled"); n != 1 {
+		t.Fatalf("DisconnectUser() = %d, want 1", n)
+	}
+
+	// 读取协程、回退传输的推送协程和分发协程在踢出后仍可能发送
+	hub.PublishOutput(client, "after kick")
+	hub.Reply(client, Message{Type: TypeStatus, Data: "after kick"})
+	hub.SendToSession("kick", TypeStatus, "after kick")
+	hub.SendToUser("alice", TypeStatus, "kick", "after kick")
+	hub.Unregister(client)
+
+	// 发送队列被关闭，最后一条消息是 kicked
+	var last []byte
+	for data := range client.Send {
+		last = data
+	}
+	var message Message
+	if err := json.Unmarshal(last, &message); err != nil {
+		t.Fatalf("decode last message: %v", err)
+	}
+	if message.Type != TypeKicked {
+		t.Fatalf("last message type = %q, want %q", message.Type, TypeKicked)
+	}
+
+	// 同一会话的新连接不受影响
+	next := &Client{
+		Hub:       hub,
+		Send:      make(chan []byte, 256),
+		SessionID: "kick",
+		UserID:    "bob",
+		Protocol:  ProtocolMsgpack,
+	}
+	hub.Register(next)
+	hub.PublishOutput(next, "hello")
+	if len(next.Send) < 2 {
+		t.Fatalf("new client received %d message(s), want hello and output", len(next.Send))
+	}
+}
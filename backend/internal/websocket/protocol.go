@@ -0,0 +1,127 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Protocol 终端 WebSocket 协议版本，连接时通过 Sec-WebSocket-Protocol 协商
+type Protocol int
+
+const (
+	// ProtocolJSON v1：JSON 文本帧，每次输出携带完整内容。未请求子协议的客户端使用 v1
+	ProtocolJSON Protocol = 1
+	// ProtocolMsgpack v2：MessagePack 二进制帧，输出只携带与上次相比变化的行
+	ProtocolMsgpack Protocol = 2
+)
+
+// 各协议版本对应的子协议名
+const (
+	SubprotocolV1 = "remote-code.v1"
+	SubprotocolV2 = "remote-code.v2"
+)
+
+const (
+	// readBufferSize、writeBufferSize 连接的读写缓冲区大小
+	readBufferSize  = 4096
+	writeBufferSize = 16384
+	// compressionThreshold 小于该大小的消息不压缩，压缩的开销大于收益
+	compressionThreshold = 256
+)
+
+// writeBufferPool 空闲连接不占用写缓冲区
+var writeBufferPool = &sync.Pool{}
+
+// msgpackHandle MessagePack 编解码配置，结构体字段名沿用 json 标签
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// NewUpgrader 创建开启 permessage-deflate 的升级器，checkOrigin 校验请求来源，subprotocols 按优先级排列
+func NewUpgrader(checkOrigin func(r *http.Request) bool, subprotocols ...string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    readBufferSize,
+		WriteBufferSize:   writeBufferSize,
+		WriteBufferPool:   writeBufferPool,
+		EnableCompression: true,
+		Subprotocols:      subprotocols,
+		CheckOrigin:       checkOrigin,
+	}
+}
+
+// NegotiatedProtocol 返回升级时协商的协议版本
+func NegotiatedProtocol(conn *websocket.Conn) Protocol {
+	if conn.Subprotocol() == SubprotocolV2 {
+		return ProtocolMsgpack
+	}
+	return ProtocolJSON
+}
+
+// Encode 按协议编码消息
+func (p Protocol) Encode(message interface{}) ([]byte, error) {
+	if p != ProtocolMsgpack {
+		return json.Marshal(message)
+	}
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(message); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Subprotocol 返回协议版本对应的子协议名
+func (p Protocol) Subprotocol() string {
+	if p == ProtocolMsgpack {
+		return SubprotocolV2
+	}
+	return SubprotocolV1
+}
+
+// FrameType 返回协议使用的帧类型
+func (p Protocol) FrameType() int {
+	if p == ProtocolMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// ToJSON 把客户端消息统一转换为 JSON：文本帧原样返回，二进制帧按 MessagePack 解码。
+// v2 客户端也可以发送 JSON 文本帧
+func ToJSON(frameType int, data []byte) ([]byte, error) {
+	if frameType != websocket.BinaryMessage {
+		return data, nil
+	}
+	var message interface{}
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&message); err != nil {
+		return nil, err
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,91 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+// backlog 会话的消息流：分配会话内递增的序号，保留最近的消息和最新的完整输出，
+// 客户端重连时据此补发错过的消息。由会话分片在持有锁时访问
+type backlog struct {
+	seq    uint64
+	frames []Message // 环形缓冲区，按序号递增
+	start  int       // 最旧的消息在 frames 中的位置
+	count  int
+	text   string // 最新的完整输出
+}
+
+// newBacklog 创建最多保留 size 条消息的缓冲区
+func newBacklog(size int) *backlog {
+	if size < 1 {
+		size = 1
+	}
+	return &backlog{frames: make([]Message, size)}
+}
+
+// push 为消息分配下一个序号并记录，缓冲区已满时覆盖最旧的消息
+func (b *backlog) push(message Message) Message {
+	b.seq++
+	message.Seq = b.seq
+
+	if b.count < len(b.frames) {
+		b.frames[(b.start+b.count)%len(b.frames)] = message
+		b.count++
+	} else {
+		b.frames[b.start] = message
+		b.start = (b.start + 1) % len(b.frames)
+	}
+	return message
+}
+
+// since 返回序号大于 seq 的消息。seq 早于缓冲区中最旧的消息或晚于最新序号时
+// 无法补齐，返回 false，客户端需要完整重新同步
+func (b *backlog) since(seq uint64) ([]Message, bool) {
+	if seq > b.seq {
+		return nil, false
+	}
+	missed := int(b.seq - seq)
+	if missed > b.count {
+		return nil, false
+	}
+
+	messages := make([]Message, 0, missed)
+	for i := b.count - missed; i < b.count; i++ {
+		messages = append(messages, b.frames[(b.start+i)%len(b.frames)])
+	}
+	return messages, true
+}
+
+// replayable 返回需要补发给客户端的消息。v1 的每条输出都是完整内容，只保留最后一条
+func replayable(missed []Message, protocol Protocol) []Message {
+	if protocol == ProtocolMsgpack {
+		return missed
+	}
+	lastOutput := -1
+	for i, message := range missed {
+		if message.Type == TypeOutput {
+			lastOutput = i
+		}
+	}
+	replay := make([]Message, 0, len(missed))
+	for i, message := range missed {
+		if message.Type != TypeOutput || i == lastOutput {
+			replay = append(replay, message)
+		}
+	}
+	return replay
+}
@@ -0,0 +1,132 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// SchemaVersion 终端 WebSocket 消息格式版本，消息结构不兼容地变化时递增，
+// 与 docs/websocket-schema.json 保持一致
+const SchemaVersion = 1
+
+// 客户端消息类型
+const (
+	TypeCommand       = "command"
+	TypeKeys          = "keys"
+	TypeSnippet       = "snippet"
+	TypeEnterCopyMode = "enter_copy_mode"
+	TypeExitCopyMode  = "exit_copy_mode"
+	TypeScrollUp      = "scroll_up"
+	TypeScrollDown    = "scroll_down"
+	TypeResize        = "resize"
+	TypePing          = "ping"
+)
+
+// 服务器消息类型
+const (
+	TypeHello        = "hello"
+	TypeOutput       = "output"
+	TypeStatus       = "status"
+	TypeAck          = "ack"
+	TypeError        = "error"
+	TypePong         = "pong"
+	TypeKicked       = "kicked"
+	TypeSessionEnded = "session_ended"
+	TypeAlert        = "alert"
+	TypeAlertsAcked  = "alerts_acked"
+	TypePrompt       = "prompt"
+	TypeTrigger      = "trigger"
+)
+
+// ErrorCode error 消息的错误码
+type ErrorCode string
+
+const (
+	CodeInvalidMessage  ErrorCode = "INVALID_MESSAGE"   // 消息无法解析或缺少 type
+	CodeUnknownType     ErrorCode = "UNKNOWN_TYPE"      // 不支持的消息类型
+	CodeInvalidData     ErrorCode = "INVALID_DATA"      // data 的结构与消息类型不符
+	CodeUnsupported     ErrorCode = "UNSUPPORTED"       // 消息类型已定义但服务器尚未实现
+	CodeSnippetNotFound ErrorCode = "SNIPPET_NOT_FOUND" // 片段不存在或不可见
+	CodeCommandRejected ErrorCode = "COMMAND_REJECTED"  // 片段参数无效或命令被安全策略拒绝
+	CodeSendFailed      ErrorCode = "SEND_FAILED"       // 命令或按键发送到 tmux 失败
+	CodeCopyModeFailed  ErrorCode = "COPY_MODE_FAILED"  // 进入或退出 copy mode 失败
+	CodeScrollFailed    ErrorCode = "SCROLL_FAILED"     // copy mode 中滚动失败
+	CodeCaptureFailed   ErrorCode = "CAPTURE_FAILED"    // 捕获会话输出失败
+)
+
+// ErrMissingType 客户端消息缺少 type
+var ErrMissingType = errors.New("message type is required")
+
+// ClientMessage 客户端发送的消息。带 id 的请求会收到相同 id 的 ack 或 error 回复
+type ClientMessage struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Lines int             `json:"lines,omitempty"` // scroll_up、scroll_down 的行数，默认 1
+}
+
+// SnippetRequest snippet 消息的 data
+type SnippetRequest struct {
+	ID     string            `json:"id"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ResizeRequest resize 消息的 data
+type ResizeRequest struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+// Hello 连接建立后服务器发送的第一条消息
+type Hello struct {
+	Schema   int    `json:"schema"`
+	Protocol string `json:"protocol"`
+	Session  string `json:"session"`
+	Resumed  bool   `json:"resumed"` // 按 last_seq 补发了错过的消息；为 false 时随后会收到完整输出
+}
+
+// ParseClientMessage 解析 JSON 格式的客户端消息
+func ParseClientMessage(data []byte) (ClientMessage, error) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, err
+	}
+	if msg.Type == "" {
+		return msg, ErrMissingType
+	}
+	return msg, nil
+}
+
+// Text 将 data 解析为字符串，用于 command 和 keys 消息
+func (m ClientMessage) Text() (string, error) {
+	var text string
+	err := m.Decode(&text)
+	return text, err
+}
+
+// Decode 将 data 解析到 v，缺少 data 时返回错误
+func (m ClientMessage) Decode(v interface{}) error {
+	if len(m.Data) == 0 {
+		return errors.New("message data is required")
+	}
+	return json.Unmarshal(m.Data, v)
+}
@@ -0,0 +1,331 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package websocket
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inboxSize 分片待分发消息的队列长度，队列已满时丢弃消息而不阻塞发送方
+const inboxSize = 256
+
+// envelope 待分发的消息
+type envelope struct {
+	message Message
+	toUser  bool   // 只发送给 userID 或管理员的连接
+	userID  string // toUser 为 true 时的目标用户
+}
+
+// shard 单个会话的连接分片：持有会话的连接和重连缓冲区，
+// 由独立的协程分发 SendToSession/SendToUser 的消息
+type shard struct {
+	hub     *Hub
+	session string
+	inbox   chan envelope
+	done    chan struct{}
+
+	mu        sync.Mutex
+	client    *Client // 同一会话只保留最新的连接
+	backlog   *backlog
+	idleSince time.Time // 最后一个连接断开的时间，零值表示有连接
+	closed    bool
+}
+
+// newShard 创建会话分片，调用方负责启动 run
+func newShard(h *Hub, session string) *shard {
+	return &shard{
+		hub:       h,
+		session:   session,
+		inbox:     make(chan envelope, inboxSize),
+		done:      make(chan struct{}),
+		backlog:   newBacklog(h.resumeFrames),
+		idleSince: time.Now(),
+	}
+}
+
+// run 分发队列中的消息，直到分片被关闭
+func (s *shard) run() {
+	defer s.hub.wg.Done()
+
+	for {
+		select {
+		case env := <-s.inbox:
+			s.mu.Lock()
+			s.dispatch(env)
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// enqueue 把消息放入分发队列，队列已满时丢弃并计数
+func (s *shard) enqueue(env envelope) {
+	select {
+	case s.inbox <- env:
+	default:
+		atomic.AddUint64(&s.hub.dropped, 1)
+		log.Printf("[Hub] Inbox full for session=%s, dropped %s message", s.session, env.message.Type)
+	}
+}
+
+// dispatch 把消息发送给分片的连接。调用方需持有 s.mu
+func (s *shard) dispatch(env envelope) {
+	client := s.client
+	if client == nil {
+		return
+	}
+	if env.toUser && client.UserID != env.userID && !client.IsAdmin {
+		return
+	}
+	s.deliver(client, env.message)
+}
+
+// flush 在连接变化前分发队列中已有的消息，保证先发送的消息先到达。调用方需持有 s.mu
+func (s *shard) flush() {
+	for {
+		select {
+		case env := <-s.inbox:
+			s.dispatch(env)
+		default:
+			return
+		}
+	}
+}
+
+// current 返回当前连接
+func (s *shard) current() *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// add 注册连接并踢出旧连接，分片已关闭时返回 false
+func (s *shard) add(client *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.flush()
+
+	// 如果同一会话已有连接，发送踢出消息给旧连接。关闭发送队列后写协程
+	// 会先写出队列中的消息再关闭连接，不需要等待
+	if existing := s.client; existing != nil {
+		s.send(existing, Message{
+			Type: TypeKicked,
+			Data: "Your connection has been replaced by a new connection from another device",
+		})
+		existing.SafeClose()
+	}
+
+	s.client = client
+	s.idleSince = time.Time{}
+	client.stats.connectedAt = time.Now()
+
+	// 重连的客户端补发错过的消息，太久以前的序号无法补齐时改为完整同步
+	var replay []Message
+	resumed := false
+	if client.LastSeq > 0 {
+		var missed []Message
+		if missed, resumed = s.backlog.since(client.LastSeq); resumed {
+			replay = replayable(missed, client.Protocol)
+			// 补发的消息会占满发送队列时改为完整同步
+			resumed = len(replay) < outputHighWater(client)
+		}
+	}
+
+	// 首条消息告知客户端消息格式版本、协商的协议以及是否续传成功
+	s.send(client, Message{
+		Type: TypeHello,
+		Data: Hello{
+			Schema:   SchemaVersion,
+			Protocol: client.Protocol.Subprotocol(),
+			Session:  s.session,
+			Resumed:  resumed,
+		},
+		Session: s.session,
+	})
+
+	if resumed {
+		client.synced = true
+		for _, message := range replay {
+			s.send(client, message)
+		}
+		log.Printf("[Hub] Client resumed: session=%s from seq=%d replayed=%d", s.session, client.LastSeq, len(replay))
+	} else if client.LastSeq > 0 {
+		log.Printf("[Hub] Client resync: session=%s seq=%d is outside the buffer", s.session, client.LastSeq)
+	}
+
+	log.Printf("[Hub] Client registered: session=%s user=%s", s.session, client.UserID)
+	return true
+}
+
+// remove 注销连接。只移除当前连接，被踢出的旧连接注销时不能影响新连接
+func (s *shard) remove(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		return
+	}
+	// 先送出注销前排队的消息（如 session_ended）
+	s.flush()
+	s.client = nil
+	s.idleSince = time.Now()
+	client.SafeClose()
+	client.CloseConn()
+
+	log.Printf("[Hub] Client unregistered: session=%s user=%s", s.session, client.UserID)
+}
+
+// kick 踢出属于该用户的当前连接，返回是否踢出
+func (s *shard) kick(userID, reason string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := s.client
+	if client == nil || client.UserID != userID {
+		return false
+	}
+	s.flush()
+	s.send(client, Message{Type: TypeKicked, Data: reason})
+	// 与 remove 一样先解除绑定，之后的发送不会再写入已关闭的发送队列
+	s.client = nil
+	s.idleSince = time.Now()
+	client.SafeClose()
+	return true
+}
+
+// close 关闭分片和当前连接，用于 Hub 停止
+func (s *shard) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.flush()
+	if s.client != nil {
+		// 写协程写出剩余消息后发送关闭帧
+		s.client.SafeClose()
+		s.client = nil
+	}
+	close(s.done)
+}
+
+// closeIfIdle 没有连接超过 ttl 时关闭分片并返回 true
+func (s *shard) closeIfIdle(ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.client != nil || time.Since(s.idleSince) <= ttl {
+		return false
+	}
+	s.closed = true
+	close(s.done)
+	return true
+}
+
+// reply 直接发送消息给指定连接，连接已注销时忽略
+func (s *shard) reply(client *Client, message Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		return
+	}
+	if message.Session == "" {
+		message.Session = s.session
+	}
+	s.deliver(client, message)
+}
+
+// publish 推送会话的最新输出，见 Hub.PublishOutput
+func (s *shard) publish(client *Client, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		return
+	}
+	if client.synced && text == s.backlog.text {
+		return
+	}
+	// 消费过慢的客户端暂不推送，恢复后推送合并后的变化
+	if s.paused(client) {
+		return
+	}
+
+	previous := s.backlog.text
+	if !client.synced {
+		previous = ""
+	}
+	patch := NewOutputPatch(previous, text)
+	patch.Timestamp = time.Now().Unix()
+	s.backlog.text = text
+	client.synced = true
+	s.deliver(client, Message{Type: TypeOutput, Data: patch, Session: s.session})
+}
+
+// reset 丢弃重连缓冲区，当前连接在下次推送时收到完整输出
+func (s *shard) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.backlog = newBacklog(s.hub.resumeFrames)
+	if s.client != nil {
+		s.client.synced = false
+	}
+}
+
+// deliver 为消息分配会话内的序号并记录到重连缓冲区，然后发送给连接。调用方需持有 s.mu
+func (s *shard) deliver(client *Client, message Message) {
+	s.send(client, s.backlog.push(message))
+}
+
+// send 编码消息并放入连接的发送队列，队列已满时丢弃并计数。输出以补丁形式记录，
+// v1 客户端改为发送完整输出。调用方需持有 s.mu
+func (s *shard) send(client *Client, message Message) {
+	if patch, ok := message.Data.(OutputPatch); ok && client.Protocol != ProtocolMsgpack {
+		message.Data = FullOutput{Text: s.backlog.text, Timestamp: patch.Timestamp}
+	}
+	data, err := client.encode(message)
+	if err != nil {
+		log.Printf("[Hub] Failed to marshal message: %v", err)
+		return
+	}
+	select {
+	case client.Send <- data:
+		client.stats.sent++
+		if queued := len(client.Send); queued > client.stats.maxQueued {
+			client.stats.maxQueued = queued
+		}
+	default:
+		client.stats.dropped++
+		atomic.AddUint64(&s.hub.dropped, 1)
+		log.Printf("[Hub] Send channel full for session=%s, dropped seq=%d", s.session, message.Seq)
+	}
+}
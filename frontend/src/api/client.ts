@@ -97,6 +97,8 @@ export interface LoginResponse {
   token: string
   user_id: string
   username: string
+  display_name: string
+  role: 'admin' | 'user'
 }
 
 export interface Session {
@@ -116,6 +118,13 @@ export interface SendCommandRequest {
   command: string
 }
 
+// One-time ticket for WebSocket / EventSource connections, bound to a session and client IP
+export interface WsTicketResponse {
+  ticket: string
+  session?: string
+  expires_in: number
+}
+
 // API 方法
 export const authApi = {
   login: (data: LoginRequest) => api.post<LoginResponse>('/auth/login', data),
@@ -131,7 +140,30 @@ export const sessionApi = {
   sendCommand: (name: string, data: SendCommandRequest) =>
     api.post(`/sessions/${name}/command`, data),
   streamOutput: (name: string, lines = 100) =>
-    api.get<{ lines: string[] }>(`/sessions/${name}/stream`, { params: { lines } })
+    api.get<{ lines: string[] }>(`/sessions/${name}/stream`, { params: { lines } }),
+  wsTicket: (name: string) => api.post<WsTicketResponse>(`/sessions/${name}/ws-ticket`)
+}
+
+export const eventsApi = {
+  ticket: () => api.post<WsTicketResponse>('/events/ticket')
+}
+
+// Web Push types
+export interface PushPreferences {
+  bell: boolean
+  trigger: boolean
+  agent_prompt: boolean
+  session_exit: boolean
+}
+
+export const pushApi = {
+  publicKey: () => api.get<{ public_key: string }>('/push/vapid-public-key'),
+  subscribe: (subscription: PushSubscriptionJSON) => api.post('/push/subscriptions', subscription),
+  unsubscribe: (endpoint: string) => api.delete('/push/subscriptions', { data: { endpoint } }),
+  getPreferences: () => api.get<PushPreferences>('/push/preferences'),
+  updatePreferences: (prefs: Partial<PushPreferences>) =>
+    api.put<PushPreferences>('/push/preferences', prefs),
+  test: () => api.post('/push/test')
 }
 
 export const healthApi = {
@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import { api, sessionApi } from '@/api/client'
+
+/**
+ * Fallback terminal transports used when WebSocket upgrades are blocked
+ * (e.g. by corporate proxies). Messages have exactly the same format as
+ * WebSocket frames; input is sent with HTTP POST.
+ */
+
+export type TransportName = 'websocket' | 'sse' | 'poll'
+
+export interface TransportInfo {
+  session: string
+  transports: TransportName[]
+}
+
+export interface FallbackCallbacks {
+  onOpen: () => void
+  onMessage: (raw: string) => void
+  onClose: () => void
+}
+
+export interface FallbackTransport {
+  name: TransportName
+  send: (payload: string) => void
+  close: () => void
+}
+
+/**
+ * Ask the server which transports are available for a session, in priority order
+ */
+export async function negotiateTransports(sessionName: string): Promise<TransportName[]> {
+  try {
+    const { data } = await api.get<TransportInfo>(`/sessions/${sessionName}/terminal`)
+    return data.transports
+  } catch {
+    return ['websocket', 'sse', 'poll']
+  }
+}
+
+function postInput(sessionName: string, streamId: string, payload: string) {
+  api
+    .post(`/sessions/${sessionName}/terminal/input`, payload, {
+      params: { stream: streamId },
+      headers: { 'Content-Type': 'application/json' }
+    })
+    .catch((e) => console.error('Failed to send terminal input:', e))
+}
+
+/**
+ * Server-Sent Events transport. Resolves with null if the stream cannot be opened.
+ */
+export async function openSSETransport(
+  sessionName: string,
+  callbacks: FallbackCallbacks
+): Promise<FallbackTransport | null> {
+  // EventSource cannot send headers: authenticate with a one-time ticket instead of the JWT
+  let ticket: string
+  try {
+    const { data } = await sessionApi.wsTicket(sessionName)
+    ticket = data.ticket
+  } catch {
+    return null
+  }
+
+  return new Promise((resolve) => {
+    const url = `${api.defaults.baseURL}/sessions/${sessionName}/terminal/sse?ticket=${encodeURIComponent(ticket)}`
+    const source = new EventSource(url)
+    let streamId = ''
+    let opened = false
+
+    const transport: FallbackTransport = {
+      name: 'sse',
+      send: (payload) => {
+        if (streamId) postInput(sessionName, streamId, payload)
+      },
+      close: () => source.close()
+    }
+
+    source.addEventListener('stream', (event) => {
+      streamId = JSON.parse((event as MessageEvent).data).stream_id
+      opened = true
+      callbacks.onOpen()
+      resolve(transport)
+    })
+    source.addEventListener('message', (event) => {
+      callbacks.onMessage((event as MessageEvent).data)
+    })
+    source.onerror = () => {
+      // Each SSE connection is a new server-side stream, so do not let EventSource auto-reconnect
+      source.close()
+      if (opened) {
+        callbacks.onClose()
+      } else {
+        resolve(null)
+      }
+    }
+  })
+}
+
+/**
+ * HTTP long-poll transport. Resolves with null if the stream cannot be opened.
+ */
+export async function openPollTransport(
+  sessionName: string,
+  callbacks: FallbackCallbacks
+): Promise<FallbackTransport | null> {
+  const url = `/sessions/${sessionName}/terminal/poll`
+  let streamId: string
+  try {
+    const { data } = await api.get<{ stream_id: string }>(url)
+    streamId = data.stream_id
+  } catch {
+    return null
+  }
+
+  let stopped = false
+  const transport: FallbackTransport = {
+    name: 'poll',
+    send: (payload) => postInput(sessionName, streamId, payload),
+    close: () => {
+      stopped = true
+    }
+  }
+
+  const loop = async () => {
+    while (!stopped) {
+      try {
+        const { data } = await api.get<{ messages: unknown[]; closed: boolean }>(url, {
+          params: { stream: streamId, timeout: 25 }
+        })
+        data.messages.forEach((m) => callbacks.onMessage(JSON.stringify(m)))
+        if (data.closed) break
+      } catch {
+        break
+      }
+    }
+    if (!stopped) callbacks.onClose()
+  }
+
+  callbacks.onOpen()
+  loop()
+  return transport
+}
@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import { ref } from 'vue'
+import { pushApi } from '@/api/client'
+
+/**
+ * Web Push subscription for the current browser. The service worker
+ * (public/sw.js) shows the notifications sent by the server.
+ */
+
+export type PushState = 'unsupported' | 'denied' | 'subscribed' | 'unsubscribed'
+
+const SERVICE_WORKER_URL = '/sw.js'
+
+function isSupported(): boolean {
+  return 'serviceWorker' in navigator && 'PushManager' in window && 'Notification' in window
+}
+
+// Convert the base64url VAPID key to the format PushManager expects
+function urlBase64ToUint8Array(value: string): Uint8Array {
+  const padding = '='.repeat((4 - (value.length % 4)) % 4)
+  const base64 = (value + padding).replace(/-/g, '+').replace(/_/g, '/')
+  const raw = atob(base64)
+  return Uint8Array.from(raw, (c) => c.charCodeAt(0))
+}
+
+export function usePushNotifications() {
+  const state = ref<PushState>('unsubscribed')
+  const busy = ref(false)
+
+  async function getRegistration(): Promise<ServiceWorkerRegistration> {
+    const existing = await navigator.serviceWorker.getRegistration(SERVICE_WORKER_URL)
+    return existing || navigator.serviceWorker.register(SERVICE_WORKER_URL)
+  }
+
+  async function refresh() {
+    if (!isSupported()) {
+      state.value = 'unsupported'
+      return
+    }
+    if (Notification.permission === 'denied') {
+      state.value = 'denied'
+      return
+    }
+    const registration = await navigator.serviceWorker.getRegistration(SERVICE_WORKER_URL)
+    const subscription = await registration?.pushManager.getSubscription()
+    state.value = subscription ? 'subscribed' : 'unsubscribed'
+  }
+
+  async function subscribe() {
+    if (!isSupported()) {
+      state.value = 'unsupported'
+      return
+    }
+    busy.value = true
+    try {
+      const permission = await Notification.requestPermission()
+      if (permission !== 'granted') {
+        state.value = permission === 'denied' ? 'denied' : 'unsubscribed'
+        return
+      }
+
+      const { data } = await pushApi.publicKey()
+      const registration = await getRegistration()
+      const subscription =
+        (await registration.pushManager.getSubscription()) ||
+        (await registration.pushManager.subscribe({
+          userVisibleOnly: true,
+          applicationServerKey: urlBase64ToUint8Array(data.public_key)
+        }))
+      await pushApi.subscribe(subscription.toJSON())
+      state.value = 'subscribed'
+    } finally {
+      busy.value = false
+    }
+  }
+
+  async function unsubscribe() {
+    busy.value = true
+    try {
+      const registration = await navigator.serviceWorker.getRegistration(SERVICE_WORKER_URL)
+      const subscription = await registration?.pushManager.getSubscription()
+      if (subscription) {
+        await pushApi.unsubscribe(subscription.endpoint).catch(() => undefined)
+        await subscription.unsubscribe()
+      }
+      state.value = 'unsubscribed'
+    } finally {
+      busy.value = false
+    }
+  }
+
+  return { state, busy, refresh, subscribe, unsubscribe }
+}
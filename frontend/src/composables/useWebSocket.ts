@@ -18,6 +18,14 @@
  */
 
 import { ref, onUnmounted } from 'vue'
+import { sessionApi } from '@/api/client'
+import {
+  negotiateTransports,
+  openPollTransport,
+  openSSETransport,
+  type FallbackTransport,
+  type TransportName
+} from './fallbackTransport'
 
 interface WSMessage {
   type: string
@@ -61,6 +69,9 @@ export function useWebSocket(sessionName: string | (() => string)) {
   const connected = ref(false)
   const error = ref<string | null>(null)
   const kicked = ref(false) // New: track if connection was kicked
+  // Active transport: WebSocket first, falling back to SSE / long-poll when upgrades are blocked
+  const transport = ref<TransportName>('websocket')
+  let fallback: FallbackTransport | null = null
 
   const messageHandlers: MessageHandler[] = []
   const connectHandlers: ConnectionHandler[] = []
@@ -69,65 +80,135 @@ export function useWebSocket(sessionName: string | (() => string)) {
   // Support both static string and getter function for sessionName
   const getSessionName = typeof sessionName === 'function' ? sessionName : () => sessionName
 
-  const getWsUrl = () => {
-    const token = localStorage.getItem('token')
+  // Incremented by every connect/disconnect so a stale ticket request does not open a socket
+  let attempt = 0
+
+  // Exchange the JWT for a one-time ticket so the token never appears in the URL
+  const getWsUrl = async () => {
+    const name = getSessionName()
+    const { data } = await sessionApi.wsTicket(name)
     const wsBaseUrl = getWebSocketBaseUrl()
-    return `${wsBaseUrl}/ws/${getSessionName()}?token=${token}`
+    return `${wsBaseUrl}/ws/${name}?ticket=${encodeURIComponent(data.ticket)}`
+  }
+
+  const handleOpen = () => {
+    connected.value = true
+    error.value = null
+    kicked.value = false // Reset kicked flag on new connection
+    connectHandlers.forEach((h) => h())
   }
 
-  const connect = () => {
+  const handleClose = () => {
+    connected.value = false
+    // Don't call disconnect handlers if kicked
+    if (!kicked.value) {
+      disconnectHandlers.forEach((h) => h())
+    }
+  }
+
+  const handleRawMessage = (raw: string) => {
+    try {
+      const message: WSMessage = JSON.parse(raw)
+
+      // Handle kicked message
+      if (message.type === 'kicked') {
+        kicked.value = true
+        error.value = String(message.data)
+        // Disconnect without triggering reconnect
+        if (ws.value) {
+          ws.value.close()
+        }
+        fallback?.close()
+        return
+      }
+
+      messageHandlers.forEach((h) => h(message))
+    } catch (e) {
+      console.error('Failed to parse WebSocket message:', e)
+    }
+  }
+
+  // Try the fallback transports advertised by the server, in order
+  const connectFallback = async () => {
+    const name = getSessionName()
+    const callbacks = { onOpen: handleOpen, onMessage: handleRawMessage, onClose: handleClose }
+    const order = (await negotiateTransports(name)).filter((t) => t !== 'websocket')
+
+    for (const candidate of order) {
+      const opened =
+        candidate === 'sse'
+          ? await openSSETransport(name, callbacks)
+          : await openPollTransport(name, callbacks)
+      if (opened) {
+        fallback = opened
+        transport.value = candidate
+        return
+      }
+    }
+
+    error.value = 'Failed to connect to terminal'
+    handleClose()
+  }
+
+  const connect = async () => {
     // Don't reconnect if kicked
     if (kicked.value) {
       return
     }
 
+    if (transport.value !== 'websocket') {
+      if (!connected.value) {
+        connectFallback()
+      }
+      return
+    }
+
     if (ws.value?.readyState === WebSocket.OPEN) {
       return
     }
 
+    const current = ++attempt
+    let url: string
+    try {
+      url = await getWsUrl()
+    } catch (e) {
+      if (current !== attempt) return
+      error.value = 'Failed to get WebSocket ticket'
+      console.error('WebSocket ticket error:', e)
+      handleClose()
+      return
+    }
+    if (current !== attempt) {
+      return
+    }
+
     try {
-      ws.value = new WebSocket(getWsUrl())
+      const socket = new WebSocket(url)
+      let opened = false
+      ws.value = socket
 
-      ws.value.onopen = () => {
-        connected.value = true
-        error.value = null
-        kicked.value = false // Reset kicked flag on new connection
-        connectHandlers.forEach((h) => h())
+      socket.onopen = () => {
+        opened = true
+        handleOpen()
       }
 
-      ws.value.onclose = () => {
-        connected.value = false
-        // Don't call disconnect handlers if kicked
-        if (!kicked.value) {
-          disconnectHandlers.forEach((h) => h())
+      socket.onclose = () => {
+        // The upgrade never succeeded (e.g. stripped by a proxy): switch to a fallback transport
+        if (!opened && !kicked.value) {
+          ws.value = null
+          transport.value = 'sse'
+          connectFallback()
+          return
         }
+        handleClose()
       }
 
-      ws.value.onerror = (event) => {
+      socket.onerror = (event) => {
         error.value = 'WebSocket connection error'
         console.error('WebSocket error:', event)
       }
 
-      ws.value.onmessage = (event) => {
-        try {
-          const message: WSMessage = JSON.parse(event.data)
-
-          // Handle kicked message
-          if (message.type === 'kicked') {
-            kicked.value = true
-            error.value = String(message.data)
-            // Disconnect without triggering reconnect
-            if (ws.value) {
-              ws.value.close()
-            }
-            return
-          }
-
-          messageHandlers.forEach((h) => h(message))
-        } catch (e) {
-          console.error('Failed to parse WebSocket message:', e)
-        }
-      }
+      socket.onmessage = (event) => handleRawMessage(event.data)
     } catch (e) {
       error.value = 'Failed to connect to WebSocket'
       console.error('WebSocket connection error:', e)
@@ -135,16 +216,21 @@ export function useWebSocket(sessionName: string | (() => string)) {
   }
 
   const disconnect = () => {
+    attempt++
     if (ws.value) {
       ws.value.close()
       ws.value = null
     }
+    fallback?.close()
+    fallback = null
     connected.value = false
   }
 
   const send = (type: string, data: unknown) => {
     if (ws.value?.readyState === WebSocket.OPEN) {
       ws.value.send(JSON.stringify({ type, data }))
+    } else if (fallback && connected.value) {
+      fallback.send(JSON.stringify({ type, data }))
     }
   }
 
@@ -193,6 +279,7 @@ export function useWebSocket(sessionName: string | (() => string)) {
     connected,
     error,
     kicked,
+    transport,
     connect,
     disconnect,
     send,
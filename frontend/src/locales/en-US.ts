@@ -90,7 +90,13 @@ export default {
     workDirectoryPlaceholder: '/home/user/projects',
     workDirectoryReadOnly: 'Work directory cannot be changed after session creation. Please delete and recreate the session to change it',
     sessionConfig: 'Session Config',
-    noSessions: 'No sessions'
+    noSessions: 'No sessions',
+    enableNotifications: 'Enable notifications',
+    disableNotifications: 'Disable notifications',
+    notificationsEnabled: 'Notifications enabled',
+    notificationsDisabled: 'Notifications disabled',
+    notificationsDenied: 'Notification permission was denied in the browser',
+    notificationsFailed: 'Failed to change notification settings'
   },
   fileExplorer: {
     title: 'File Explorer',
@@ -90,7 +90,13 @@ export default {
     workDirectoryPlaceholder: '/home/user/projects',
     workDirectoryReadOnly: '工作目录在会话创建后不可修改，如需更改请删除并重新创建会话',
     sessionConfig: '会话配置',
-    noSessions: '暂无会话'
+    noSessions: '暂无会话',
+    enableNotifications: '开启通知',
+    disableNotifications: '关闭通知',
+    notificationsEnabled: '已开启通知',
+    notificationsDisabled: '已关闭通知',
+    notificationsDenied: '浏览器已拒绝通知权限',
+    notificationsFailed: '修改通知设置失败'
   },
   fileExplorer: {
     title: '文件浏览器',